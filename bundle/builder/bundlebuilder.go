@@ -15,12 +15,17 @@ type BundleBuilder struct {
 	*SpecBuilder
 	image        bundle.BundleImage
 	managedFiles map[string]bool
+	overlay      bool
+	cloneMode    string
+	squashfs     bool
+	specCache    *SpecCache
+	specCacheKey string
 }
 
 func Builder(id string) *BundleBuilder {
 	specgen := NewSpecBuilder()
 	specgen.SetRootPath("rootfs")
-	b := &BundleBuilder{"", &specgen, nil, map[string]bool{}}
+	b := &BundleBuilder{"", &specgen, nil, map[string]bool{}, false, "", false, nil, ""}
 	b.SetID(id)
 	return b
 }
@@ -39,6 +44,32 @@ func (b *BundleBuilder) SetImage(image bundle.BundleImage) {
 	b.image = image
 }
 
+// Mounts the rootfs as overlay of shared image layer directories instead of
+// extracting a bundle-local copy
+func (b *BundleBuilder) SetRootfsOverlay(overlay bool) {
+	b.overlay = overlay
+}
+
+// Clones the cached image file system into the rootfs using the given mode
+// (reflink|hardlink|copy) instead of extracting a copy
+func (b *BundleBuilder) SetRootfsClone(mode string) {
+	b.cloneMode = mode
+}
+
+// Mounts the image's cached squashfs blob read-only as the rootfs lower
+// layer instead of extracting a bundle-local copy
+func (b *BundleBuilder) SetRootfsSquashfs(squashfs bool) {
+	b.squashfs = squashfs
+}
+
+// Reuses a previously generated spec for the given cache key (derived from
+// the image digest and the normalized container options) instead of
+// regenerating it
+func (b *BundleBuilder) SetSpecCache(cache *SpecCache, key string) {
+	b.specCache = cache
+	b.specCacheKey = key
+}
+
 // Overlays the provided file path with a bind mounted read-only copy.
 // The file's content is supposed to be managed by an OCI hook.
 func (b *BundleBuilder) AddBindMountConfig(path string) {
@@ -50,7 +81,16 @@ func (b *BundleBuilder) AddBindMountConfig(path string) {
 
 func (b *BundleBuilder) Build(bundle *bundle.LockedBundle) (err error) {
 	// Prepare rootfs
-	if err = bundle.UpdateRootfs(b.image); err != nil {
+	if b.squashfs {
+		err = bundle.UpdateRootfsSquashfs(b.image, b.rootless)
+	} else if b.overlay {
+		err = bundle.UpdateRootfsOverlay(b.image, b.rootless)
+	} else if b.cloneMode != "" {
+		err = bundle.UpdateRootfsClone(b.image, b.cloneMode, b.rootless)
+	} else {
+		err = bundle.UpdateRootfs(b.image)
+	}
+	if err != nil {
 		return errors.Wrap(err, "build bundle")
 	}
 
@@ -61,12 +101,31 @@ func (b *BundleBuilder) Build(bundle *bundle.LockedBundle) (err error) {
 		}
 	}
 
+	// Reuse cached spec generated from the same image and options
+	if b.specCache != nil && b.specCacheKey != "" {
+		if spec := b.specCache.Get(b.specCacheKey); spec != nil {
+			// Apply the bundle-specific fields on top of the cached spec
+			generated := b.Generator.Spec()
+			spec.Hostname = generated.Hostname
+			if spec.Annotations == nil {
+				spec.Annotations = map[string]string{}
+			}
+			for k, v := range generated.Annotations {
+				spec.Annotations[k] = v
+			}
+			return errors.Wrap(bundle.SetSpec(spec), "build bundle")
+		}
+	}
+
 	// Resolve user/group names
 	rootfs := filepath.Join(bundle.Dir(), b.Generator.Spec().Root.Path)
 	spec, err := b.Spec(rootfs)
 	if err != nil {
 		return errors.Wrap(err, "build bundle")
 	}
+	if b.specCache != nil && b.specCacheKey != "" {
+		b.specCache.Put(b.specCacheKey, spec)
+	}
 
 	// Apply spec
 	return errors.Wrap(bundle.SetSpec(spec), "build bundle")
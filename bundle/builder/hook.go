@@ -35,6 +35,7 @@ type NetConfig struct {
 	Domainname    string            `json:"domainname,omitempty"`
 	Hosts         map[string]string `json:"hosts,omitempty"`
 	Networks      []string          `json:"networks,omitempty"`
+	NetworkOpts   map[string]string `json:"network_opts,omitempty"`
 	Ports         []PortMapEntry    `json:"ports,omitempty"`
 	IPAMDataDir   string            `json:"dataDir,omitempty"`
 }
@@ -110,6 +111,13 @@ func (b *HookBuilder) AddNetwork(networkID string) {
 	utils.AddToSet(&b.hook.Networks, networkID)
 }
 
+func (b *HookBuilder) AddNetworkOpt(name, value string) {
+	if b.hook.NetworkOpts == nil {
+		b.hook.NetworkOpts = map[string]string{}
+	}
+	b.hook.NetworkOpts[name] = value
+}
+
 func (b *HookBuilder) AddPortMapEntry(entry PortMapEntry) {
 	b.hook.Ports = append(b.hook.Ports, entry)
 }
@@ -167,6 +175,11 @@ func (b *HookBuilder) Build(spec *generate.Generator) (err error) {
 	for name, ip := range b.hook.Hosts {
 		netInitHookArgs = append(netInitHookArgs, "--hosts-entry="+name+"="+ip)
 	}
+	for name, value := range b.hook.NetworkOpts {
+		nOpt := "--network-opt=" + name + "=" + value
+		netInitHookArgs = append(netInitHookArgs, nOpt)
+		netRmHookArgs = append(netRmHookArgs, nOpt)
+	}
 	for _, p := range b.hook.Ports {
 		pOpt := "--publish=" + p.String()
 		netInitHookArgs = append(netInitHookArgs, pOpt)
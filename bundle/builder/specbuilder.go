@@ -31,14 +31,25 @@ import (
 	"github.com/syndtr/gocapability/capability"
 )
 
+// Path the host-provided entrypoint wrapper is bind-mounted to
+const entrypointWrapperPath = "/dev/.ctnr-entrypoint-wrapper"
+
+// Annotation recording the container's clock offset in seconds
+const ANNOTATION_CLOCK_OFFSET = "com.github.mgoltzsche.ctnr.bundle.clock-offset"
+
+// Linux time namespace (kernel >=5.6) which is not declared by the
+// vendored runtime-spec yet
+const timeNamespace rspecs.LinuxNamespaceType = "time"
+
 type SpecBuilder struct {
 	generate.Generator
-	entrypoint    []string
-	cmd           []string
-	user          idutils.User
-	customSeccomp bool
-	proot         *prootOptions
-	rootless      bool
+	entrypoint        []string
+	cmd               []string
+	entrypointWrapper string
+	user              idutils.User
+	customSeccomp     bool
+	proot             *prootOptions
+	rootless          bool
 }
 
 type prootOptions struct {
@@ -73,6 +84,100 @@ func (b *SpecBuilder) UseHostNetwork() {
 	b.AddBindMount("/etc/resolv.conf", "/etc/resolv.conf", opts)
 }
 
+// Parses an OCI hugepage size (e.g. 64KB, 2MB, 1GB) into kilobytes
+func hugepageSizeKB(pageSize string) (kb uint64, err error) {
+	num := ""
+	factor := uint64(0)
+	switch {
+	case strings.HasSuffix(pageSize, "KB"):
+		num, factor = strings.TrimSuffix(pageSize, "KB"), 1
+	case strings.HasSuffix(pageSize, "MB"):
+		num, factor = strings.TrimSuffix(pageSize, "MB"), 1024
+	case strings.HasSuffix(pageSize, "GB"):
+		num, factor = strings.TrimSuffix(pageSize, "GB"), 1024*1024
+	}
+	n, e := strconv.ParseUint(num, 10, 64)
+	if factor == 0 || e != nil || n == 0 {
+		return 0, errors.Errorf("invalid hugepage size %q - expected e.g. 64KB, 2MB or 1GB", pageSize)
+	}
+	return n * factor, nil
+}
+
+// Limits the container's hugepage usage for the given page size after
+// verifying that the host kernel provides hugepages of that size
+func (b *SpecBuilder) AddHugepageLimit(pageSize string, limit uint64) (err error) {
+	kb, err := hugepageSizeKB(pageSize)
+	if err != nil {
+		return
+	}
+	if _, e := os.Stat("/sys/kernel/mm/hugepages/hugepages-" + strconv.FormatUint(kb, 10) + "kB"); e != nil {
+		return errors.Errorf("hugepage limit: the host does not provide %s hugepages", pageSize)
+	}
+	b.AddLinuxResourcesHugepageLimit(pageSize, limit)
+	return
+}
+
+// Applies the Intel RDT L3 cache allocation schema (CAT) after verifying
+// that the host kernel supports it and has the resctrl file system mounted
+func (b *SpecBuilder) SetIntelRdtL3CacheSchema(schema string) (err error) {
+	if _, e := os.Stat("/sys/fs/resctrl"); e != nil {
+		return errors.New("intel rdt: the host kernel does not support it or the resctrl file system is not mounted at /sys/fs/resctrl")
+	}
+	spec := b.Generator.Spec()
+	if spec.Linux == nil {
+		spec.Linux = &rspecs.Linux{}
+	}
+	spec.Linux.IntelRdt = &rspecs.LinuxIntelRdt{L3CacheSchema: schema}
+	return
+}
+
+// Makes the container join the network, IPC and UTS namespaces of the
+// given running process (usually a pod's infra container) instead of
+// creating own ones
+func (b *SpecBuilder) JoinSharedNamespaces(pid int) (err error) {
+	nsDir := "/proc/" + strconv.Itoa(pid) + "/ns"
+	if err = b.AddOrReplaceLinuxNamespace(rspecs.NetworkNamespace, nsDir+"/net"); err == nil {
+		if err = b.AddOrReplaceLinuxNamespace(rspecs.IPCNamespace, nsDir+"/ipc"); err == nil {
+			err = b.AddOrReplaceLinuxNamespace(rspecs.UTSNamespace, nsDir+"/uts")
+		}
+	}
+	return errors.Wrap(err, "join shared namespaces")
+}
+
+// Returns true when the kernel supports time namespaces (>=5.6)
+func SupportsTimeNamespace() bool {
+	_, err := os.Stat("/proc/self/ns/time")
+	return err == nil
+}
+
+// Places the container in its own Linux time namespace with the given
+// offset applied to its monotonic and boot-time clocks so that e.g.
+// tests can run with a shifted clock without affecting the host.
+// The offset is recorded as annotation since the vendored runtime-spec
+// does not declare the timeOffsets field yet - a time-namespace-aware
+// runtime is required to apply it.
+func (b *SpecBuilder) SetClockOffset(offset time.Duration) (err error) {
+	if !SupportsTimeNamespace() {
+		return errors.New("clock offset requested but the kernel does not support time namespaces (>=5.6 required)")
+	}
+	spec := b.Generator.Spec()
+	if spec.Linux == nil {
+		spec.Linux = &rspecs.Linux{}
+	}
+	found := false
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == timeNamespace {
+			found = true
+			break
+		}
+	}
+	if !found {
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, rspecs.LinuxNamespace{Type: timeNamespace})
+	}
+	b.AddAnnotation(ANNOTATION_CLOCK_OFFSET, strconv.FormatInt(int64(offset/time.Second), 10))
+	return
+}
+
 func (b *SpecBuilder) SetProcessUser(user idutils.User) {
 	b.user = user
 }
@@ -176,6 +281,14 @@ func (b *SpecBuilder) AddPRootPortMapping(published, target string) {
 	b.proot.Ports = append(b.proot.Ports, published+":"+target)
 }
 
+// Bind-mounts the given host-provided binary or script read-only into the
+// container and prepends it to the process args, e.g. to inject corporate
+// certificates or tracing agents into every container
+func (b *SpecBuilder) SetEntrypointWrapper(hostPath string) {
+	b.entrypointWrapper = hostPath
+	b.AddBindMount(hostPath, entrypointWrapperPath, []string{"bind", "ro"})
+}
+
 func (b *SpecBuilder) SetProcessEntrypoint(v []string) {
 	b.entrypoint = v
 	b.cmd = nil
@@ -198,6 +311,9 @@ func (b *SpecBuilder) applyEntrypoint() {
 	} else {
 		args = []string{}
 	}
+	if b.entrypointWrapper != "" {
+		args = append([]string{entrypointWrapperPath}, args...)
+	}
 	if b.proot != nil {
 		prootArgs := []string{"/dev/proot/proot", "--kill-on-exit", "-n"}
 		user := b.user.String()
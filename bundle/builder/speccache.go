@@ -0,0 +1,85 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mgoltzsche/ctnr/pkg/log"
+	digest "github.com/opencontainers/go-digest"
+	rspecs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Caches generated runtime specs keyed by image digest and normalized
+// container options so that repeated runs of the same image skip user
+// resolution, seccomp generation and spec generation.
+// Cache failures are logged and result in plain spec regeneration.
+type SpecCache struct {
+	dir  string
+	warn log.Logger
+}
+
+func NewSpecCache(dir string, warn log.Logger) *SpecCache {
+	return &SpecCache{dir, warn}
+}
+
+// Derives the cache key from the image digest and the normalized
+// container options
+func (c *SpecCache) Key(imageId digest.Digest, normalizedOptions string) string {
+	return digest.SHA256.FromString(imageId.String() + "\n" + normalizedOptions).Hex()
+}
+
+// Returns the cached spec for the given key or nil when not cached
+func (c *SpecCache) Get(key string) *rspecs.Spec {
+	b, err := ioutil.ReadFile(c.file(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.warn.Printf("spec cache: %s", err)
+		}
+		return nil
+	}
+	spec := &rspecs.Spec{}
+	if err = json.Unmarshal(b, spec); err != nil {
+		c.warn.Printf("spec cache: %s", err)
+		return nil
+	}
+	return spec
+}
+
+// Caches the given spec, replacing an existing entry atomically so that
+// concurrent readers never see a partially written spec
+func (c *SpecCache) Put(key string, spec *rspecs.Spec) {
+	err := c.put(key, spec)
+	if err != nil {
+		c.warn.Printf("spec cache: %s", err)
+	}
+}
+
+func (c *SpecCache) put(key string, spec *rspecs.Spec) (err error) {
+	if err = os.MkdirAll(c.dir, 0750); err != nil {
+		return
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-spec-")
+	if err != nil {
+		return
+	}
+	tmpName := tmp.Name()
+	_, err = tmp.Write(b)
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmpName, c.file(key))
+	}
+	if err != nil {
+		os.Remove(tmpName)
+	}
+	return
+}
+
+func (c *SpecCache) file(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
@@ -18,7 +18,16 @@ import (
 	"github.com/pkg/errors"
 )
 
-const ANNOTATION_BUNDLE_ID = "com.github.mgoltzsche.ctnr.bundle.id"
+const (
+	ANNOTATION_BUNDLE_ID = "com.github.mgoltzsche.ctnr.bundle.id"
+
+	// Resource usage of the bundle's last container, recorded on exit
+	ANNOTATION_METRICS_CPU_SECONDS = "com.github.mgoltzsche.ctnr.metrics.cpu.seconds"
+	ANNOTATION_METRICS_MEM_PEAK    = "com.github.mgoltzsche.ctnr.metrics.memory.peak"
+	ANNOTATION_METRICS_WALL_TIME   = "com.github.mgoltzsche.ctnr.metrics.walltime"
+	ANNOTATION_METRICS_NET_RX      = "com.github.mgoltzsche.ctnr.metrics.network.rx"
+	ANNOTATION_METRICS_NET_TX      = "com.github.mgoltzsche.ctnr.metrics.network.tx"
+)
 
 type Bundle struct {
 	id      string
@@ -44,6 +53,11 @@ func NewBundle(dir string) (r Bundle, err error) {
 	return
 }
 
+// Restores a bundle from cached metadata without accessing the file system
+func NewCachedBundle(dir string, created time.Time) (r Bundle) {
+	return Bundle{filepath.Base(dir), dir, created}
+}
+
 func (b *Bundle) ID() string {
 	return b.id
 }
@@ -68,6 +82,17 @@ func (b *Bundle) loadSpec() (r rspecs.Spec, err error) {
 	return
 }
 
+// Returns the bundle spec's annotations without locking the bundle
+func (b *Bundle) Annotations() (map[string]string, error) {
+	spec, err := b.loadSpec()
+	return spec.Annotations, err
+}
+
+// Returns the bundle's spec without locking the bundle
+func (b *Bundle) Spec() (rspecs.Spec, error) {
+	return b.loadSpec()
+}
+
 func (b *Bundle) Image() *digest.Digest {
 	if imgIdb, err := ioutil.ReadFile(b.imageFile()); err == nil {
 		d, err := digest.Parse(strings.Trim(string(imgIdb), " \n"))
@@ -209,7 +234,13 @@ func (b *LockedBundle) Image() *digest.Digest {
 
 func (b *LockedBundle) Delete() (err error) {
 	b.checkLocked()
-	return exterrors.Append(DeleteDirSafely(b.Dir()), b.Close())
+	// Unmount an overlay/squashfs rootfs before its directory is deleted
+	for _, dir := range []string{filepath.Join(b.Dir(), "rootfs"), filepath.Join(b.Dir(), "squashfs")} {
+		if mounted, e := isMountpoint(dir); e == nil && mounted {
+			err = exterrors.Append(err, unmountRootfs(dir))
+		}
+	}
+	return exterrors.Append(err, exterrors.Append(DeleteDirSafely(b.Dir()), b.Close()))
 }
 
 // Updates the rootfs if the image changed
@@ -227,9 +258,27 @@ func (b *LockedBundle) UpdateRootfs(image BundleImage) (err error) {
 		id := image.ID()
 		imgId = &id
 	}
+	// Apply only the image's additional layers if the rootfs contains the
+	// unpacked parent image already (e.g. when the image gained a layer
+	// during a build). Falls back to a full unpack when the new image is no
+	// extension of the contained one.
+	if _, e := os.Stat(rootfs); e == nil && lastImgId != nil && image != nil {
+		if delta, ok := image.(BundleImageDelta); ok {
+			if e = delta.UnpackDelta(*lastImgId, rootfs); e == nil {
+				return b.SetParentImageId(imgId)
+			}
+		}
+	}
 	if err = DeleteDirSafely(rootfs); err != nil && !os.IsNotExist(err) {
 		return
 	}
+	if image == nil {
+		// An imageless bundle (e.g. a pod's infra container) gets an empty rootfs
+		if err = os.MkdirAll(rootfs, 0755); err != nil {
+			return errors.New(err.Error())
+		}
+		return b.SetParentImageId(nil)
+	}
 	if err = image.Unpack(rootfs); err != nil {
 		return
 	}
@@ -272,10 +321,31 @@ func (b *LockedBundle) checkLocked() {
 	}
 }
 
+// Removes the mount source creation pseudo options (create/create-dir/create-file)
+// from the given mount options, returning the creation policy separately.
+func SplitMountCreateOptions(opts []string) (mountOpts []string, createPolicy string) {
+	mountOpts = opts
+	for i, opt := range opts {
+		switch opt {
+		case "create", "create-dir":
+			createPolicy = "dir"
+		case "create-file":
+			createPolicy = "file"
+		default:
+			continue
+		}
+		mountOpts = append(append(make([]string, 0, len(opts)-1), opts[:i]...), opts[i+1:]...)
+		break
+	}
+	return
+}
+
 func createVolumeDirectories(spec *rspecs.Spec, dir string) (err error) {
 	if spec != nil && spec.Mounts != nil {
-		for _, mount := range spec.Mounts {
+		for i, mount := range spec.Mounts {
 			if mount.Type == "bind" {
+				opts, create := SplitMountCreateOptions(mount.Options)
+				spec.Mounts[i].Options = opts
 				src := mount.Source
 				if !filepath.IsAbs(src) {
 					src = filepath.Join(dir, src)
@@ -283,13 +353,29 @@ func createVolumeDirectories(spec *rspecs.Spec, dir string) (err error) {
 				relsrc := filepath.Clean(mount.Source)
 				if _, err = os.Stat(src); os.IsNotExist(err) {
 					withinBundleDir := !filepath.IsAbs(relsrc) && strings.Index(relsrc+string(filepath.Separator), ".."+string(filepath.Separator)) != 0
-					if withinBundleDir {
+					if withinBundleDir || create == "dir" {
 						if err = os.MkdirAll(src, 0755); err != nil {
 							break
 						}
+					} else if create == "file" {
+						if err = os.MkdirAll(filepath.Dir(src), 0755); err != nil {
+							break
+						}
+						var f *os.File
+						if f, err = os.OpenFile(src, os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+							break
+						}
+						if err = f.Close(); err != nil {
+							break
+						}
 					} else {
 						err = errors.Errorf("bind mount source %q does not exist", mount.Source)
 					}
+					if err == nil && create != "" && !withinBundleDir {
+						if err = chownToProcessUser(spec, src); err != nil {
+							break
+						}
+					}
 				} else if err != nil {
 					break
 				}
@@ -302,6 +388,19 @@ func createVolumeDirectories(spec *rspecs.Spec, dir string) (err error) {
 	return
 }
 
+// Assigns a created mount source to the container process user.
+// Failures are tolerated for unprivileged users.
+func chownToProcessUser(spec *rspecs.Spec, file string) (err error) {
+	if spec.Process == nil {
+		return
+	}
+	usr := spec.Process.User
+	if err = os.Chown(file, int(usr.UID), int(usr.GID)); err != nil && os.Geteuid() != 0 {
+		err = nil
+	}
+	return
+}
+
 func lockBundle(bundle *Bundle) (l *lock.Lockfile, err error) {
 	// TODO: use tmpfs for lock file
 	if l, err = lock.LockFile(filepath.Clean(bundle.dir) + ".lock"); err == nil {
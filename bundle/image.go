@@ -11,3 +11,9 @@ type BundleImage interface {
 	Config() *ispecs.Image
 	Unpack(dest string) error
 }
+
+// Optionally implemented by a BundleImage to apply only the layers the image
+// adds on top of a parent image to an existing rootfs
+type BundleImageDelta interface {
+	UnpackDelta(parentImageId digest.Digest, dest string) error
+}
@@ -0,0 +1,126 @@
+package bundle
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Optionally implemented by a BundleImage whose layers can be provided as
+// separately extracted shared directories for use as overlayfs lowerdirs
+type BundleImageOverlay interface {
+	UnpackLayersShared() (layerDirs []string, err error)
+}
+
+// Mounts the image's shared layer directories as overlayfs (or fuse-overlayfs
+// when rootless) below the bundle's rootfs with a bundle-local upperdir so
+// that the image layers are extracted only once for all bundles and the
+// bundle only occupies the space its rootfs changes require.
+// Falls back to a plain rootfs copy when the image does not support shared
+// layer directories.
+func (b *LockedBundle) UpdateRootfsOverlay(image BundleImage, rootless bool) (err error) {
+	b.checkLocked()
+	defer func() {
+		err = errors.WithMessage(err, "update bundle rootfs overlay")
+	}()
+	overlayImg, ok := image.(BundleImageOverlay)
+	if !ok {
+		return b.UpdateRootfs(image)
+	}
+	rootfs := filepath.Join(b.Dir(), "rootfs")
+	mounted, err := isMountpoint(rootfs)
+	if err != nil {
+		return
+	}
+	imgId := image.ID()
+	if lastImgId := b.Image(); mounted && lastImgId != nil && *lastImgId == imgId {
+		return // rootfs overlay of the provided image is mounted already
+	}
+	layerDirs, err := overlayImg.UnpackLayersShared()
+	if err != nil {
+		return
+	}
+	if mounted {
+		if err = unmountRootfs(rootfs); err != nil {
+			return
+		}
+	}
+	upperDir := filepath.Join(b.Dir(), "overlay", "diff")
+	workDir := filepath.Join(b.Dir(), "overlay", "work")
+	for _, dir := range []string{rootfs, upperDir, workDir} {
+		if e := os.MkdirAll(dir, 0755); e != nil {
+			return errors.New(e.Error())
+		}
+	}
+	if err = mountOverlay(rootfs, layerDirs, upperDir, workDir, rootless); err != nil {
+		return
+	}
+	return b.SetParentImageId(&imgId)
+}
+
+func mountOverlay(rootfs string, layerDirs []string, upperDir, workDir string, rootless bool) (err error) {
+	// overlayfs expects the topmost lowerdir first - the reverse image layer order
+	lowerDirs := make([]string, len(layerDirs))
+	for i, dir := range layerDirs {
+		lowerDirs[len(layerDirs)-1-i] = dir
+	}
+	data := "lowerdir=" + strings.Join(lowerDirs, ":") + ",upperdir=" + upperDir + ",workdir=" + workDir
+	if rootless {
+		fuseOverlayfs, e := exec.LookPath("fuse-overlayfs")
+		if e != nil {
+			return errors.New("rootless overlay rootfs requires the fuse-overlayfs binary within $PATH")
+		}
+		var buf bytes.Buffer
+		c := exec.Command(fuseOverlayfs, "-o", data, rootfs)
+		c.Stderr = &buf
+		if e = c.Run(); e != nil {
+			return errors.Errorf("fuse-overlayfs: %s. output: %s", e, strings.TrimSpace(buf.String()))
+		}
+		return
+	}
+	return errors.Wrap(syscall.Mount("overlay", rootfs, "overlay", 0, data), "mount overlay")
+}
+
+// Unmounts an overlay (or any other) rootfs mount, falling back to fusermount
+// for fuse-overlayfs mounts of unprivileged users.
+func unmountRootfs(rootfs string) (err error) {
+	if err = syscall.Unmount(rootfs, syscall.MNT_DETACH); err == nil {
+		return
+	}
+	for _, fusermount := range []string{"fusermount3", "fusermount"} {
+		bin, e := exec.LookPath(fusermount)
+		if e != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		c := exec.Command(bin, "-u", rootfs)
+		c.Stderr = &buf
+		if e = c.Run(); e == nil {
+			return nil
+		}
+	}
+	return errors.Errorf("unmount rootfs %s: %s", rootfs, err)
+}
+
+// Reports whether dir is a mount point by comparing its device with its
+// parent directory's device.
+func isMountpoint(dir string) (mounted bool, err error) {
+	var st, pst syscall.Stat_t
+	if err = syscall.Stat(dir, &st); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		} else {
+			err = errors.Errorf("check mount point %s: %s", dir, err)
+		}
+		return
+	}
+	if err = syscall.Stat(filepath.Dir(dir), &pst); err != nil {
+		return false, errors.Errorf("check mount point %s: %s", dir, err)
+	}
+	return st.Dev != pst.Dev, nil
+}
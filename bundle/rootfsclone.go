@@ -0,0 +1,139 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// FICLONE ioctl number cloning a file's extents (reflink, btrfs/xfs)
+const ficlone = 0x40049409
+
+// Optionally implemented by a BundleImage whose complete extracted file
+// system can be provided as a shared read-only directory
+type BundleImageFs interface {
+	UnpackFsShared() (dir string, err error)
+}
+
+// Clones the image's shared extracted file system into the bundle's rootfs
+// using reflinks (FICLONE, btrfs/xfs) or hardlinks instead of copying file
+// contents, as copy-on-write fallback for hosts without overlayfs support.
+// ATTENTION: hardlink mode shares the cached image's inodes with the bundle -
+// in-place file modifications within the container corrupt the cache.
+func (b *LockedBundle) UpdateRootfsClone(image BundleImage, mode string, rootless bool) (err error) {
+	b.checkLocked()
+	defer func() {
+		err = errors.WithMessage(err, "update bundle rootfs clone")
+	}()
+	switch mode {
+	case "reflink", "hardlink":
+	case "", "copy":
+		return b.UpdateRootfs(image)
+	default:
+		return errors.Errorf("unsupported rootfs clone mode %q", mode)
+	}
+	fsImg, ok := image.(BundleImageFs)
+	if image == nil || !ok {
+		return b.UpdateRootfs(image)
+	}
+	rootfs := filepath.Join(b.Dir(), "rootfs")
+	imgId := image.ID()
+	if _, e := os.Stat(rootfs); e == nil {
+		if lastImgId := b.Image(); lastImgId != nil && *lastImgId == imgId {
+			return // don't update since the bundle is already based on the provided image
+		}
+	}
+	srcDir, err := fsImg.UnpackFsShared()
+	if err != nil {
+		return
+	}
+	if err = DeleteDirSafely(rootfs); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.Mkdir(rootfs, 0755); err != nil {
+		return errors.New(err.Error())
+	}
+	if err = cloneTree(srcDir, rootfs, mode == "reflink", rootless); err != nil {
+		return
+	}
+	return b.SetParentImageId(&imgId)
+}
+
+// Recreates the srcDir tree below destDir, reflinking or hardlinking regular
+// files instead of copying their contents. Directories and symlinks are
+// recreated since they cannot be hardlinked.
+func cloneTree(srcDir, destDir string, reflink bool, rootless bool) (err error) {
+	return filepath.Walk(srcDir, func(path string, si os.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		rel, e := filepath.Rel(srcDir, path)
+		if e != nil {
+			return e
+		}
+		if rel == "." {
+			return nil
+		}
+		dest := filepath.Join(destDir, rel)
+		switch {
+		case si.IsDir():
+			if e = os.Mkdir(dest, si.Mode().Perm()); e != nil {
+				return e
+			}
+			return cloneMetadata(dest, si, rootless)
+		case si.Mode()&os.ModeSymlink != 0:
+			target, e := os.Readlink(path)
+			if e != nil {
+				return e
+			}
+			if e = os.Symlink(target, dest); e != nil {
+				return e
+			}
+			return cloneMetadata(dest, si, rootless)
+		case si.Mode().IsRegular() && reflink:
+			if e = reflinkFile(path, dest, si.Mode().Perm()); e != nil {
+				return e
+			}
+			return cloneMetadata(dest, si, rootless)
+		default:
+			// Hardlinks share all metadata with the source
+			return os.Link(path, dest)
+		}
+	})
+}
+
+func cloneMetadata(dest string, si os.FileInfo, rootless bool) (err error) {
+	if !rootless {
+		st := si.Sys().(*syscall.Stat_t)
+		if err = os.Lchown(dest, int(st.Uid), int(st.Gid)); err != nil {
+			return
+		}
+	}
+	if si.Mode()&os.ModeSymlink == 0 {
+		err = os.Chmod(dest, si.Mode().Perm())
+	}
+	return
+}
+
+func reflinkFile(src, dest string, mode os.FileMode) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := out.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd()); errno != 0 {
+		err = errors.Errorf("reflink %s: %s. hint: reflinks require a btrfs or xfs store file system", dest, errno)
+	}
+	return
+}
@@ -8,9 +8,12 @@ type BundleStore interface {
 	CreateBundle(id string, update bool) (*LockedBundle, error)
 	Bundle(id string) (Bundle, error)
 	Bundles() ([]Bundle, error)
-	BundleGC(ttl time.Duration, containers ContainerStore) ([]Bundle, error)
+	BundleGC(ttl time.Duration, containers ContainerStore, match BundleMatcher) ([]Bundle, error)
 }
 
+// Restricts the bundles a batch operation is applied to. nil matches all bundles.
+type BundleMatcher func(*Bundle) bool
+
 type ContainerStore interface {
 	Exist(id string) (bool, error)
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/mgoltzsche/ctnr/bundle"
+	"github.com/mgoltzsche/ctnr/pkg/dirindex"
 	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
 	"github.com/mgoltzsche/ctnr/pkg/log"
 	"github.com/pkg/errors"
@@ -16,15 +17,29 @@ var _ bundle.BundleStore = &BundleStore{}
 
 type BundleStore struct {
 	dir   string
+	index dirindex.Index
 	debug log.FieldLogger
 	info  log.FieldLogger
 }
 
+type bundleEntry struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+}
+
 func NewBundleStore(dir string, info log.FieldLogger, debug log.FieldLogger) *BundleStore {
-	return &BundleStore{dir, debug, info}
+	return &BundleStore{dir, dirindex.NewIndex(dir+".index", 0), debug, info}
 }
 
 func (s *BundleStore) Bundles() (l []bundle.Bundle, err error) {
+	var entries []bundleEntry
+	if ok, _ := s.index.Load(s.dir, &entries); ok {
+		l = make([]bundle.Bundle, len(entries))
+		for i, e := range entries {
+			l[i] = bundle.NewCachedBundle(filepath.Join(s.dir, e.ID), e.Created)
+		}
+		return
+	}
 	fl, e := ioutil.ReadDir(s.dir)
 	l = make([]bundle.Bundle, 0, len(fl))
 	if e != nil && !os.IsNotExist(e) {
@@ -40,6 +55,14 @@ func (s *BundleStore) Bundles() (l []bundle.Bundle, err error) {
 			}
 		}
 	}
+	if err == nil {
+		// Best-effort index update - a failure only costs a rescan next time
+		entries = make([]bundleEntry, len(l))
+		for i, b := range l {
+			entries[i] = bundleEntry{b.ID(), b.Created()}
+		}
+		s.index.Store(s.dir, entries)
+	}
 	return
 }
 
@@ -61,13 +84,16 @@ func (s *BundleStore) CreateBundle(id string, update bool) (b *bundle.LockedBund
 	return bundle.CreateLockedBundle(dir, update)
 }
 
-// Deletes all bundles that have not been used longer than the given TTL.
-func (s *BundleStore) BundleGC(ttl time.Duration, containers bundle.ContainerStore) (r []bundle.Bundle, err error) {
+// Deletes all matching bundles that have not been used longer than the given TTL.
+func (s *BundleStore) BundleGC(ttl time.Duration, containers bundle.ContainerStore, match bundle.BundleMatcher) (r []bundle.Bundle, err error) {
 	s.debug.Printf("Running bundle GC with TTL of %s", ttl)
 	before := time.Now().Add(-ttl)
 	l, err := s.Bundles()
 	r = make([]bundle.Bundle, 0, len(l))
 	for _, b := range l {
+		if match != nil && !match(&b) {
+			continue
+		}
 		gcd, e := gc(b, before, containers)
 		if e != nil {
 			if gcd {
@@ -0,0 +1,47 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/mgoltzsche/ctnr/run"
+	"github.com/spf13/cobra"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach CONTAINERID",
+	Short: "Attaches stdio to a running container",
+	Long: `Attaches the terminal's stdin/stdout to a running container
+through the attach socket held by the container's supervisor process.`,
+	Run: wrapRun(runAttach),
+}
+
+func runAttach(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("CONTAINERID argument required")
+	}
+	containers, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	c, err := containers.Get(args[0])
+	if err != nil {
+		return
+	}
+	cio := run.NewStdContainerIO()
+	cio.Stdin = os.Stdin
+	return c.Attach(cio)
+}
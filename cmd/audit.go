@@ -0,0 +1,66 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"time"
+)
+
+// Entry of the append-only audit log describing who performed which
+// privileged operation when
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Uid       int       `json:"uid"`
+	User      string    `json:"user,omitempty"`
+	Operation string    `json:"operation"`
+	Detail    string    `json:"detail,omitempty"`
+	Args      []string  `json:"args"`
+}
+
+// Appends the given privileged operation to the audit log if one is
+// configured (--audit-log). Audit failures are logged but do not abort
+// the operation itself.
+func audit(operation, detail string) {
+	if flagAuditLog == "" {
+		return
+	}
+	entry := auditEntry{
+		Time:      time.Now(),
+		Uid:       os.Getuid(),
+		Operation: operation,
+		Detail:    detail,
+		Args:      os.Args[1:],
+	}
+	if u, e := user.Current(); e == nil {
+		entry.User = u.Username
+	}
+	b, err := json.Marshal(&entry)
+	if err != nil {
+		loggers.Warn.Println("audit log:", err)
+		return
+	}
+	f, err := os.OpenFile(flagAuditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		loggers.Warn.Println("audit log:", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		loggers.Warn.Println("audit log:", err)
+	}
+}
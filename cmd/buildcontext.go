@@ -0,0 +1,187 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/pkg/errors"
+)
+
+// Returns true when the build context argument refers to a remote location
+// (git repository or http(s) tarball) or '-' for a tar stream on stdin
+// rather than a local directory
+func isRemoteBuildContext(ctx string) bool {
+	return ctx == "-" || isGitBuildContext(ctx) ||
+		strings.HasPrefix(ctx, "http://") || strings.HasPrefix(ctx, "https://")
+}
+
+func isGitBuildContext(ctx string) bool {
+	if strings.HasPrefix(ctx, "git://") || strings.HasPrefix(ctx, "git@") {
+		return true
+	}
+	if strings.HasPrefix(ctx, "http://") || strings.HasPrefix(ctx, "https://") {
+		return strings.HasSuffix(strings.SplitN(ctx, "#", 2)[0], ".git")
+	}
+	return false
+}
+
+// Materializes a remote build context (git repository URL optionally
+// suffixed with #REF[:DIR], http(s) tarball URL or '-' for a tar stream on
+// stdin) within a temp directory below the given base directory.
+// The caller is responsible to remove the returned tmpDir.
+func fetchBuildContext(ctx, tmpBaseDir string) (ctxDir, tmpDir string, err error) {
+	if flagLocalOnly && ctx != "-" {
+		return "", "", errors.Errorf("refusing to fetch build context %q since --local-only mode is enabled", ctx)
+	}
+	if err = os.MkdirAll(tmpBaseDir, 0750); err != nil {
+		return "", "", errors.New(err.Error())
+	}
+	if tmpDir, err = ioutil.TempDir(tmpBaseDir, ".build-context-"); err != nil {
+		return "", "", errors.New(err.Error())
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			err = errors.WithMessage(err, "fetch build context")
+		}
+	}()
+	ctxDir = tmpDir
+	if ctx == "-" {
+		err = extractTarStream(os.Stdin, ctxDir)
+	} else if isGitBuildContext(ctx) {
+		ctxDir, err = fetchGitBuildContext(ctx, tmpDir)
+	} else {
+		var resp *http.Response
+		if resp, err = http.Get(ctx); err != nil {
+			return "", tmpDir, errors.New(err.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return "", tmpDir, errors.Errorf("unexpected response status %q from %s", resp.Status, ctx)
+		}
+		err = extractTarStream(resp.Body, ctxDir)
+	}
+	return
+}
+
+// Clones the git repository the context URL refers to, checking out the
+// ref and resolving the context subdirectory of an optional #REF[:DIR]
+// URL fragment
+func fetchGitBuildContext(ctx, dir string) (ctxDir string, err error) {
+	repo := ctx
+	ref := ""
+	subdir := ""
+	if pos := strings.Index(repo, "#"); pos >= 0 {
+		frag := strings.SplitN(repo[pos+1:], ":", 2)
+		repo = repo[:pos]
+		ref = frag[0]
+		if len(frag) == 2 {
+			subdir = frag[1]
+		}
+	}
+	cloneArgs := []string{"clone", "--depth=1", "--recurse-submodules"}
+	if ref != "" {
+		cloneArgs = append(cloneArgs, "--branch", ref)
+	}
+	cloneArgs = append(cloneArgs, repo, dir)
+	if out, e := exec.Command("git", cloneArgs...).CombinedOutput(); e != nil {
+		return "", errors.Errorf("git clone %s: %s: %s", repo, e, strings.TrimSpace(string(out)))
+	}
+	ctxDir = dir
+	if subdir != "" {
+		ctxDir = filepath.Join(dir, filepath.Clean(string(filepath.Separator)+subdir))
+		if fi, e := os.Stat(ctxDir); e != nil || !fi.IsDir() {
+			return "", errors.Errorf("context directory %q not found in git repository %s", subdir, repo)
+		}
+	}
+	return
+}
+
+// Extracts a (gzip or bzip2 compressed) tar stream into the given directory
+func extractTarStream(r io.Reader, dest string) (err error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(3)
+	if err != nil {
+		return errors.New("read tar stream: " + err.Error())
+	}
+	var tr *tar.Reader
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, e := gzip.NewReader(br)
+		if e != nil {
+			return errors.New(e.Error())
+		}
+		defer gr.Close()
+		tr = tar.NewReader(gr)
+	} else if magic[0] == 'B' && magic[1] == 'Z' && magic[2] == 'h' {
+		tr = tar.NewReader(bzip2.NewReader(br))
+	} else {
+		tr = tar.NewReader(br)
+	}
+	for {
+		hdr, e := tr.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return errors.New("read tar stream: " + e.Error())
+		}
+		if err = extractTarEntry(hdr, tr, dest); err != nil {
+			return errors.Wrapf(err, "extract tar entry %s", hdr.Name)
+		}
+	}
+	return
+}
+
+func extractTarEntry(hdr *tar.Header, r io.Reader, dest string) (err error) {
+	path := filepath.Join(dest, filepath.Clean(string(filepath.Separator)+hdr.Name))
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		err = os.MkdirAll(path, hdr.FileInfo().Mode())
+	case tar.TypeReg, tar.TypeRegA:
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			var f *os.File
+			if f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode()); err == nil {
+				_, err = io.Copy(f, r)
+				err = exterrors.Append(err, f.Close())
+			}
+		}
+	case tar.TypeSymlink:
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = os.Symlink(hdr.Linkname, path)
+		}
+	case tar.TypeLink:
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = os.Link(filepath.Join(dest, filepath.Clean(string(filepath.Separator)+hdr.Linkname)), path)
+		}
+	default:
+		// Ignore other entry types (devices etc.) within a build context
+	}
+	if err != nil {
+		err = errors.New(err.Error())
+	}
+	return
+}
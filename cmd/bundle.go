@@ -18,12 +18,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sort"
 	"syscall"
 	"time"
 
 	humanize "github.com/dustin/go-humanize"
 	"github.com/mgoltzsche/ctnr/bundle"
+	"github.com/mgoltzsche/ctnr/model/oci"
 	"github.com/mgoltzsche/ctnr/run"
 	"github.com/spf13/cobra"
 )
@@ -77,6 +79,8 @@ func init() {
 	flagsBundle.InitContainerFlags(bundleCreateCmd.Flags())
 	flagsBundle.InitRunFlags(bundleRunCmd.Flags())
 	bundleGcCmd.Flags().DurationVarP(&flagBundleTTL, "ttl", "t", defaultBundleTTL, "bundle lifetime before it gets garbage collected")
+	initSelectorFlag(bundleDeleteCmd)
+	initSelectorFlag(bundleGcCmd)
 }
 
 func runBundleList(cmd *cobra.Command, args []string) (err error) {
@@ -87,15 +91,15 @@ func runBundleList(cmd *cobra.Command, args []string) (err error) {
 	sort.Slice(l, func(i, j int) bool {
 		return l[i].Created().Before(l[j].Created())
 	})
-	f := "%-26s  %-71s  %s\n"
-	fmt.Printf(f, "ID", "IMAGE", "CREATED")
+	w := newTableWriter("%-26s  %-71s  %s\n")
+	w.Header("ID", "IMAGE", "CREATED")
 	for _, c := range l {
 		imageId := c.Image()
 		img := "<none>"
 		if imageId != nil {
 			img = imageId.String()
 		}
-		fmt.Printf(f, c.ID(), img, humanize.Time(c.Created()))
+		w.Row(c.ID(), img, humanize.Time(c.Created()))
 	}
 	return
 }
@@ -117,13 +121,18 @@ func runBundleCreate(cmd *cobra.Command, args []string) (err error) {
 }
 
 func runBundleDelete(cmd *cobra.Command, args []string) (err error) {
-	if len(args) == 0 {
-		return usageError("No bundle specified to remove")
+	if len(args) == 0 && len(flagSelector) == 0 {
+		return usageError("No bundle or --selector specified to remove")
 	}
 	cm, err := newContainerManager()
 	if err != nil {
 		return
 	}
+	ids, err := selectedBundleIds(flagSelector)
+	if err != nil {
+		return
+	}
+	args = append(args, ids...)
 	failedIds := []string{}
 	for _, id := range args {
 		if err = deleteBundle(id, cm); err != nil {
@@ -169,7 +178,11 @@ func runBundleGc(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	gcd, err := store.BundleGC(flagBundleTTL, cm)
+	match, err := bundleSelector(flagSelector)
+	if err != nil {
+		return
+	}
+	gcd, err := store.BundleGC(flagBundleTTL, cm, match)
 	for _, b := range gcd {
 		os.Stdout.WriteString(b.ID() + "\n")
 	}
@@ -185,7 +198,64 @@ func runBundleRun(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	c, err := containerFromBundle(&b)
+
+	if flagsBundle.detach {
+		var dir string
+		if dir, err = filepath.Abs(b.Dir()); err != nil {
+			return
+		}
+		if err = startDetached(dir); err != nil {
+			return
+		}
+		fmt.Println(b.ID())
+		return
+	}
+
+	policy := ""
+	if ann, e := b.Annotations(); e == nil {
+		policy = ann[oci.ANNOTATION_BUNDLE_RESTART_POLICY]
+	}
+
+	// Supervise the container, restarting it with exponential backoff
+	// according to its restart policy
+	restarts := 0
+	backoff := time.Second
+	var stopped bool
+	for {
+		started := time.Now()
+		err = runBundleContainer(&b, &stopped)
+		restart := false
+		switch policy {
+		case "always", "unless-stopped":
+			restart = !stopped
+		case "on-failure":
+			restart = !stopped && err != nil
+		}
+		if !restart {
+			break
+		}
+		if time.Since(started) > backoff*2 {
+			// Reset the backoff after a stable run
+			backoff = time.Second
+		}
+		restarts++
+		loggers.Warn.WithField("id", b.ID()).WithField("restarts", restarts).Printf("restarting container in %s", backoff)
+		if e := writeRestartCount(b.ID(), restarts); e != nil {
+			loggers.Debug.Println(e)
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+	if restarts > 0 {
+		os.Remove(restartCountFile(b.ID()))
+	}
+	return
+}
+
+func runBundleContainer(b *bundle.Bundle, stopped *bool) (err error) {
+	c, err := containerFromBundle(b)
 	if err != nil {
 		return
 	}
@@ -208,9 +278,15 @@ func runBundleRun(cmd *cobra.Command, args []string) (err error) {
 	// TODO: reuse from central location with occurence in run package
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
+	defer func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}()
 	go func() {
-		<-sigs
-		c.Stop()
+		if _, ok := <-sigs; ok {
+			*stopped = true
+			c.Stop()
+		}
 	}()
 
 	return c.Wait()
@@ -234,10 +310,15 @@ func containerFromBundle(b *bundle.Bundle) (c run.Container, err error) {
 	if flagsBundle.stdin {
 		ioe.Stdin = os.Stdin
 	}
+	policy := ""
+	if spec, e := lockedBundle.Spec(); e == nil && spec.Annotations != nil {
+		policy = spec.Annotations[oci.ANNOTATION_BUNDLE_RESTART_POLICY]
+	}
 	return containers.NewContainer(&run.ContainerConfig{
 		Id:             "",
 		Bundle:         lockedBundle,
 		Io:             ioe,
+		RestartPolicy:  policy,
 		NoPivotRoot:    flagsBundle.noPivot,
 		NoNewKeyring:   flagsBundle.noNewKeyring,
 		DestroyOnClose: true,
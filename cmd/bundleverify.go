@@ -0,0 +1,200 @@
+// Copyright © 2017 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/mgoltzsche/ctnr/bundle"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleVerifyCmd = &cobra.Command{
+		Use:   "verify [flags] BUNDLEID|BUNDLEDIR",
+		Short: "Verifies a bundle's rootfs against its parent image",
+		Long: `Compares a bundle's rootfs with its parent image's file system spec
+and reports modified (M), added (A) and deleted (D) files.
+Optionally the rootfs is restored from the image.`,
+		Run: wrapRun(runBundleVerify),
+	}
+	flagVerifyRestore bool
+)
+
+func init() {
+	bundleVerifyCmd.Flags().BoolVar(&flagVerifyRestore, "restore", false, "restores the rootfs from the parent image if it deviates")
+	bundleCmd.AddCommand(bundleVerifyCmd)
+}
+
+func runBundleVerify(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one argument required")
+	}
+	b, err := bundleByIdOrDir(args[0])
+	if err != nil {
+		return
+	}
+	lockedBundle, err := b.Lock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, lockedBundle.Close())
+	}()
+	spec, err := lockedBundle.Spec()
+	if err != nil {
+		return
+	}
+	if spec.Root == nil {
+		return errors.Errorf("bundle %q has no root path", b.ID())
+	}
+	imgId := lockedBundle.Image()
+	if imgId == nil {
+		return errors.Errorf("bundle %q has no parent image to verify against", b.ID())
+	}
+	rootfsDir := filepath.Join(b.Dir(), spec.Root.Path)
+	drift, err := bundleImageDrift(rootfsDir, *imgId)
+	if err != nil {
+		return
+	}
+	if len(drift) == 0 {
+		loggers.Info.Printf("bundle %s rootfs matches image %s", b.ID(), imgId)
+		return
+	}
+	for _, line := range drift {
+		fmt.Println(line)
+	}
+	if flagVerifyRestore {
+		istore, e := openImageStore()
+		if e != nil {
+			return e
+		}
+		if err = bundle.DeleteDirSafely(rootfsDir); err != nil {
+			return
+		}
+		return errors.WithMessage(istore.UnpackImageLayers(*imgId, rootfsDir), "restore rootfs")
+	}
+	return errors.Errorf("bundle %s rootfs deviates from image %s in %d paths", b.ID(), imgId, len(drift))
+}
+
+// Compares the given rootfs directory with the image's file system spec
+// and returns the sorted drift as "M|A|D path" lines
+func bundleImageDrift(rootfsDir string, imgId digest.Digest) (drift []string, err error) {
+	istore, err := openImageStore()
+	if err != nil {
+		return
+	}
+	imageFs, err := istore.FS(imgId)
+	if err != nil {
+		return
+	}
+	if flagRootless {
+		// Devices appear as files in a rootless bundle
+		imageFs.MockDevices()
+	}
+	rootfs, err := tree.FromDir(rootfsDir, flagRootless)
+	if err != nil {
+		return
+	}
+	driftFs, err := imageFs.Diff(rootfs)
+	if err != nil {
+		return
+	}
+	w := &driftWriter{fs.HashingNilWriter(), imageFs, nil}
+	if !driftFs.Empty() {
+		if err = driftFs.Write(w); err != nil {
+			return
+		}
+	}
+	sort.Strings(w.drift)
+	return w.drift, nil
+}
+
+// fs.Writer that records each written node as rootfs drift.
+// Directories that exist in the image are skipped since the diff tree
+// contains them as plain containers of changed child nodes.
+type driftWriter struct {
+	fs.Writer
+	imageFs fs.FsNode
+	drift   []string
+}
+
+func (w *driftWriter) record(change, path string) {
+	w.drift = append(w.drift, change+" "+path)
+}
+
+func (w *driftWriter) classify(path string) {
+	if _, err := w.imageFs.Node(path); err == nil {
+		w.record("M", path)
+	} else {
+		w.record("A", path)
+	}
+}
+
+func (w *driftWriter) Lazy(path, name string, src fs.LazySource, written map[fs.Source]string) error {
+	w.classify(path)
+	return nil
+}
+
+func (w *driftWriter) File(path string, src fs.FileSource) (fs.Source, error) {
+	w.classify(path)
+	return src, nil
+}
+
+func (w *driftWriter) Link(path, target string) error {
+	w.classify(path)
+	return nil
+}
+
+func (w *driftWriter) Symlink(path string, attrs fs.FileAttrs) error {
+	w.classify(path)
+	return nil
+}
+
+func (w *driftWriter) Fifo(path string, attrs fs.DeviceAttrs) error {
+	w.classify(path)
+	return nil
+}
+
+func (w *driftWriter) Device(path string, attrs fs.DeviceAttrs) error {
+	w.classify(path)
+	return nil
+}
+
+func (w *driftWriter) Dir(path, base string, attrs fs.FileAttrs) error {
+	if _, err := w.imageFs.Node(path); err != nil {
+		w.record("A", path)
+	}
+	return nil
+}
+
+func (w *driftWriter) Mkdir(path string) error {
+	if _, err := w.imageFs.Node(path); err != nil {
+		w.record("A", path)
+	}
+	return nil
+}
+
+func (w *driftWriter) Remove(path string) error {
+	w.record("D", path)
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkpointCmd = &cobra.Command{
+		Use:   "checkpoint [flags] CONTAINERID",
+		Short: "Checkpoints a running container using CRIU",
+		Long: `Checkpoints a running container using CRIU.
+The checkpoint images are stored within the container's bundle directory
+and can be booted again using the restore command.`,
+		Run: wrapRun(runCheckpoint),
+	}
+	restoreCmd = &cobra.Command{
+		Use:   "restore [flags] BUNDLEID",
+		Short: "Restores a container from its bundle's last checkpoint",
+		Long:  `Restores a container from its bundle's last checkpoint.`,
+		Run:   wrapRun(runRestore),
+	}
+	flagLeaveRunning bool
+)
+
+func init() {
+	checkpointCmd.Flags().BoolVar(&flagLeaveRunning, "leave-running", false, "leaves the container running after the checkpoint")
+	flagsBundle.InitRunFlags(restoreCmd.Flags())
+}
+
+func runCheckpoint(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one CONTAINERID argument expected")
+	}
+	containers, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	c, err := containers.Get(args[0])
+	if err != nil {
+		return
+	}
+	return c.Checkpoint(flagLeaveRunning)
+}
+
+func runRestore(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one BUNDLEID argument expected")
+	}
+	b, err := bundleByIdOrDir(args[0])
+	if err != nil {
+		return
+	}
+	c, err := containerFromBundle(&b)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := c.Close(); e != nil {
+			if err == nil {
+				err = e
+			} else {
+				loggers.Error.Println(e)
+			}
+		}
+	}()
+
+	if err = c.Restore(); err != nil {
+		return
+	}
+
+	// Handle signals
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
+	defer func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}()
+	go func() {
+		if _, ok := <-sigs; ok {
+			c.Stop()
+		}
+	}()
+
+	return c.Wait()
+}
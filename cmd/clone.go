@@ -0,0 +1,140 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mgoltzsche/ctnr/bundle"
+	"github.com/mgoltzsche/ctnr/image"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
+	fswriter "github.com/mgoltzsche/ctnr/pkg/fs/writer"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cloneCmd = &cobra.Command{
+		Use:   "clone [flags] BUNDLEID",
+		Short: "Clones an existing bundle",
+		Long: `Creates a new bundle from an existing bundle's spec and rootfs
+to quickly spin up variations of a configured container.
+With --reset the writable rootfs state is reset to the bundle's image.`,
+		Run: wrapRun(runClone),
+	}
+	flagCloneName  string
+	flagCloneReset bool
+)
+
+func init() {
+	f := cloneCmd.Flags()
+	f.StringVar(&flagCloneName, "name", "", "assigns the given ID to the new bundle (default generated)")
+	f.BoolVar(&flagCloneReset, "reset", false, "resets the rootfs to the bundle's image instead of copying its state")
+}
+
+func runClone(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one BUNDLEID argument expected")
+	}
+	b, err := store.Bundle(args[0])
+	if err != nil {
+		return
+	}
+	lb, err := b.Lock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, lb.Close())
+	}()
+	spec, err := lb.Spec()
+	if err != nil {
+		return
+	}
+	if spec.Root == nil {
+		return errors.Errorf("bundle %q has no root path", args[0])
+	}
+	clone, err := store.CreateBundle(flagCloneName, false)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			err = exterrors.Append(err, clone.Delete())
+		} else {
+			err = clone.Close()
+		}
+	}()
+	if err = cloneRootfs(lb, clone); err != nil {
+		return
+	}
+	if err = clone.SetParentImageId(lb.Image()); err != nil {
+		return
+	}
+	// Derive the clone's spec with its own ID and hostname
+	cloneSpec := *spec
+	cloneSpec.Annotations = map[string]string{}
+	for k, v := range spec.Annotations {
+		cloneSpec.Annotations[k] = v
+	}
+	cloneSpec.Annotations[bundle.ANNOTATION_BUNDLE_ID] = clone.ID()
+	if cloneSpec.Hostname != "" {
+		cloneSpec.Hostname = clone.ID()
+	}
+	if err = clone.SetSpec(&cloneSpec); err != nil {
+		return
+	}
+	os.Stdout.WriteString(clone.ID() + "\n")
+	return
+}
+
+// Populates the clone's rootfs by copying the source bundle's rootfs or,
+// when --reset is provided, by unpacking the source bundle's image.
+func cloneRootfs(src *bundle.LockedBundle, clone *bundle.LockedBundle) (err error) {
+	if flagCloneReset {
+		imgId := src.Image()
+		if imgId == nil {
+			return errors.New("clone: cannot reset rootfs of a bundle without image")
+		}
+		istore, e := openImageStore()
+		if e != nil {
+			return e
+		}
+		img, e := istore.Image(*imgId)
+		if e != nil {
+			return e
+		}
+		return clone.UpdateRootfs(image.NewUnpackableImage(&img, istore))
+	}
+	spec, err := src.Spec()
+	if err != nil {
+		return
+	}
+	srcRootfs := filepath.Join(src.Dir(), spec.Root.Path)
+	destRootfs := filepath.Join(clone.Dir(), "rootfs")
+	if err = os.MkdirAll(destRootfs, 0755); err != nil {
+		return errors.New(err.Error())
+	}
+	fsBuilder := tree.NewFsBuilder(tree.NewFS(), fs.NewFSOptions(flagRootless))
+	fsBuilder.CopyAll(srcRootfs, []string{"."}, "/", nil)
+	dirWriter := fswriter.NewDirWriter(destRootfs, fs.NewFSOptions(flagRootless), loggers.Warn)
+	if err = fsBuilder.Write(dirWriter); err != nil {
+		return
+	}
+	return dirWriter.Close()
+}
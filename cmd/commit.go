@@ -39,6 +39,7 @@ var (
 func init() {
 	commitCmd.Flags().StringVarP(&flagAuthor, "author", "a", "", "Sets the new layer's author")
 	commitCmd.Flags().StringVarP(&flagComment, "comment", "c", "", "Sets the new layer's comment")
+	commitCmd.Flags().BoolVar(&flagReproducible, "reproducible", false, "Normalizes layer timestamps and the image creation time (using SOURCE_DATE_EPOCH when set) so that identical inputs yield identical image digests")
 }
 
 func runCommit(cmd *cobra.Command, args []string) (err error) {
@@ -59,6 +60,11 @@ func runCommit(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
+	if flagReproducible {
+		if err = setBuildTimestamp(lockedStore); err != nil {
+			return
+		}
+	}
 	spec, err := lockedBundle.Spec()
 	if err != nil {
 		return
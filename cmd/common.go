@@ -17,10 +17,17 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mgoltzsche/ctnr/bundle"
 	"github.com/mgoltzsche/ctnr/bundle/builder"
@@ -28,11 +35,16 @@ import (
 	"github.com/mgoltzsche/ctnr/model"
 	"github.com/mgoltzsche/ctnr/model/oci"
 	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/fs"
 	"github.com/mgoltzsche/ctnr/run"
 	"github.com/mgoltzsche/ctnr/run/factory"
+	digest "github.com/opencontainers/go-digest"
+	rspecs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/sys/unix"
 )
 
 func wrapRun(cf func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) {
@@ -161,6 +173,62 @@ func exitError(exitCode int, frmt string, values ...interface{}) {
 	os.Exit(exitCode)
 }
 
+// Selector shared by the batch-capable commands (only one of them runs per process)
+var flagSelector []string
+
+func initSelectorFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&flagSelector, "selector", nil, "filters by container label (format: LABEL=VALUE)")
+}
+
+// Builds a bundle matcher from LABEL=VALUE selector entries.
+// All entries must match a bundle's spec annotations.
+// Returns nil when no selector entries are provided.
+func bundleSelector(selector []string) (m bundle.BundleMatcher, err error) {
+	if len(selector) == 0 {
+		return
+	}
+	labels := map[string]string{}
+	for _, entry := range selector {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, usageError("invalid selector entry " + strconv.Quote(entry) + ": expected format: LABEL=VALUE")
+		}
+		labels[kv[0]] = kv[1]
+	}
+	m = func(b *bundle.Bundle) bool {
+		ann, e := b.Annotations()
+		if e != nil {
+			loggers.Debug.WithField("id", b.ID()).Println("selector:", e)
+			return false
+		}
+		for k, v := range labels {
+			if ann[k] != v {
+				return false
+			}
+		}
+		return true
+	}
+	return
+}
+
+// Returns the IDs of all bundles matching the given selector entries.
+func selectedBundleIds(selector []string) (ids []string, err error) {
+	match, err := bundleSelector(selector)
+	if err != nil || match == nil {
+		return
+	}
+	l, err := store.Bundles()
+	if err != nil {
+		return
+	}
+	for _, b := range l {
+		if match(&b) {
+			ids = append(ids, b.ID())
+		}
+	}
+	return
+}
+
 func openImageStore() (image.ImageStoreRW, error) {
 	if lockedImageStore == nil {
 		s, err := store.OpenLockedImageStore()
@@ -169,9 +237,43 @@ func openImageStore() (image.ImageStoreRW, error) {
 		}
 		lockedImageStore = s
 	}
+	if flagLocalOnly {
+		return localOnlyImageStore{lockedImageStore}, nil
+	}
 	return lockedImageStore, nil
 }
 
+// Enforces strict offline operation (--local-only): image store operations
+// that would access a remote registry fail with a clear error while local
+// transports (e.g. oci, docker-archive) keep working.
+type localOnlyImageStore struct {
+	image.ImageStoreRW
+}
+
+func (s localOnlyImageStore) ImportImage(name string) (img image.Image, err error) {
+	if s.isRemote(name) {
+		return img, errors.Errorf("refusing to pull image %q since --local-only mode is enabled", name)
+	}
+	return s.ImageStoreRW.ImportImage(name)
+}
+
+func (s localOnlyImageStore) PushImage(nameRef string, dest string, signBy string) error {
+	if s.isRemote(dest) {
+		return errors.Errorf("refusing to push image to %q since --local-only mode is enabled", dest)
+	}
+	return s.ImageStoreRW.PushImage(nameRef, dest, signBy)
+}
+
+// A source/destination is remote when it uses the docker registry transport -
+// explicitly or by lacking any supported transport prefix
+func (s localOnlyImageStore) isRemote(nameRef string) bool {
+	transport := ""
+	if pos := strings.Index(nameRef, ":"); pos > 0 {
+		transport = nameRef[:pos]
+	}
+	return transport == "docker" || !s.SupportsTransport(transport)
+}
+
 func closeLockedImageStore() {
 	if lockedImageStore != nil {
 		lockedImageStore.Close()
@@ -184,7 +286,21 @@ func newContainerManager() (run.ContainerManager, error) {
 
 func resourceResolver(baseDir string, volumes map[string]model.Volume) model.ResourceResolver {
 	paths := model.NewPathResolver(baseDir)
-	return model.NewResourceResolver(paths, volumes)
+	return &storeVolumeResolver{model.NewResourceResolver(paths, volumes)}
+}
+
+// Resolves named volume mounts that are not declared within the model
+// against the store's volume directories, creating volumes on demand.
+type storeVolumeResolver struct {
+	model.ResourceResolver
+}
+
+func (r *storeVolumeResolver) ResolveMountSource(m model.VolumeMount) (src string, err error) {
+	src, err = r.ResourceResolver.ResolveMountSource(m)
+	if err != nil && m.Type == model.MOUNT_TYPE_VOLUME && m.Source != "" {
+		src, err = store.VolumeDir(m.Source)
+	}
+	return
 }
 
 func runServices(services []model.Service, res model.ResourceResolver) (err error) {
@@ -198,22 +314,144 @@ func runServices(services []model.Service, res model.ResourceResolver) (err erro
 		err = exterrors.Append(err, containers.Close())
 	}()
 
+	replicas := make([]model.Service, 0, len(services))
+	started := make([]run.Container, 0, len(services))
+	serviceByContainer := map[string]model.Service{}
+	serviceNameByContainer := map[string]string{}
 	for _, s := range services {
-		var c run.Container
-		loggers.Debug.Println(s.JSON())
-		if c, err = createContainer(&s, res, manager, true); err != nil {
-			return
+		for _, replica := range serviceReplicas(&s) {
+			var c run.Container
+			loggers.Debug.Println(replica.JSON())
+			if c, err = createContainer(&replica, res, manager, true); err != nil {
+				return
+			}
+			containers.Add(c)
+			started = append(started, c)
+			replicas = append(replicas, replica)
+			serviceByContainer[c.ID()] = replica
+			serviceNameByContainer[c.ID()] = s.Name
 		}
-		containers.Add(c)
+	}
+
+	// Block dependent container starts until their health-gated
+	// dependencies (depends_on condition service_healthy) passed their
+	// healthcheck. The services are expected in dependency order.
+	if healthGated := healthGatedServices(services); len(healthGated) > 0 {
+		containers.OnStarted(func(c run.Container) error {
+			s := serviceByContainer[c.ID()]
+			if !healthGated[serviceNameByContainer[c.ID()]] {
+				return nil
+			}
+			if s.HealthCheck == nil {
+				return errors.Errorf("service %s must become healthy before its dependents start but declares no healthcheck", s.Name)
+			}
+			loggers.Debug.Printf("awaiting service %s to become healthy", s.Name)
+			return awaitReplicaHealthy(c.ID(), s.HealthCheck, manager)
+		})
 	}
 
 	closeLockedImageStore()
+	for i := range replicas {
+		if err = awaitHostDependencies(&replicas[i]); err != nil {
+			return
+		}
+	}
 	containers.Start()
+	for i, s := range replicas {
+		if len(s.PostStart) > 0 {
+			if err = runExecHooks(started[i], s.PostStart, "post-start"); err != nil {
+				return
+			}
+		}
+	}
 	containers.Wait()
 	return
 }
 
+// Expands a service into its replicas (deploy.replicas, default 1) with
+// indexed names, bundles and hostnames. The network configuration is
+// shared between the replicas.
+func serviceReplicas(s *model.Service) (r []model.Service) {
+	replicas := 1
+	if s.Deploy != nil && s.Deploy.Replicas != nil {
+		replicas = int(*s.Deploy.Replicas)
+	}
+	if replicas <= 1 {
+		return []model.Service{*s}
+	}
+	r = make([]model.Service, replicas)
+	for i := 0; i < replicas; i++ {
+		replica := *s
+		replica.Name = fmt.Sprintf("%s-%d", s.Name, i+1)
+		if replica.Bundle == "" {
+			replica.Bundle = replica.Name
+		}
+		// An explicit hostname is indexed as well to keep replica hostnames
+		// distinct (an unset hostname defaults to the replica name)
+		if replica.Hostname != "" {
+			replica.Hostname = fmt.Sprintf("%s-%d", s.Hostname, i+1)
+		}
+		r[i] = replica
+	}
+	return
+}
+
+// Returns the names of services that must pass their healthcheck before
+// their dependents are started
+func healthGatedServices(services []model.Service) map[string]bool {
+	r := map[string]bool{}
+	for _, s := range services {
+		for _, dep := range s.DependsOn {
+			if dep.Condition == model.DEPENDENCY_CONDITION_HEALTHY {
+				r[dep.Service] = true
+			}
+		}
+	}
+	return r
+}
+
+// Blocks until all of the service's host dependencies (TCP addresses or
+// unix socket paths) accept connections or the timeout elapsed
+func awaitHostDependencies(s *model.Service) (err error) {
+	if len(s.WaitFor) == 0 {
+		return
+	}
+	timeout := time.Duration(10 * time.Second)
+	if s.WaitForTimeout != nil {
+		timeout = *s.WaitForTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for _, dep := range s.WaitFor {
+		network := "tcp"
+		if strings.ContainsRune(dep, '/') {
+			network = "unix"
+		}
+		loggers.Debug.Printf("service %s: awaiting host dependency %s", s.Name, dep)
+		for {
+			remaining := deadline.Sub(time.Now())
+			if remaining <= 0 {
+				return errors.Errorf("service %s: host dependency %s not reachable after %s", s.Name, dep, timeout)
+			}
+			conn, e := net.DialTimeout(network, dep, remaining)
+			if e == nil {
+				conn.Close()
+				break
+			}
+			time.Sleep(time.Millisecond * 250)
+		}
+	}
+	return
+}
+
 func createContainer(model *model.Service, res model.ResourceResolver, manager run.ContainerManager, destroyOnClose bool) (c run.Container, err error) {
+	if model.Privileged {
+		audit("privileged-run", "service "+model.Name+" image "+model.Image)
+	}
+	if model.NetworkMode != "" {
+		if err = resolveSharedNamespaces(model, manager); err != nil {
+			return
+		}
+	}
 	var bundle *bundle.LockedBundle
 	if bundle, err = createRuntimeBundle(model, res); err != nil {
 		return
@@ -222,11 +460,21 @@ func createContainer(model *model.Service, res model.ResourceResolver, manager r
 		err = exterrors.Append(err, bundle.Close())
 	}()
 
+	if spec, e := bundle.Spec(); e == nil {
+		warnMountsOnUnsupportedFs(spec)
+	}
+
 	ioe := run.NewStdContainerIO()
 	if model.StdinOpen {
 		ioe.Stdin = os.Stdin
 	}
 
+	if model.IONice != nil {
+		if err = setIONice(*model.IONice); err != nil {
+			return
+		}
+	}
+
 	return manager.NewContainer(&run.ContainerConfig{
 		Id:             "",
 		Bundle:         bundle,
@@ -237,6 +485,170 @@ func createContainer(model *model.Service, res model.ResourceResolver, manager r
 	})
 }
 
+// Ensures that the image is built for the host platform so that running
+// it does not fail with a confusing exec format error. A foreign
+// architecture is tolerated with a warning when a matching binfmt_misc
+// emulator is registered since the kernel can then run its binaries.
+func validateImagePlatform(img *image.Image) (err error) {
+	if img.Config.OS != runtime.GOOS {
+		return errors.Errorf("image %s is built for OS %s while the host runs %s", img.ID(), img.Config.OS, runtime.GOOS)
+	}
+	arch := img.Config.Architecture
+	if arch == "" || arch == runtime.GOARCH {
+		return
+	}
+	if binfmtEmulationRegistered(arch) {
+		loggers.Warn.Printf("image %s is built for architecture %s while the host is %s - relying on the registered binfmt emulation", img.ID(), arch, runtime.GOARCH)
+		return
+	}
+	return errors.Errorf("image %s is built for architecture %s while the host is %s and no binfmt emulation is registered for it", img.ID(), arch, runtime.GOARCH)
+}
+
+// Returns true when a binfmt_misc interpreter is registered whose name
+// matches the given OCI architecture, e.g. qemu-aarch64 for arm64
+func binfmtEmulationRegistered(arch string) bool {
+	// Map OCI architecture names to their kernel/qemu counterparts
+	aliases := map[string][]string{
+		"amd64":    {"x86_64"},
+		"386":      {"i386", "i486"},
+		"arm64":    {"aarch64"},
+		"ppc64le":  {"ppc64le"},
+		"mips64le": {"mips64el"},
+	}
+	names := append([]string{arch}, aliases[arch]...)
+	files, err := ioutil.ReadDir("/proc/sys/fs/binfmt_misc")
+	if err != nil {
+		return false
+	}
+	for _, f := range files {
+		name := f.Name()
+		if name == "register" || name == "status" {
+			continue
+		}
+		for _, n := range names {
+			if strings.Contains(name, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Path the ctnr binary is bind-mounted to within a pod's infra container
+const podInfraBinPath = "/dev/.ctnr"
+
+// Returns the ID of the named pod's infra container
+func podInfraContainerId(pod string) string {
+	return "pod-" + pod
+}
+
+// Resolves the service's network_mode reference (container:ID, service:NAME
+// or pod:NAME) into the pid of the running container whose network, IPC and
+// UTS namespaces the service joins. A pod's infra container is created and
+// started on demand.
+func resolveSharedNamespaces(service *model.Service, manager run.ContainerManager) (err error) {
+	defer exterrors.Wrapdf(&err, "resolve network_mode %q", service.NetworkMode)
+	s := strings.SplitN(service.NetworkMode, ":", 2)
+	if len(s) != 2 || s[1] == "" {
+		return usageError("expected container:ID, service:NAME or pod:NAME")
+	}
+	id := s[1]
+	switch s[0] {
+	case "container":
+	case "service":
+		if id, err = findServiceContainer(id, manager); err != nil {
+			return
+		}
+	case "pod":
+		id = podInfraContainerId(id)
+		if err = ensurePodInfraContainer(id, s[1], manager); err != nil {
+			return
+		}
+	default:
+		return usageError("expected container:ID, service:NAME or pod:NAME")
+	}
+	pid, err := manager.Pid(id)
+	if err != nil {
+		return
+	}
+	service.SharedNamespacesPid = pid
+	return
+}
+
+// Returns the ID of the running container that belongs to the named service.
+// Deterministic service bundles are matched by their name prefix.
+func findServiceContainer(name string, manager run.ContainerManager) (id string, err error) {
+	if exist, e := manager.Exist(name); e != nil || exist {
+		return name, e
+	}
+	l, err := manager.List()
+	if err != nil {
+		return
+	}
+	for _, c := range l {
+		if strings.HasPrefix(c.ID, name+"-") {
+			return c.ID, nil
+		}
+	}
+	return "", errors.Errorf("no running container found for service %s", name)
+}
+
+// Ensures that the pod's infra container is running. It is an imageless
+// container running a pause process (a re-execution of this binary) that
+// holds the pod's shared network, IPC and UTS namespaces and has the pod's
+// network configured once for all of its members.
+func ensurePodInfraContainer(id, podName string, manager run.ContainerManager) (err error) {
+	defer exterrors.Wrapdf(&err, "pod infra container %s", id)
+	if exist, e := manager.Exist(id); e != nil || exist {
+		return e
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	infra := model.NewService(id)
+	infra.Bundle = id
+	infra.Hostname = podName
+	infra.Entrypoint = []string{podInfraBinPath, "infra"}
+	infra.Volumes = []model.VolumeMount{{
+		Type:    model.MOUNT_TYPE_BIND,
+		Source:  self,
+		Target:  podInfraBinPath,
+		Options: []string{"ro", "nosuid", "nodev"},
+	}}
+	b, err := store.CreateBundle(id, false)
+	if err != nil {
+		return
+	}
+	bb := builder.Builder(b.ID())
+	if err = oci.ToSpec(&infra, resourceResolver("/", nil), flagRootless, filepath.Join(flagStateDir, "networks"), flagPRootPath, bb); err == nil {
+		err = bb.Build(b)
+	}
+	if err != nil {
+		err = exterrors.Append(err, b.Delete())
+		return
+	}
+	// Release the bundle lock before the supervisor re-acquires it
+	if err = b.Close(); err != nil {
+		return
+	}
+	if err = startDetached(id); err != nil {
+		return
+	}
+	// Await the container state since the supervisor creates it asynchronously
+	for i := 0; i < 50; i++ {
+		if exist, e := manager.Exist(id); e != nil {
+			return e
+		} else if exist {
+			if _, e := manager.Pid(id); e == nil {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	return errors.New("timed out waiting for the pod's infra container to start")
+}
+
 func createRuntimeBundle(service *model.Service, res model.ResourceResolver) (b *bundle.LockedBundle, err error) {
 	if service.Image == "" {
 		return nil, errors.Errorf("service %q has no image", service.Name)
@@ -247,18 +659,31 @@ func createRuntimeBundle(service *model.Service, res model.ResourceResolver) (b
 		return
 	}
 
+	if len(service.EnvFrom) > 0 {
+		if err = copyImageEnv(service, istore); err != nil {
+			return
+		}
+	}
+
 	bundleId := service.Bundle
 	bundleDir := ""
 	if isFile(bundleId) {
 		bundleDir = bundleId
 		bundleId = ""
 	}
+	update := service.BundleUpdate
+	if bundleId == "" && bundleDir == "" && service.DeterministicId {
+		// Reuse the bundle of an equally configured container so that
+		// re-invocations do not accumulate duplicates
+		bundleId = deterministicBundleId(service)
+		update = true
+	}
 
 	// Create bundle
 	if bundleDir != "" {
-		b, err = bundle.CreateLockedBundle(bundleDir, service.BundleUpdate)
+		b, err = bundle.CreateLockedBundle(bundleDir, update)
 	} else {
-		b, err = store.CreateBundle(bundleId, service.BundleUpdate)
+		b, err = store.CreateBundle(bundleId, update)
 	}
 	if err != nil {
 		return
@@ -270,13 +695,32 @@ func createRuntimeBundle(service *model.Service, res model.ResourceResolver) (b
 	}()
 
 	// Apply image
+	specCache := builder.NewSpecCache(filepath.Join(flagStoreDir, "spec-cache"), loggers.Warn)
 	builder := builder.Builder(b.ID())
+	builder.SetRootfsOverlay(service.RootfsOverlay)
+	builder.SetRootfsClone(service.RootfsClone)
+	builder.SetRootfsSquashfs(service.RootfsSquashfs)
+	wrapper := ""
+	if globalEntrypointWrapper != "" && !service.NoEntrypointWrapper {
+		wrapper = globalEntrypointWrapper
+		builder.SetEntrypointWrapper(wrapper)
+	}
 	if service.Image != "" {
 		var img image.Image
-		if img, err = image.GetImage(istore, service.Image); err != nil {
+		if img, err = image.GetImagePulled(istore, service.Image, image.PullPolicy(service.Pull)); err != nil {
+			return b, err
+		}
+		if err = validateImagePlatform(&img); err != nil {
 			return b, err
 		}
 		builder.SetImage(image.NewUnpackableImage(&img, istore))
+		// Record the resolved image digest for reproducibility
+		builder.AddAnnotation(oci.ANNOTATION_BUNDLE_IMAGE_NAME, service.Image)
+		builder.AddAnnotation(oci.ANNOTATION_BUNDLE_IMAGE_DIGEST, img.ID().String())
+		// Reuse a previously generated spec for the same image and options
+		// to skip user resolution and seccomp profile generation
+		opts := service.JSON() + "\nrootless=" + strconv.FormatBool(flagRootless) + "\nproot=" + flagPRootPath + "\nstate=" + flagStateDir + "\nwrapper=" + wrapper + "\nnspid=" + strconv.Itoa(service.SharedNamespacesPid)
+		builder.SetSpecCache(specCache, specCache.Key(img.ID(), opts))
 	}
 
 	// Apply config.json
@@ -288,6 +732,142 @@ func createRuntimeBundle(service *model.Service, res model.ResourceResolver) (b
 	return b, builder.Build(b)
 }
 
+// Derives a stable bundle ID from the service name and its normalized
+// options so that equally configured containers map to the same bundle
+func deterministicBundleId(service *model.Service) (id string) {
+	id = digest.SHA256.FromString(service.Name + "\n" + service.JSON()).Hex()[:13]
+	if service.Name != "" {
+		id = service.Name + "-" + id
+	}
+	return
+}
+
+// Copies the environment variables of the service's env-from images into
+// the service's environment. Explicitly set variables take precedence.
+func copyImageEnv(service *model.Service, istore image.ImageStoreRW) (err error) {
+	for _, imgRef := range service.EnvFrom {
+		img, err := image.GetImage(istore, imgRef)
+		if err != nil {
+			return errors.Wrap(err, "env-from")
+		}
+		if service.Environment == nil {
+			service.Environment = map[string]string{}
+		}
+		for _, kv := range img.Config.Config.Env {
+			s := strings.SplitN(kv, "=", 2)
+			v := ""
+			if len(s) == 2 {
+				v = s[1]
+			}
+			if _, ok := service.Environment[s[0]]; !ok {
+				service.Environment[s[0]] = v
+			}
+		}
+	}
+	return
+}
+
+// Starts a supervisor process that runs the given bundle detached from the
+// current terminal and returns immediately. The supervisor is a re-execution
+// of this binary which maintains the container state within the state dir so
+// that the list, kill and logs commands keep working against the detached
+// container.
+func startDetached(bundleIdOrDir string) (err error) {
+	self, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "detach")
+	}
+	// Preserve explicitly set global options
+	args := []string{}
+	RootCmd.PersistentFlags().Visit(func(f *pflag.Flag) {
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	args = append(args, "bundle", "run")
+	if flagsBundle.noPivot {
+		args = append(args, "--no-pivot")
+	}
+	if flagsBundle.noNewKeyring {
+		args = append(args, "--no-new-keyring")
+	}
+	args = append(args, bundleIdOrDir)
+	c := exec.Command(self, args...)
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err = c.Start(); err != nil {
+		return errors.Wrap(err, "detach")
+	}
+	// Don't wait for the supervisor - it outlives this process
+	return errors.Wrap(c.Process.Release(), "detach")
+}
+
+// Warns about bind mount sources residing on file systems without user
+// xattr support since a rootless container cannot preserve file ownership
+// changes on them. Each source directory's file system is probed only once.
+func warnMountsOnUnsupportedFs(spec *rspecs.Spec) {
+	if !flagRootless || spec == nil {
+		return
+	}
+	probed := map[string]bool{}
+	for _, m := range spec.Mounts {
+		if m.Type != "bind" || !filepath.IsAbs(m.Source) {
+			continue
+		}
+		dir := m.Source
+		if fi, e := os.Stat(dir); e != nil {
+			continue
+		} else if !fi.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		supported, ok := probed[dir]
+		if !ok {
+			var e error
+			if supported, e = fs.SupportsUserXattrs(dir); e != nil {
+				loggers.Debug.Println(e)
+				supported = true // don't warn when the probe itself failed
+			}
+			probed[dir] = supported
+		}
+		if !supported {
+			loggers.Warn.WithField("mount", m.Source).Println("bind mount source's file system does not support user xattrs - file ownership changes within the container cannot be preserved. hint: copy the data into a volume instead")
+		}
+	}
+}
+
+// The supervisor maintains a container's restart count in the state dir so
+// that it can be reported by the list command.
+func restartCountFile(id string) string {
+	return filepath.Join(flagStateDir, "restarts", id)
+}
+
+func writeRestartCount(id string, count int) (err error) {
+	file := restartCountFile(id)
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err == nil {
+		err = ioutil.WriteFile(file, []byte(strconv.Itoa(count)), 0600)
+	}
+	if err != nil {
+		err = errors.New("write restart count: " + err.Error())
+	}
+	return
+}
+
+func readRestartCount(id string) int {
+	b, err := ioutil.ReadFile(restartCountFile(id))
+	if err != nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return count
+}
+
+// Sets the calling process' io scheduling class which the container init
+// process inherits (best-effort since it is not part of the OCI runtime spec).
+func setIONice(class int) (err error) {
+	// see linux/ioprio.h: IOPRIO_WHO_PROCESS=1, class shifted by 13 bits
+	if _, _, e := unix.Syscall(unix.SYS_IOPRIO_SET, 1, 0, uintptr(class<<13)); e != 0 {
+		err = errors.Errorf("set ionice class %d: %s", class, e)
+	}
+	return
+}
+
 func isFile(file string) bool {
 	return file != "" && (filepath.IsAbs(file) || file == "." || file == ".." || len(file) > 1 && file[0:2] == "./" || len(file) > 2 && file[0:3] == "../" || file == "~" || len(file) > 1 && file[0:2] == "~/")
 }
@@ -0,0 +1,150 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/image/docker"
+	"github.com/spf13/cobra"
+)
+
+// Lifetime of a cached registry tag list
+const completionTagCacheTTL = 10 * time.Minute
+
+// Custom bash completion of image reference arguments.
+// The tag list is completed by calling back into the binary so that
+// local store tags and cached registry tags can be offered.
+const bashCompletionFunc = `__ctnr_complete_image()
+{
+	local out
+	if out=$(ctnr completion image --remote -- "$cur" 2>/dev/null); then
+		COMPREPLY=( $(compgen -W "${out}" -- "$cur") )
+	fi
+}
+
+__custom_func() {
+	case ${last_command} in
+		ctnr_run | ctnr_bundle_create | ctnr_image_import | ctnr_image_inspect | ctnr_image_cat-config)
+			__ctnr_complete_image
+			;;
+	esac
+}
+`
+
+var (
+	completionCmd = &cobra.Command{
+		Use:   "completion",
+		Short: "Generates a bash completion script",
+		Long: `Generates a bash completion script.
+To load it into the current shell run: . <(ctnr completion)`,
+		Run: wrapRun(runCompletion),
+	}
+	completionImageCmd = &cobra.Command{
+		Use:    "image [flags] -- [PREFIX]",
+		Short:  "Completes an image reference",
+		Hidden: true,
+		Run:    wrapRun(runCompletionImage),
+	}
+	flagCompletionRemote  bool
+	flagCompletionTimeout time.Duration
+)
+
+func init() {
+	RootCmd.BashCompletionFunction = bashCompletionFunc
+	completionCmd.AddCommand(completionImageCmd)
+	f := completionImageCmd.Flags()
+	f.BoolVar(&flagCompletionRemote, "remote", false, "queries the registry's tag list when completing a tag")
+	f.DurationVar(&flagCompletionTimeout, "timeout", 3*time.Second, "registry query timeout")
+}
+
+func runCompletion(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return usageError("No args expected")
+	}
+	return RootCmd.GenBashCompletion(os.Stdout)
+}
+
+// Prints image reference completion candidates for the given prefix,
+// offering locally stored tags and optionally (--remote) the registry's
+// tags when a tag is completed, e.g. 'alpine:' -> 'alpine:3.7'.
+func runCompletionImage(cmd *cobra.Command, args []string) (err error) {
+	prefix := ""
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+	candidates := map[string]bool{}
+	if imgs, e := store.Images(); e == nil {
+		for _, img := range imgs {
+			if img.Tag != nil {
+				candidates[img.Tag.Repo+":"+img.Tag.Ref] = true
+			}
+		}
+	}
+	if li := strings.LastIndex(prefix, ":"); li > 0 && flagCompletionRemote {
+		repo := prefix[:li]
+		if tags, e := cachedRepositoryTags(repo, flagCompletionTimeout); e == nil {
+			for _, tag := range tags {
+				candidates[repo+":"+tag] = true
+			}
+		}
+	}
+	for candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			fmt.Fprintln(os.Stdout, candidate)
+		}
+	}
+	return
+}
+
+// Returns the repo's registry tag list, caching it within the store
+// directory to keep repeated completions fast.
+func cachedRepositoryTags(repo string, timeout time.Duration) (tags []string, err error) {
+	type tagCacheEntry struct {
+		Time time.Time `json:"time"`
+		Tags []string  `json:"tags"`
+	}
+	cacheFile := filepath.Join(flagStoreDir, ".cache", "tags", base32.StdEncoding.EncodeToString([]byte(repo)))
+	var entry tagCacheEntry
+	if b, e := ioutil.ReadFile(cacheFile); e == nil {
+		if json.Unmarshal(b, &entry) == nil && time.Since(entry.Time) < completionTagCacheTTL {
+			return entry.Tags, nil
+		}
+	}
+	ref, err := docker.ParseReference("//" + repo)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if tags, err = docker.GetRepositoryTags(ctx, systemContext, ref); err != nil {
+		return
+	}
+	entry = tagCacheEntry{time.Now(), tags}
+	if b, e := json.Marshal(&entry); e == nil {
+		if e = os.MkdirAll(filepath.Dir(cacheFile), 0750); e == nil {
+			ioutil.WriteFile(cacheFile, b, 0640)
+		}
+	}
+	return
+}
@@ -15,9 +15,34 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/mgoltzsche/ctnr/bundle"
 	"github.com/mgoltzsche/ctnr/model"
 	"github.com/mgoltzsche/ctnr/model/compose"
+	"github.com/mgoltzsche/ctnr/model/kubernetes"
+	"github.com/mgoltzsche/ctnr/model/oci"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/run"
+	"github.com/mgoltzsche/ctnr/run/logs"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var (
@@ -30,13 +55,135 @@ var (
 	composeRunCmd = &cobra.Command{
 		Use:   "run [flags] FILE",
 		Short: "Run a docker compose file",
-		Long:  `Converts and runs a docker compose file.`,
-		Run:   wrapRun(runComposeRun),
+		Long: `Converts and runs a docker compose file.
+The file may also be a Kubernetes Pod or Deployment manifest.`,
+		Run: wrapRun(runComposeRun),
+	}
+	composeUpCmd = &cobra.Command{
+		Use:   "up [flags] FILE",
+		Short: "Creates and starts a docker compose file's services detached",
+		Long: `Creates and starts a docker compose file's services detached.
+The file may also be a Kubernetes Pod or Deployment manifest.
+With --rolling already running replicas are recreated one batch at a time
+according to each service's deploy.update_config section.`,
+		Run: wrapRun(runComposeUp),
+	}
+	composeConfigCmd = &cobra.Command{
+		Use:   "config [flags] FILE...",
+		Short: "Validates and prints the resolved compose configuration",
+		Long: `Loads, interpolates, merges and validates the given compose files in
+order and prints the fully resolved configuration as canonical YAML
+or JSON to debug overrides and variable interpolation.`,
+		Run: wrapRun(runComposeConfig),
+	}
+	composeDownCmd = &cobra.Command{
+		Use:   "down [flags] FILE",
+		Short: "Stops and removes a compose project's containers",
+		Long: `Stops and removes the containers of all services belonging to the
+compose project. The project's containers are found by the project label on
+their bundles so the compose file may have changed since they were created.
+Networks are released together with their containers.`,
+		Run: wrapRun(runComposeDown),
+	}
+	composePsCmd = &cobra.Command{
+		Use:   "ps [flags] FILE",
+		Short: "Lists a compose project's containers",
+		Long:  `Lists the containers of all services belonging to the compose project.`,
+		Run:   wrapRun(runComposePs),
 	}
+	composeLogsCmd = &cobra.Command{
+		Use:   "logs [flags] FILE",
+		Short: "Prints a compose project's captured service output",
+		Long: `Prints the stdout/stderr output of all services belonging to the
+compose project, prefixing each line with the service name.`,
+		Run: wrapRun(runComposeLogs),
+	}
+	flagComposeRolling  bool
+	flagComposeFormat   string
+	flagComposeProject  string
+	flagComposeProfiles []string
+	flagComposeScale    []string
+	flagComposeTimeout  time.Duration
 )
 
 func init() {
 	composeCmd.AddCommand(composeRunCmd)
+	composeCmd.AddCommand(composeUpCmd)
+	composeCmd.AddCommand(composeDownCmd)
+	composeCmd.AddCommand(composePsCmd)
+	composeCmd.AddCommand(composeLogsCmd)
+	composeCmd.AddCommand(composeConfigCmd)
+	composeCmd.PersistentFlags().StringVar(&flagComposeProject, "project-name", "", "compose project name (default: name of the compose file's directory)")
+	composeRunCmd.Flags().StringSliceVar(&flagComposeProfiles, "profile", nil, "enables the services assigned to the given profile (x-profiles)")
+	composeUpCmd.Flags().StringSliceVar(&flagComposeProfiles, "profile", nil, "enables the services assigned to the given profile (x-profiles)")
+	composeUpCmd.Flags().BoolVar(&flagComposeRolling, "rolling", false, "recreates running replicas one batch at a time")
+	composeRunCmd.Flags().StringSliceVar(&flagComposeScale, "scale", nil, "overrides a service's replica count (format: SERVICE=REPLICAS)")
+	composeUpCmd.Flags().StringSliceVar(&flagComposeScale, "scale", nil, "overrides a service's replica count (format: SERVICE=REPLICAS)")
+	composeDownCmd.Flags().DurationVar(&flagComposeTimeout, "timeout", time.Duration(30*time.Second), "time to wait for a container to terminate before it is killed")
+	composeLogsCmd.Flags().BoolVarP(&flagLogsFollow, "follow", "f", false, "streams new output lines as they are written")
+	composeLogsCmd.Flags().IntVar(&flagLogsTail, "tail", 0, "prints only the last n output lines per service (default all)")
+	composeConfigCmd.Flags().StringVar(&flagComposeFormat, "format", "yaml", "output format: yaml|json")
+}
+
+func runComposeConfig(cmd *cobra.Command, args []string) (err error) {
+	if len(args) == 0 {
+		return usageError("No compose file argument provided")
+	}
+	cfg, err := compose.LoadConfig(args, "", compose.GetEnv())
+	if err != nil {
+		return
+	}
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	switch flagComposeFormat {
+	case "yaml":
+	case "json":
+		// The config types provide yaml tags only - convert the yaml
+		// representation to obtain the canonical field names in JSON as well
+		var v interface{}
+		if err = yaml.Unmarshal(b, &v); err != nil {
+			return errors.New(err.Error())
+		}
+		if b, err = json.MarshalIndent(jsonCompat(v), "", "  "); err != nil {
+			return errors.New(err.Error())
+		}
+	default:
+		return usageError("invalid --format value: " + flagComposeFormat)
+	}
+	fmt.Println(string(b))
+	return
+}
+
+// Converts yaml-decoded values into json.Marshal compatible types
+func jsonCompat(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprintf("%v", key)] = jsonCompat(val)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonCompat(e)
+		}
+	}
+	return v
+}
+
+// Loads the given docker compose file or Kubernetes manifest into the
+// service model
+func loadProject(file string) (*model.CompoundServices, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	if kubernetes.IsKubernetesManifest(b) {
+		return kubernetes.Load(file, filepath.Dir(file), loggers.Warn)
+	}
+	return compose.Load(file, "", compose.GetEnv(), loggers.Warn)
 }
 
 func runComposeRun(cmd *cobra.Command, args []string) error {
@@ -44,14 +191,520 @@ func runComposeRun(cmd *cobra.Command, args []string) error {
 		return usageError("No compose file argument provided")
 	}
 
-	project, err := compose.Load(args[0], "", compose.GetEnv(), loggers.Warn)
+	project, err := loadProject(args[0])
 	if err != nil {
 		return err
 	}
 
-	services := make([]model.Service, 0, len(project.Services))
-	for _, s := range project.Services {
-		services = append(services, s)
+	compose.FilterByProfiles(project.Services, flagComposeProfiles)
+	services, err := project.SortedServices()
+	if err != nil {
+		return err
+	}
+	if err = applyScale(services, flagComposeScale); err != nil {
+		return err
 	}
+	labelComposeProject(services, composeProjectName(args[0]))
 	return runServices(services, resourceResolver(project.Dir, project.Volumes))
 }
+
+func runComposeUp(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("No compose file argument provided")
+	}
+	project, err := loadProject(args[0])
+	if err != nil {
+		return err
+	}
+	compose.FilterByProfiles(project.Services, flagComposeProfiles)
+	services, err := project.SortedServices()
+	if err != nil {
+		return
+	}
+	if err = applyScale(services, flagComposeScale); err != nil {
+		return
+	}
+	labelComposeProject(services, composeProjectName(args[0]))
+	res := resourceResolver(project.Dir, project.Volumes)
+	manager, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	healthGated := healthGatedServices(services)
+	for _, s := range services {
+		ids, e := upService(s, res, manager)
+		if e != nil {
+			return e
+		}
+		if healthGated[s.Name] {
+			// Dependents declare condition service_healthy on this service
+			if s.HealthCheck == nil {
+				return errors.Errorf("service %s must become healthy before its dependents start but declares no healthcheck", s.Name)
+			}
+			for _, id := range ids {
+				if err = awaitReplicaHealthy(id, s.HealthCheck, manager); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+func runComposeDown(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("No compose file argument provided")
+	}
+	bundles, err := composeProjectBundles(composeProjectName(args[0]))
+	if err != nil {
+		return
+	}
+	manager, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	// Stop in reverse creation order to approximate reverse dependency order
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].Created().After(bundles[j].Created())
+	})
+	for _, b := range bundles {
+		id := b.ID()
+		if exist, _ := manager.Exist(id); exist {
+			if e := manager.Kill(id, syscall.SIGTERM, true); e != nil {
+				err = exterrors.Append(err, e)
+				continue
+			}
+			deadline := time.Now().Add(flagComposeTimeout)
+			for time.Now().Before(deadline) {
+				if exist, _ = manager.Exist(id); !exist {
+					break
+				}
+				time.Sleep(time.Millisecond * 100)
+			}
+			if exist {
+				loggers.Warn.WithField("id", id).Println("container did not terminate within timeout - killing it")
+				if e := manager.Kill(id, syscall.SIGKILL, true); e != nil {
+					err = exterrors.Append(err, e)
+					continue
+				}
+			}
+		}
+		if e := deleteBundle(id, manager); e != nil {
+			err = exterrors.Append(err, errors.WithMessage(e, "remove container "+id))
+		} else {
+			fmt.Println(id)
+		}
+	}
+	return
+}
+
+func runComposePs(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("No compose file argument provided")
+	}
+	bundles, err := composeProjectBundles(composeProjectName(args[0]))
+	if err != nil {
+		return
+	}
+	manager, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	l, err := manager.List()
+	if err != nil {
+		return
+	}
+	status := map[string]string{}
+	for _, c := range l {
+		status[c.ID] = c.Status
+	}
+	w := newTableWriter("%-20s  %-26s  %-10s  %s\n")
+	w.Header("SERVICE", "ID", "STATUS", "CREATED")
+	for _, b := range bundles {
+		s := status[b.ID()]
+		if s == "" {
+			s = "exited"
+		}
+		w.StyledRow(statusStyle(s), composeServiceName(&b), b.ID(), s, humanize.Time(b.Created()))
+	}
+	return
+}
+
+func runComposeLogs(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("No compose file argument provided")
+	}
+	bundles, err := composeProjectBundles(composeProjectName(args[0]))
+	if err != nil {
+		return
+	}
+	logDriver := logs.NewJsonFileDriver(filepath.Join(flagStateDir, "logs"))
+	maxNameLen := 0
+	names := make([]string, len(bundles))
+	for i, b := range bundles {
+		names[i] = composeServiceName(&b)
+		if len(names[i]) > maxNameLen {
+			maxNameLen = len(names[i])
+		}
+	}
+	mutex := &sync.Mutex{}
+	readLog := func(i int) error {
+		prefix := fmt.Sprintf("%-*s | ", maxNameLen, names[i])
+		out := &prefixWriter{os.Stdout, []byte(prefix), mutex}
+		return logDriver.Read(bundles[i].ID(), out, flagLogsTail, flagLogsFollow)
+	}
+	if flagLogsFollow {
+		// Stream all service logs concurrently until the process is interrupted
+		var wg sync.WaitGroup
+		for i := range bundles {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if e := readLog(i); e != nil {
+					loggers.Warn.Println(e)
+				}
+			}(i)
+		}
+		wg.Wait()
+		return
+	}
+	for i := range bundles {
+		if e := readLog(i); e != nil {
+			loggers.Warn.Println(e)
+		}
+	}
+	return
+}
+
+// Applies --scale overrides (SERVICE=REPLICAS) to the services'
+// deploy.replicas settings
+func applyScale(services []model.Service, scale []string) (err error) {
+	for _, entry := range scale {
+		kv := strings.SplitN(entry, "=", 2)
+		var n uint64
+		if len(kv) == 2 {
+			n, err = strconv.ParseUint(kv[1], 10, 32)
+		}
+		if len(kv) != 2 || kv[0] == "" || err != nil {
+			return usageError("invalid --scale entry " + strconv.Quote(entry) + ": expected format: SERVICE=REPLICAS")
+		}
+		found := false
+		for i := range services {
+			if services[i].Name == kv[0] {
+				found = true
+				replicas := uint(n)
+				// Copy the deploy section since it may be shared with the project
+				deploy := model.Deploy{}
+				if services[i].Deploy != nil {
+					deploy = *services[i].Deploy
+				}
+				deploy.Replicas = &replicas
+				services[i].Deploy = &deploy
+			}
+		}
+		if !found {
+			return usageError("--scale: service " + strconv.Quote(kv[0]) + " is not declared in the compose file")
+		}
+	}
+	return nil
+}
+
+// Returns the compose project name the project's containers are labelled
+// with: --project-name or the compose file's directory name
+func composeProjectName(file string) string {
+	if flagComposeProject != "" {
+		return flagComposeProject
+	}
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		dir = filepath.Dir(file)
+	}
+	return filepath.Base(dir)
+}
+
+// Labels the services' bundles with the project and service name so that
+// the down, ps and logs commands can find them later
+func labelComposeProject(services []model.Service, projectName string) {
+	for i := range services {
+		if services[i].Labels == nil {
+			services[i].Labels = map[string]string{}
+		}
+		services[i].Labels[oci.ANNOTATION_COMPOSE_PROJECT] = projectName
+		services[i].Labels[oci.ANNOTATION_COMPOSE_SERVICE] = services[i].Name
+	}
+}
+
+// Returns the bundles labelled with the given compose project name,
+// ordered by creation time
+func composeProjectBundles(projectName string) (bundles []bundle.Bundle, err error) {
+	match, err := bundleSelector([]string{oci.ANNOTATION_COMPOSE_PROJECT + "=" + projectName})
+	if err != nil {
+		return
+	}
+	l, err := store.Bundles()
+	if err != nil {
+		return
+	}
+	for _, b := range l {
+		if match(&b) {
+			bundles = append(bundles, b)
+		}
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].Created().Before(bundles[j].Created())
+	})
+	return
+}
+
+func composeServiceName(b *bundle.Bundle) string {
+	if ann, e := b.Annotations(); e == nil && ann[oci.ANNOTATION_COMPOSE_SERVICE] != "" {
+		return ann[oci.ANNOTATION_COMPOSE_SERVICE]
+	}
+	return b.ID()
+}
+
+// Prefixes each written log line. The log driver writes whole lines so
+// that per-write prefixing is sufficient.
+type prefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	mutex  *sync.Mutex
+}
+
+func (w *prefixWriter) Write(b []byte) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, err = w.out.Write(append(w.prefix, b...)); err != nil {
+		return
+	}
+	return len(b), nil
+}
+
+// Creates and starts a service's replicas detached. With --rolling the
+// replicas are recreated one batch at a time: each replica's new bundle is
+// built before its old container is stopped and the update is aborted when
+// a new replica does not pass its health gate, leaving the remaining
+// replicas untouched.
+func upService(s model.Service, res model.ResourceResolver, manager run.ContainerManager) (ids []string, err error) {
+	defer exterrors.Wrapdf(&err, "up service %s", s.Name)
+	replicas := 1
+	parallelism := 1
+	var delay time.Duration
+	if s.Deploy != nil {
+		if s.Deploy.Replicas != nil {
+			replicas = int(*s.Deploy.Replicas)
+		}
+		if u := s.Deploy.UpdateConfig; u != nil {
+			if u.Parallelism > 0 {
+				parallelism = int(u.Parallelism)
+			}
+			if u.Delay != nil {
+				delay = *u.Delay
+			}
+		}
+	}
+	ids = make([]string, 0, replicas)
+	for i := 0; i < replicas; i++ {
+		if flagComposeRolling && i > 0 && i%parallelism == 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		var id string
+		if id, err = upReplica(s, i, replicas, res, manager); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+func upReplica(s model.Service, idx, replicas int, res model.ResourceResolver, manager run.ContainerManager) (id string, err error) {
+	replica := s
+	if replicas > 1 {
+		replica.Name = fmt.Sprintf("%s-%d", s.Name, idx+1)
+		// An explicit hostname is indexed as well to keep replica hostnames
+		// distinct (an unset hostname defaults to the replica name)
+		if replica.Hostname != "" {
+			replica.Hostname = fmt.Sprintf("%s-%d", s.Hostname, idx+1)
+		}
+	}
+	if replica.Bundle == "" {
+		replica.Bundle = replica.Name
+	}
+	replica.BundleUpdate = true
+	defer exterrors.Wrapdf(&err, "replica %s", replica.Name)
+
+	// Build the new bundle before stopping the old container so that a
+	// build failure leaves the old replica running
+	b, err := createRuntimeBundle(&replica, res)
+	if err != nil {
+		return
+	}
+	id = b.ID()
+	if err = b.Close(); err != nil {
+		return
+	}
+
+	// Stop the old container and wait until its supervisor released the state
+	if exist, _ := manager.Exist(id); exist {
+		if len(replica.PreStop) > 0 {
+			if c, e := manager.Get(id); e == nil {
+				if err = runExecHooks(c, replica.PreStop, "pre-stop"); err != nil {
+					return
+				}
+			}
+		}
+		if err = manager.Kill(id, syscall.SIGTERM, true); err != nil {
+			return
+		}
+		for i := 0; i < 100; i++ {
+			if exist, _ = manager.Exist(id); !exist {
+				break
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+	}
+
+	if err = awaitHostDependencies(&replica); err != nil {
+		return
+	}
+	if err = startDetached(id); err != nil {
+		return
+	}
+	fmt.Println(id)
+
+	if len(replica.PostStart) > 0 {
+		// Wait until the detached replica's supervisor created the container
+		for i := 0; i < 100; i++ {
+			if exist, _ := manager.Exist(id); exist {
+				break
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+		c, e := manager.Get(id)
+		if e != nil {
+			return id, e
+		}
+		if err = runExecHooks(c, replica.PostStart, "post-start"); err != nil {
+			return
+		}
+	}
+
+	if flagComposeRolling {
+		if err = awaitReplicaHealthy(id, replica.HealthCheck, manager); err != nil {
+			// Roll back: stop the unhealthy replica before aborting the update
+			err = exterrors.Append(err, manager.Kill(id, syscall.SIGKILL, true))
+		}
+	}
+	return
+}
+
+// Waits until the given container runs and passes its health check
+func awaitReplicaHealthy(id string, check *model.Check, manager run.ContainerManager) (err error) {
+	interval := time.Second
+	retries := uint(3)
+	if check != nil {
+		if check.Interval != nil {
+			interval = *check.Interval
+		}
+		if check.Retries > 0 {
+			retries = check.Retries
+		}
+	}
+	for attempt := uint(0); attempt <= retries; attempt++ {
+		time.Sleep(interval)
+		exist, e := manager.Exist(id)
+		if e != nil {
+			err = e
+			continue
+		}
+		if !exist {
+			err = errors.Errorf("container %s is not running", id)
+			continue
+		}
+		if check == nil || check.Disable || (check.Tcp == "" && check.Http == "" && len(check.Command) == 0) {
+			return nil
+		}
+		if err = execHealthCheck(id, check, manager); err == nil {
+			return
+		}
+	}
+	return
+}
+
+// Runs a single health probe: tcp and http probes are performed from the
+// host's network namespace (supporting images without curl/wget) while a
+// command probe is executed inside the container.
+func execHealthCheck(id string, check *model.Check, manager run.ContainerManager) (err error) {
+	timeout := time.Duration(10 * time.Second)
+	if check.Timeout != nil {
+		timeout = *check.Timeout
+	}
+	if check.Tcp != "" {
+		conn, e := net.DialTimeout("tcp", check.Tcp, timeout)
+		if e != nil {
+			return errors.New("tcp probe: " + e.Error())
+		}
+		return conn.Close()
+	}
+	if check.Http != "" {
+		client := http.Client{Timeout: timeout}
+		resp, e := client.Get(check.Http)
+		if e != nil {
+			return errors.New("http probe: " + e.Error())
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return errors.Errorf("http probe: status %s", resp.Status)
+		}
+		return nil
+	}
+	c, err := manager.Get(id)
+	if err != nil {
+		return
+	}
+	proc, err := c.Exec(&specs.Process{Args: check.Command, Cwd: "/"}, run.ContainerIO{Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	if err != nil {
+		return
+	}
+	err = proc.Wait()
+	return exterrors.Append(err, proc.Close())
+}
+
+// Runs a service's exec hooks inside the running container sequentially,
+// honouring each hook's timeout and failure policy
+func runExecHooks(c run.Container, hooks []model.ExecHook, op string) (err error) {
+	for _, hook := range hooks {
+		if e := runExecHook(c, hook); e != nil {
+			e = errors.WithMessage(e, op+" hook in container "+c.ID())
+			if hook.OnFailure == "ignore" {
+				loggers.Warn.Println(e)
+				continue
+			}
+			return e
+		}
+	}
+	return
+}
+
+func runExecHook(c run.Container, hook model.ExecHook) (err error) {
+	proc, err := c.Exec(&specs.Process{Args: hook.Command, Cwd: "/"}, run.NewStdContainerIO())
+	if err != nil {
+		return
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- proc.Wait()
+	}()
+	if hook.Timeout == nil {
+		err = <-done
+	} else {
+		select {
+		case err = <-done:
+		case <-time.After(*hook.Timeout):
+			proc.Stop()
+			<-done
+			err = errors.Errorf("timed out after %s", *hook.Timeout)
+		}
+	}
+	return exterrors.Append(err, proc.Close())
+}
@@ -0,0 +1,142 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// ctnr configuration file declaring named store profiles, e.g. a "work"
+// and a "scratch" store with different directories and policies
+type config struct {
+	Stores map[string]storeProfile `json:"stores,omitempty"`
+	// Host-provided binary or script that is bind-mounted into every
+	// container and prepended to its args, e.g. for corporate certificate
+	// injection or tracing agents (overridable per container using --no-wrapper)
+	EntrypointWrapper string `json:"entrypoint_wrapper,omitempty"`
+}
+
+// Entrypoint wrapper applied to every container (see config file)
+var globalEntrypointWrapper string
+
+// Applies the config file's global settings. A missing default config
+// file yields no settings.
+func applyConfig() (err error) {
+	c, err := loadConfig()
+	if err != nil {
+		return
+	}
+	globalEntrypointWrapper = c.EntrypointWrapper
+	return
+}
+
+// Store settings a profile applies unless overridden by explicitly set
+// command line flags
+type storeProfile struct {
+	StoreDir     string `json:"store_dir,omitempty"`
+	TempDir      string `json:"temp_dir,omitempty"`
+	StateDir     string `json:"state_dir,omitempty"`
+	StateBackend string `json:"state_backend,omitempty"`
+	ImagePolicy  string `json:"image_policy,omitempty"`
+	PullJobs     int    `json:"pull_jobs,omitempty"`
+}
+
+func configFile() (file string, err error) {
+	if flagCfgFile != "" {
+		return flagCfgFile, nil
+	}
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return "", errors.New(err.Error())
+	}
+	return filepath.Join(homeDir, ".ctnr.json"), nil
+}
+
+func loadConfig() (c *config, err error) {
+	file, err := configFile()
+	if err != nil {
+		return
+	}
+	c = &config{}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		// A missing default config file is treated as empty configuration
+		// while an explicitly provided --config file must exist
+		if os.IsNotExist(err) && flagCfgFile == "" {
+			return c, nil
+		}
+		return nil, errors.New(err.Error())
+	}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "config file %s", file)
+	}
+	return
+}
+
+func saveConfig(c *config) (err error) {
+	file, err := configFile()
+	if err != nil {
+		return
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if err = ioutil.WriteFile(file, append(b, '\n'), 0640); err != nil {
+		err = errors.New(err.Error())
+	}
+	return
+}
+
+// Applies the named store profile from the config file to the global
+// store settings. Explicitly set command line flags take precedence
+// over profile values.
+func applyStoreProfile(cmd *cobra.Command, name string) (err error) {
+	c, err := loadConfig()
+	if err != nil {
+		return
+	}
+	profile, ok := c.Stores[name]
+	if !ok {
+		return usageError("store profile " + name + " is not declared in the config file")
+	}
+	f := cmd.Root().PersistentFlags()
+	if profile.StoreDir != "" && !f.Changed("store-dir") {
+		flagStoreDir = profile.StoreDir
+	}
+	if profile.TempDir != "" && !f.Changed("temp-dir") {
+		flagTempDir = profile.TempDir
+	}
+	if profile.StateDir != "" && !f.Changed("state-dir") {
+		flagStateDir = profile.StateDir
+	}
+	if profile.StateBackend != "" && !f.Changed("state-backend") {
+		flagStateBackend = profile.StateBackend
+	}
+	if profile.ImagePolicy != "" && !f.Changed("image-policy") {
+		flagImagePolicy = profile.ImagePolicy
+	}
+	if profile.PullJobs > 0 && !f.Changed("pull-jobs") {
+		flagPullJobs = profile.PullJobs
+	}
+	return
+}
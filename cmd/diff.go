@@ -0,0 +1,69 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff CONTAINERID",
+	Short: "Shows a container's rootfs changes",
+	Long: `Lists files added (A), modified (M) and deleted (D) in a container's
+rootfs since its bundle has been created from its parent image,
+using the image's stored file system spec.`,
+	Run: wrapRun(runDiff),
+}
+
+func runDiff(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one CONTAINERID argument expected")
+	}
+	b, err := bundleByIdOrDir(args[0])
+	if err != nil {
+		return
+	}
+	lockedBundle, err := b.Lock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, lockedBundle.Close())
+	}()
+	spec, err := lockedBundle.Spec()
+	if err != nil {
+		return
+	}
+	if spec.Root == nil {
+		return errors.Errorf("bundle %q has no root path", b.ID())
+	}
+	imgId := lockedBundle.Image()
+	if imgId == nil {
+		return errors.Errorf("bundle %q has no parent image to diff against", b.ID())
+	}
+	drift, err := bundleImageDrift(filepath.Join(b.Dir(), spec.Root.Path), *imgId)
+	if err != nil {
+		return
+	}
+	for _, line := range drift {
+		fmt.Println(line)
+	}
+	return
+}
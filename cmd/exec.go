@@ -15,6 +15,8 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/mgoltzsche/ctnr/bundle/builder"
 	"github.com/mgoltzsche/ctnr/model/oci"
 	"github.com/mgoltzsche/ctnr/run"
@@ -38,6 +40,7 @@ var (
 func init() {
 	flagsBundle.InitProcessFlags(execCmd.Flags())
 	flagsBundle.InitRunFlags(execCmd.Flags())
+	execCmd.Flags().BoolVar(&flagsBundle.privileged, "privileged", false, "give extended privileges to the process")
 }
 
 func runExec(cmd *cobra.Command, args []string) (err error) {
@@ -54,6 +57,9 @@ func runExec(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
+	if service.Privileged {
+		audit("privileged-exec", "container "+args[0])
+	}
 	spec := builder.NewSpecBuilder()
 	if err = oci.ToSpecProcess(&service.Process, flagPRootPath, &spec); err != nil {
 		return
@@ -70,7 +76,11 @@ func runExec(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	proc, err := container.Exec(sp.Process, run.NewStdContainerIO())
+	cio := run.NewStdContainerIO()
+	if service.StdinOpen {
+		cio.Stdin = os.Stdin
+	}
+	proc, err := container.Exec(sp.Process, cio)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,86 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
+	"github.com/mgoltzsche/ctnr/pkg/fs/writer"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportCmd = &cobra.Command{
+		Use:   "export CONTAINERID",
+		Short: "Exports a container's rootfs as tar archive",
+		Long: `Writes a container's complete rootfs as uncompressed tar archive to
+stdout (or --output), mirroring docker export. The archive can be
+imported as a single-layer image using the import command.`,
+		Run: wrapRun(runExport),
+	}
+	flagExportOutput string
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&flagExportOutput, "output", "o", "", "writes to a file instead of stdout")
+}
+
+func runExport(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one CONTAINERID argument expected")
+	}
+	b, err := bundleByIdOrDir(args[0])
+	if err != nil {
+		return
+	}
+	lockedBundle, err := b.Lock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, lockedBundle.Close())
+	}()
+	spec, err := lockedBundle.Spec()
+	if err != nil {
+		return
+	}
+	if spec.Root == nil {
+		return errors.Errorf("bundle %q has no root path", b.ID())
+	}
+	rootfs, err := tree.FromDir(filepath.Join(b.Dir(), spec.Root.Path), flagRootless)
+	if err != nil {
+		return
+	}
+	out := os.Stdout
+	if flagExportOutput != "" {
+		f, e := os.OpenFile(flagExportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+		if e != nil {
+			return errors.New(e.Error())
+		}
+		defer func() {
+			err = exterrors.Append(err, f.Close())
+		}()
+		out = f
+	}
+	w := writer.NewTarWriter(out)
+	defer func() {
+		err = exterrors.Append(err, w.Close())
+	}()
+	return rootfs.Write(w)
+}
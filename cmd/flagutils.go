@@ -109,8 +109,23 @@ func ParseMount(expr string) (r model.VolumeMount, err error) {
 			r.Source = v
 		case k == "destination" || k == "dst" || k == "target":
 			r.Target = v
-		case k == "readonly":
+		case k == "readonly" || k == "ro":
 			r.Options = append(r.Options, "ro")
+		case k == "rw":
+			r.Options = append(r.Options, "rw")
+		case k == "nosuid" || k == "nodev" || k == "noexec":
+			r.Options = append(r.Options, k)
+		case k == "bind-propagation" || k == "propagation":
+			switch v {
+			case "shared", "slave", "private", "rshared", "rslave", "rprivate":
+				r.Options = append(r.Options, v)
+			default:
+				return r, errors.Errorf("unsupported mount propagation %q", v)
+			}
+		case k == "tmpfs-size":
+			r.Options = append(r.Options, "size="+v)
+		case k == "tmpfs-mode":
+			r.Options = append(r.Options, "mode="+v)
 		case k == "volume-opt" || k == "opt":
 			r.Options = append(r.Options, v)
 		default:
@@ -40,6 +40,7 @@ func init() {
 	gcCmd.Flags().DurationVarP(&flagGcImageTTL, "image-ttl", "i", defaultImageTTL, "image lifetime before it gets garbage collected")
 	gcCmd.Flags().DurationVarP(&flagGcImageRefTTL, "ref-ttl", "r", 0, "tagged image lifetime before it gets garbage collected")
 	gcCmd.Flags().IntVarP(&flagGcMaxImagesPerRepo, "max", "m", 0, "max entries per repo (default 0 == unlimited)")
+	initSelectorFlag(gcCmd)
 }
 
 func runGc(cmd *cobra.Command, args []string) (err error) {
@@ -50,7 +51,11 @@ func runGc(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	gcd, err := store.BundleGC(flagGcBundleTTL, cm)
+	match, err := bundleSelector(flagSelector)
+	if err != nil {
+		return
+	}
+	gcd, err := store.BundleGC(flagGcBundleTTL, cm, match)
 	for _, b := range gcd {
 		os.Stdout.WriteString(b.ID() + "\n")
 	}
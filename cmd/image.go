@@ -20,16 +20,25 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/containers/image/transports"
 	humanize "github.com/dustin/go-humanize"
+	shellwords "github.com/mattn/go-shellwords"
 	"github.com/mgoltzsche/ctnr/image"
 	"github.com/mgoltzsche/ctnr/image/builder"
+	"github.com/mgoltzsche/ctnr/model"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
+	"github.com/mgoltzsche/ctnr/pkg/fs/writer"
 	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -45,22 +54,25 @@ var (
 		Run:   wrapRun(runImageList),
 	}
 	imageTagCmd = &cobra.Command{
-		Use:   "tag IMAGE...",
-		Short: "Tags one or many images",
-		Long:  `Tags one or many images in the local store.`,
-		Run:   wrapRun(runImageTag),
+		Use:   "tag IMAGE TAG...",
+		Short: "Tags an image",
+		Long: `Adds one or many tags to an image in the local store.
+The image can be referred to by an existing name or its ID.`,
+		Run: wrapRun(runImageTag),
 	}
 	imageUntagCmd = &cobra.Command{
-		Use:   "untag IMAGE...",
+		Use:   "untag NAME...",
 		Short: "Untags one or many images",
 		Long:  `Untags one or many images in the local store.`,
 		Run:   wrapRun(runImageUntag),
 	}
 	imageRmCmd = &cobra.Command{
-		Use:   "rm IMAGEID",
-		Short: "Removes the image from the store",
-		Long:  `Removes the image as well as all tags referencing it from the store.`,
-		Run:   wrapRun(runImageRm),
+		Use:   "rm IMAGE...",
+		Short: "Removes images from the store",
+		Long: `Removes images as well as all tags referencing them from the store.
+Images can be referred to by name or ID. Images that are still used
+by bundles are only removed when --force is provided.`,
+		Run: wrapRun(runImageRm),
 	}
 	imageGcCmd = &cobra.Command{
 		Use:   "gc",
@@ -68,6 +80,13 @@ var (
 		Long:  `Garbage collects all image blobs in the local store that are not referenced.`,
 		Run:   wrapRun(runImageGc),
 	}
+	imagePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Removes unreferenced image data",
+		Long: `Deletes unreferenced blobs, dangling image IDs and orphaned
+layer metadata from the local store and reports the reclaimed bytes.`,
+		Run: wrapRun(runImagePrune),
+	}
 	imageImportCmd = &cobra.Command{
 		Use:   "import IMAGE",
 		Short: "Imports an image",
@@ -84,6 +103,73 @@ to a local or remote destination.`,
 			panic("TODO: export image")
 		},
 	}
+	imageSaveCmd = &cobra.Command{
+		Use:   "save NAME[:TAG] FILE",
+		Short: "Saves an image to a tar archive",
+		Long: `Saves an image from the local store to a docker-archive
+or oci-archive tarball that can be loaded on another host
+without a registry.`,
+		Run: wrapRun(runImageSave),
+	}
+	imageLoadCmd = &cobra.Command{
+		Use:   "load FILE",
+		Short: "Loads an image from a tar archive",
+		Long: `Loads an image from a docker-archive or oci-archive
+tarball into the local store.`,
+		Run: wrapRun(runImageLoad),
+	}
+	imagePushCmd = &cobra.Command{
+		Use:   "push NAME[:TAG] [DEST]",
+		Short: "Pushes an image",
+		Long: `Pushes a tagged image from the local store to a registry
+or another local or remote destination.`,
+		Run: wrapRun(runImagePush),
+	}
+	imageSignCmd = &cobra.Command{
+		Use:   "sign NAME[:TAG] [DEST]",
+		Short: "Signs and pushes an image",
+		Long: `Pushes a tagged image from the local store to a registry or another
+destination adding a GPG signature made with the --sign-by key.
+The signature is stored through the destination's signature storage
+(see https://github.com/containers/image/blob/master/docs/registries.d.md)
+and verified on import against the signedBy requirements of the
+policy.json file provided as --image-policy.`,
+		Run: wrapRun(runImageSign),
+	}
+	imageInspectCmd = &cobra.Command{
+		Use:   "inspect IMAGE",
+		Short: "Prints detailed image metadata",
+		Long: `Prints an image's manifest, configuration and layer digests
+as JSON or rendered using a Go template (--format).`,
+		Run: wrapRun(runImageInspect),
+	}
+	imageSquashCmd = &cobra.Command{
+		Use:   "squash IMAGE [TAG]",
+		Short: "Squashes an image's layers",
+		Long: `Squashes all layers of an image (or the last N with --layers) into a
+single layer to shrink images assembled from many build steps and
+prints the resulting image's ID, optionally tagging it.`,
+		Run: wrapRun(runImageSquash),
+	}
+	imageAnnotateCmd = &cobra.Command{
+		Use:   "annotate IMAGE KEY=VALUE|KEY- ...",
+		Short: "Sets or removes image annotations",
+		Run:   wrapRun(runImageAnnotate),
+		Long: `Sets (KEY=VALUE) or removes (KEY-) annotations on an image's manifest
+or, with --index, on the repo's OCI image index so that build
+pipelines can stamp provenance metadata
+(e.g. org.opencontainers.image.source/revision/licenses) which is
+preserved when the image is pushed and pulled.
+Prints the annotated image's ID unless --index is provided.`,
+	}
+	imageDiffCmd = &cobra.Command{
+		Use:   "diff IMAGE1 IMAGE2",
+		Short: "Compares two images' file systems",
+		Long: `Compares two images' file systems using their stored file system
+specs and prints the second image's added (A), modified (M) and
+deleted (D) paths relative to the first without unpacking any layers.`,
+		Run: wrapRun(runImageDiff),
+	}
 	imageCatConfigCmd = &cobra.Command{
 		Use:   "cat-config IMAGE",
 		Short: "Prints an image's configuration",
@@ -91,14 +177,22 @@ to a local or remote destination.`,
 		Run:   wrapRun(runImageCatConfig),
 	}
 	imageBuildCmd = &cobra.Command{
-		Use:   "build",
+		Use:   "build [CONTEXT]",
 		Short: "Builds a new image from the provided options",
-		Long:  `Builds a new image from the provided options.`,
-		Run:   wrapRun(runImageBuildRun),
-	}
+		Long: `Builds a new image from the provided options.
+The build context may be a local directory, a git URL (optionally suffixed
+with #REF[:DIR]), an http(s) tarball URL or '-' for a tar stream on stdin.`,
+		Run: wrapRun(runImageBuildRun),
+	}
+	flagArchiveFormat   string
+	flagImageRmForce    bool
+	flagImageSignBy     string
+	flagInspectFormat   string
 	flagImageTTL        time.Duration
 	flagImageRefTTL     time.Duration
 	flagImageMaxPerRepo int
+	flagSquashLayers    int
+	flagAnnotateIndex   bool
 	defaultImageTTL     = time.Duration(1000 * 1000 * 1000 * 60 * 60 * 24 * 7 /*7 days*/)
 )
 
@@ -108,14 +202,31 @@ func init() {
 		"\n\nExample image refs:\n  docker://alpine:latest\n  oci:mydir:latest"
 	imageExportCmd.Long += transportsHelp
 	imageImportCmd.Long += transportsHelp
+	imagePushCmd.Long += transportsHelp
 	initImageBuildFlags(imageBuildCmd.Flags())
 	imageCmd.AddCommand(imageListCmd)
 	imageCmd.AddCommand(imageTagCmd)
 	imageCmd.AddCommand(imageUntagCmd)
 	imageCmd.AddCommand(imageRmCmd)
+	imageRmCmd.Flags().BoolVarP(&flagImageRmForce, "force", "f", false, "removes the image even when it is still used by a bundle")
 	imageCmd.AddCommand(imageGcCmd)
+	imageCmd.AddCommand(imagePruneCmd)
 	imageCmd.AddCommand(imageImportCmd)
 	imageCmd.AddCommand(imageExportCmd)
+	imageCmd.AddCommand(imagePushCmd)
+	imageCmd.AddCommand(imageSignCmd)
+	imageSignCmd.Flags().StringVar(&flagImageSignBy, "sign-by", "", "GPG key identity (e.g. an email address) to sign the image with")
+	imageCmd.AddCommand(imageSaveCmd)
+	imageCmd.AddCommand(imageLoadCmd)
+	imageSaveCmd.Flags().StringVar(&flagArchiveFormat, "format", "docker", "archive format: docker or oci")
+	imageLoadCmd.Flags().StringVar(&flagArchiveFormat, "format", "docker", "archive format: docker or oci")
+	imageCmd.AddCommand(imageInspectCmd)
+	imageInspectCmd.Flags().StringVar(&flagInspectFormat, "format", "", "renders the output using the given Go template")
+	imageCmd.AddCommand(imageSquashCmd)
+	imageSquashCmd.Flags().IntVarP(&flagSquashLayers, "layers", "n", 0, "number of trailing layers to squash (0 == all)")
+	imageCmd.AddCommand(imageAnnotateCmd)
+	imageAnnotateCmd.Flags().BoolVar(&flagAnnotateIndex, "index", false, "annotates the repo's OCI image index instead of the image manifest")
+	imageCmd.AddCommand(imageDiffCmd)
 	imageCmd.AddCommand(imageCatConfigCmd)
 	imageCmd.AddCommand(imageBuildCmd)
 	imageGcCmd.Flags().DurationVarP(&flagImageTTL, "ttl", "t", defaultImageTTL, "image lifetime before it gets garbage collected")
@@ -129,18 +240,22 @@ func runImageList(cmd *cobra.Command, args []string) (err error) {
 		return
 	}
 	sort.Slice(imgs, func(i, j int) bool {
-		return imgs[i].LastUsed.Before(imgs[j].LastUsed)
+		if !imgs[i].LastUsed.Equal(imgs[j].LastUsed) {
+			return imgs[i].LastUsed.Before(imgs[j].LastUsed)
+		}
+		// Group additional tags of the same image
+		return imgs[i].ID() < imgs[j].ID()
 	})
-	f := "%-35s %-15s  %-71s  %-15s  %8s\n"
-	fmt.Printf(f, "REPO", "REF", "ID", "CREATED", "SIZE")
+	w := newTableWriter("%-35s %-15s  %-71s  %-15s  %8s\n")
+	w.Header("REPO", "REF", "ID", "CREATED", "SIZE")
 	for _, img := range imgs {
-		repo := ""
-		ref := ""
+		repo := "<none>"
+		ref := "<none>"
 		if img.Tag != nil {
 			repo = img.Tag.Repo
 			ref = img.Tag.Ref
 		}
-		fmt.Printf(f, repo, ref, img.ID(), humanize.Time(img.Created), humanize.Bytes(img.Size()))
+		w.Row(repo, ref, img.ID(), humanize.Time(img.Created), humanize.Bytes(img.Size()))
 	}
 	return
 }
@@ -152,19 +267,48 @@ func runImageGc(cmd *cobra.Command, args []string) error {
 	return store.ImageGC(flagImageTTL, flagImageRefTTL, flagImageMaxPerRepo)
 }
 
-func runImageRm(cmd *cobra.Command, args []string) error {
+func runImagePrune(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 0 {
+		return usageError("No argument expected: " + args[0])
+	}
+	reclaimed, err := store.ImagePrune()
+	if err == nil {
+		fmt.Fprintln(os.Stdout, "reclaimed "+humanize.Bytes(reclaimed))
+	}
+	return
+}
+
+func runImageRm(cmd *cobra.Command, args []string) (err error) {
 	if len(args) == 0 {
-		return usageError("No IMAGEID provided")
+		return usageError("No IMAGE provided")
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
 	}
+
 	ids := make([]digest.Digest, len(args))
 	for i, a := range args {
-		if d, e := digest.Parse(a); e == nil && d.Validate() == nil {
-			ids[i] = d
-		} else {
-			return errors.Errorf("invalid IMAGEID %q provided", a)
+		img, e := image.GetLocalImage(lockedStore, a)
+		if e != nil {
+			return e
+		}
+		ids[i] = img.ID()
+	}
+	if !flagImageRmForce {
+		bundles, e := store.Bundles()
+		if e != nil {
+			return e
+		}
+		for _, id := range ids {
+			for _, b := range bundles {
+				if imgId := b.Image(); imgId != nil && *imgId == id {
+					return errors.Errorf("image %s is still used by bundle %s. hint: use --force to remove it anyway", id, b.ID())
+				}
+			}
 		}
 	}
-	return store.DelImage(ids...)
+	return lockedStore.DelImage(ids...)
 }
 
 func runImageImport(cmd *cobra.Command, args []string) (err error) {
@@ -183,21 +327,115 @@ func runImageImport(cmd *cobra.Command, args []string) (err error) {
 	return
 }
 
+func runImageSave(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 2 {
+		return usageError("NAME[:TAG] and FILE arguments required")
+	}
+	name := args[0]
+	file, err := filepath.Abs(args[1])
+	if err != nil {
+		return
+	}
+	dest := ""
+	switch flagArchiveFormat {
+	case "docker":
+		// The docker-archive transport requires a tagged destination ref
+		if strings.LastIndex(name, ":") <= strings.LastIndex(name, "/") {
+			name += ":latest"
+		}
+		dest = "docker-archive:" + file + ":" + name
+	case "oci":
+		dest = "oci-archive:" + file
+	default:
+		return usageError("invalid --format value: " + flagArchiveFormat)
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+
+	return lockedStore.PushImage(args[0], dest, "")
+}
+
+func runImageLoad(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("FILE argument required")
+	}
+	file, err := filepath.Abs(args[0])
+	if err != nil {
+		return
+	}
+	src := ""
+	switch flagArchiveFormat {
+	case "docker":
+		src = "docker-archive:" + file
+	case "oci":
+		src = "oci-archive:" + file
+	default:
+		return usageError("invalid --format value: " + flagArchiveFormat)
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+
+	img, err := lockedStore.ImportImage(src)
+	if err == nil {
+		fmt.Fprintln(os.Stdout, img.ID())
+	}
+	return
+}
+
+func runImagePush(cmd *cobra.Command, args []string) (err error) {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("NAME[:TAG] argument and optional DEST expected")
+	}
+	dest := ""
+	if len(args) == 2 {
+		dest = args[1]
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+
+	return lockedStore.PushImage(args[0], dest, "")
+}
+
+func runImageSign(cmd *cobra.Command, args []string) (err error) {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("NAME[:TAG] argument and optional DEST expected")
+	}
+	if flagImageSignBy == "" {
+		return usageError("No --sign-by key identity provided")
+	}
+	dest := ""
+	if len(args) == 2 {
+		dest = args[1]
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+
+	return lockedStore.PushImage(args[0], dest, flagImageSignBy)
+}
+
 func runImageTag(cmd *cobra.Command, args []string) (err error) {
 	if len(args) < 2 {
-		return usageError("ImageID and tag arguments required")
+		return usageError("IMAGE and TAG arguments required")
 	}
 	lockedStore, err := openImageStore()
 	if err != nil {
 		return
 	}
 
-	imageId, err := digest.Parse(args[0])
+	img, err := image.GetLocalImage(lockedStore, args[0])
 	if err != nil {
 		return
 	}
 	for _, tag := range args[1:] {
-		if _, err = lockedStore.TagImage(imageId, tag); err != nil {
+		if _, err = lockedStore.TagImage(img.ID(), tag); err != nil {
 			return
 		}
 	}
@@ -226,6 +464,148 @@ func runImageUntag(cmd *cobra.Command, args []string) (err error) {
 	return
 }
 
+func runImageSquash(cmd *cobra.Command, args []string) (err error) {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("IMAGE argument and optional TAG expected")
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+	img, err := image.GetLocalImage(lockedStore, args[0])
+	if err != nil {
+		return
+	}
+	if img, err = lockedStore.SquashLayers(img.ID(), flagSquashLayers); err != nil {
+		return
+	}
+	if len(args) > 1 {
+		if _, err = lockedStore.TagImage(img.ID(), args[1]); err != nil {
+			return
+		}
+	}
+	fmt.Fprintln(os.Stdout, img.ID())
+	return
+}
+
+func runImageAnnotate(cmd *cobra.Command, args []string) (err error) {
+	if len(args) < 2 {
+		return usageError("IMAGE and at least one KEY=VALUE or KEY- argument required")
+	}
+	set := map[string]string{}
+	remove := []string{}
+	for _, a := range args[1:] {
+		if kv := strings.SplitN(a, "=", 2); len(kv) == 2 {
+			set[kv[0]] = kv[1]
+		} else if strings.HasSuffix(a, "-") && len(a) > 1 {
+			remove = append(remove, strings.TrimSuffix(a, "-"))
+		} else {
+			return usageError("invalid annotation argument (expected KEY=VALUE or KEY-): " + a)
+		}
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+	if flagAnnotateIndex {
+		return lockedStore.AnnotateImageIndex(args[0], set, remove)
+	}
+	img, err := image.GetLocalImage(lockedStore, args[0])
+	if err != nil {
+		return
+	}
+	imageId := img.ID()
+	if img, err = lockedStore.AnnotateImage(imageId, set, remove); err != nil {
+		return
+	}
+	// Point the image's tags at the annotated manifest
+	imgs, err := lockedStore.Images()
+	if err != nil {
+		return
+	}
+	for _, i := range imgs {
+		if i.ID() == imageId && i.Tag != nil {
+			if _, err = lockedStore.TagImage(img.ID(), i.Tag.String()); err != nil {
+				return
+			}
+		}
+	}
+	fmt.Fprintln(os.Stdout, img.ID())
+	return
+}
+
+func runImageDiff(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 2 {
+		return usageError("IMAGE1 and IMAGE2 arguments required")
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+	img1, err := image.GetLocalImage(lockedStore, args[0])
+	if err != nil {
+		return
+	}
+	img2, err := image.GetLocalImage(lockedStore, args[1])
+	if err != nil {
+		return
+	}
+	fs1, err := lockedStore.FS(img1.ID())
+	if err != nil {
+		return
+	}
+	fs2, err := lockedStore.FS(img2.ID())
+	if err != nil {
+		return
+	}
+	diffFs, err := fs1.Diff(fs2)
+	if err != nil {
+		return
+	}
+	w := &driftWriter{fs.HashingNilWriter(), fs1, nil}
+	if !diffFs.Empty() {
+		if err = diffFs.Write(w); err != nil {
+			return
+		}
+	}
+	if len(w.drift) == 0 {
+		loggers.Info.Printf("images %s and %s have identical file systems", img1.ID(), img2.ID())
+		return
+	}
+	sort.Strings(w.drift)
+	for _, line := range w.drift {
+		fmt.Println(line)
+	}
+	return
+}
+
+func runImageInspect(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("No IMAGE argument provided")
+	}
+	details, err := store.Inspect(args[0])
+	if err != nil {
+		return
+	}
+	if flagInspectFormat != "" {
+		t, e := template.New("format").Parse(flagInspectFormat)
+		if e != nil {
+			return usageError("invalid --format template: " + e.Error())
+		}
+		if err = t.Execute(os.Stdout, details); err != nil {
+			return errors.Wrap(err, "render --format template")
+		}
+		fmt.Println()
+		return
+	}
+	b, err := json.MarshalIndent(&details, "", "  ")
+	if err != nil {
+		return
+	}
+	fmt.Println(string(b))
+	return
+}
+
 func runImageCatConfig(cmd *cobra.Command, args []string) (err error) {
 	if len(args) != 1 {
 		return usageError("No IMAGE argument provided")
@@ -247,7 +627,17 @@ func runImageCatConfig(cmd *cobra.Command, args []string) (err error) {
 }
 
 func runImageBuildRun(cmd *cobra.Command, args []string) (err error) {
-	if len(args) > 0 {
+	if len(args) > 1 {
+		return usageError(fmt.Sprintf("Only one context path supported as argument but provided: %v", args[1:]))
+	}
+	if len(args) > 0 && isRemoteBuildContext(args[0]) {
+		ctxDir, tmpCtxDir, e := fetchBuildContext(args[0], filepath.Join(flagStoreDir, "tmp"))
+		if e != nil {
+			return e
+		}
+		defer os.RemoveAll(tmpCtxDir)
+		flagImageBuildOps.dockerfileDir = ctxDir
+	} else if len(args) > 0 {
 		flagImageBuildOps.dockerfileDir = args[0]
 	} else if flagImageBuildOps.dockerfileDir, err = os.Getwd(); err != nil {
 		return
@@ -255,17 +645,30 @@ func runImageBuildRun(cmd *cobra.Command, args []string) (err error) {
 	if flagImageBuildOps.dockerfileDir, err = filepath.Abs(flagImageBuildOps.dockerfileDir); err != nil {
 		return
 	}
-	if len(args) > 1 {
-		return usageError(fmt.Sprintf("Only one context path supported as argument but provided: %v", args[1:]))
-	}
 	lockedStore, err := openImageStore()
 	if err != nil {
 		return
 	}
+	if flagReproducible {
+		if err = setBuildTimestamp(lockedStore); err != nil {
+			return
+		}
+	}
 
 	cache := builder.NewNoOpCache()
+	if flagNoCache && (len(flagCacheFrom) > 0 || flagCacheTo != "") {
+		return usageError("--cache-from and --cache-to cannot be combined with --no-cache")
+	}
+	cacheDir := filepath.Join(flagStoreDir, "image-build-cache")
 	if !flagNoCache {
-		cache = builder.NewImageBuildCache(filepath.Join(flagStoreDir, "image-build-cache"), loggers.Warn)
+		for _, src := range flagCacheFrom {
+			if err = importBuildCache(src, cacheDir, lockedStore); err != nil {
+				return
+			}
+		}
+		cache = builder.NewImageBuildCache(cacheDir, loggers.Warn)
+		// Coordinate in-flight build steps with concurrent builder processes
+		cache = builder.NewSharedImageBuildCache(cache, filepath.Join(cacheDir, "coord.sock"), loggers.Debug)
 	}
 	proot := ""
 	if flagProot {
@@ -283,8 +686,9 @@ func runImageBuildRun(cmd *cobra.Command, args []string) (err error) {
 		RunRoot:                flagStateDir,
 		Rootless:               flagRootless,
 		PRoot:                  proot,
-		RemoveSucceededBundles: flagRm || flagAll,
+		RemoveSucceededBundles: (flagRm || flagAll) && !flagReuseBundle,
 		RemoveFailedBundle:     flagAll,
+		ReuseBuildBundle:       flagReuseBundle,
 		Loggers:                loggers,
 	})
 	defer func() {
@@ -292,6 +696,12 @@ func runImageBuildRun(cmd *cobra.Command, args []string) (err error) {
 			loggers.Error.Println(e)
 		}
 	}()
+	switch flagBuildPull {
+	case "", "always", "missing", "never":
+		imageBuilder.SetPullPolicy(image.PullPolicy(flagBuildPull))
+	default:
+		return usageError("invalid --pull value: " + flagBuildPull)
+	}
 	if len(flagImageBuildOps.ops) == 0 {
 		return errors.New("no build operations provided")
 	}
@@ -300,6 +710,150 @@ func runImageBuildRun(cmd *cobra.Command, args []string) (err error) {
 			return
 		}
 	}
-	fmt.Fprintln(os.Stdout, imageBuilder.Image())
+	builtImage := imageBuilder.Image()
+	if flagSquash {
+		if builtImage, err = squashBuiltImage(builtImage, lockedStore); err != nil {
+			return
+		}
+	}
+	if flagCacheTo != "" {
+		if err = exportBuildCache(cacheDir, flagCacheTo, lockedStore); err != nil {
+			return
+		}
+	}
+	fmt.Fprintln(os.Stdout, builtImage)
+	if cmd.Flags().Changed("start") {
+		err = runBuiltImage(builtImage, flagBuildStart)
+	}
+	return
+}
+
+// Squashes the built image's layers into a single layer and moves the
+// built image's tags to the squashed image
+func squashBuiltImage(imageId digest.Digest, istore image.ImageStoreRW) (squashedId digest.Digest, err error) {
+	img, err := istore.SquashLayers(imageId, 0)
+	if err != nil {
+		return
+	}
+	imgs, err := istore.Images()
+	if err != nil {
+		return
+	}
+	for _, i := range imgs {
+		if i.ID() == imageId && i.Tag != nil {
+			if _, err = istore.TagImage(img.ID(), i.Tag.String()); err != nil {
+				return
+			}
+		}
+	}
+	return img.ID(), nil
+}
+
+// Pins the store's commit timestamps to SOURCE_DATE_EPOCH or, when unset,
+// the unix epoch so that identical inputs yield identical image digests
+func setBuildTimestamp(istore image.ImageStoreRW) error {
+	epoch := time.Unix(0, 0)
+	if v, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return usageError("invalid SOURCE_DATE_EPOCH value: " + v)
+		}
+		epoch = time.Unix(sec, 0)
+	}
+	istore.SetBuildTimestamp(epoch.UTC())
+	return nil
+}
+
+// Runs a container from the built image so that an image can be built and
+// tried out in a single command. The flag value is parsed like 'ctnr run'
+// CLI arguments.
+func runBuiltImage(imageId digest.Digest, runArgs string) (err error) {
+	args, err := shellwords.Parse(runArgs)
+	if err != nil {
+		return usageError("invalid --start value: " + err.Error())
+	}
+	flags := bundleFlags{}
+	f := pflag.NewFlagSet("start", pflag.ContinueOnError)
+	flags.InitContainerFlags(f)
+	flags.InitRunFlags(f)
+	if err = f.Parse(args); err != nil {
+		return usageError("invalid --start value: " + err.Error())
+	}
+	if err = flags.SetBundleArgs(append([]string{imageId.String()}, f.Args()...)); err != nil {
+		return
+	}
+	service, err := flags.Read()
+	if err != nil {
+		return
+	}
+	res := resourceResolver("", nil)
+	if flags.detach {
+		b, err := createRuntimeBundle(service, res)
+		if err != nil {
+			return err
+		}
+		id := b.ID()
+		if err = b.Close(); err != nil {
+			return err
+		}
+		if err = awaitHostDependencies(service); err != nil {
+			return err
+		}
+		if err = startDetached(id); err != nil {
+			return err
+		}
+		fmt.Println(id)
+		return nil
+	}
+	return runServices([]model.Service{*service}, res)
+}
+
+// Imports build cache entries from a directory or cache image so that a
+// build on an ephemeral host can start with a warm cache
+func importBuildCache(src, cacheDir string, istore image.ImageStoreRW) (err error) {
+	defer exterrors.Wrapd(&err, "import build cache")
+	var rootfs fs.FsNode
+	if fi, e := os.Stat(src); e == nil && fi.IsDir() {
+		rootfs, err = tree.FromDir(src, flagRootless)
+	} else {
+		var img image.Image
+		if img, err = image.GetImage(istore, src); err != nil {
+			return
+		}
+		rootfs, err = istore.FS(img.ID())
+	}
+	if err != nil {
+		return
+	}
+	return writeFsToDir(rootfs, cacheDir)
+}
+
+// Exports the build cache to a directory or tags it as image in the local
+// store from where it can be pushed to a registry
+func exportBuildCache(cacheDir, dest string, istore image.ImageStoreRW) (err error) {
+	defer exterrors.Wrapd(&err, "export build cache")
+	rootfs, err := tree.FromDir(cacheDir, flagRootless)
+	if err != nil {
+		return
+	}
+	if isFile(dest) {
+		return writeFsToDir(rootfs, dest)
+	}
+	img, err := istore.AddLayer(rootfs, nil, "", "ctnr build cache export")
+	if err != nil {
+		return
+	}
+	_, err = istore.TagImage(img.ID(), dest)
 	return
 }
+
+func writeFsToDir(rootfs fs.FsNode, dir string) (err error) {
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return errors.New(err.Error())
+	}
+	w := writer.NewDirWriter(dir, fs.NewFSOptions(flagRootless), loggers.Warn)
+	if err = rootfs.Write(w); err != nil {
+		return
+	}
+	return w.Close()
+}
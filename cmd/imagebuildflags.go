@@ -16,9 +16,13 @@ package cmd
 
 import (
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	shellwords "github.com/mattn/go-shellwords"
 	"github.com/mgoltzsche/ctnr/image"
 	"github.com/mgoltzsche/ctnr/image/builder"
 	"github.com/mgoltzsche/ctnr/image/builder/dockerfile"
@@ -32,6 +36,14 @@ var (
 	flagImageBuildOps imageBuildFlags
 	flagRm            bool
 	flagRmAll         bool
+	flagBuildPull     string
+	flagCacheFrom     []string
+	flagCacheTo       string
+	flagBuildStart    string
+	flagReproducible  bool
+	flagKeepStages    bool
+	flagSquash        bool
+	flagReuseBundle   bool
 )
 
 type imageBuildFlags struct {
@@ -48,7 +60,7 @@ func initImageBuildFlags(f *pflag.FlagSet) {
 	ops := &flagImageBuildOps
 	f.VarP((*iDockerfile)(ops), "dockerfile", "f", "Builds the dockerfile at the provided path")
 	f.Var((*iDockerfileTarget)(ops), "target", "Specifies the last --dockerfile's build target")
-	f.Var((*iDockerfileArg)(ops), "build-arg", "Specifies the last --dockerfile's build arg")
+	f.Var((*iDockerfileArg)(ops), "build-arg", "Specifies the last --dockerfile's build arg (NAME[=VALUE], value defaults to the caller's env var)")
 	f.Var((*iFromImage)(ops), "from", "Extends the provided parent")
 	f.Var((*iAuthor)(ops), "author", "Sets the new image's author")
 	f.Var((*iLabel)(ops), "label", "Adds labels to the image")
@@ -66,6 +78,14 @@ func initImageBuildFlags(f *pflag.FlagSet) {
 	f.BoolVar(&flagNoCache, "no-cache", false, "Disables caches")
 	f.BoolVar(&flagRm, "rm", true, "Remove intermediate containers after successful build")
 	f.BoolVar(&flagRmAll, "force-rm", false, "Always remove containers after build")
+	f.BoolVar(&flagReuseBundle, "reuse-bundle", false, "Keeps a warm build container per base image and reuses it in subsequent builds to cut per-step startup overhead (implies keeping intermediate containers)")
+	f.StringVar(&flagBuildPull, "pull", "", "Base image pull policy: always|missing|never (default missing)")
+	f.StringSliceVar(&flagCacheFrom, "cache-from", nil, "Imports build cache entries from the given directory or image before the build")
+	f.StringVar(&flagCacheTo, "cache-to", "", "Exports the build cache to the given directory (absolute or ./ path) or image tag after a successful build")
+	f.StringVar(&flagBuildStart, "start", "", "Runs a container from the built image applying the given 'ctnr run' options and command (use an empty string for the image defaults)")
+	f.BoolVar(&flagReproducible, "reproducible", false, "Normalizes layer timestamps and the image creation time (using SOURCE_DATE_EPOCH when set) so that identical inputs yield identical image digests")
+	f.BoolVar(&flagKeepStages, "keep-stages", false, "Tags intermediate build stages (DIRNAME/STAGE:BUILDID) instead of discarding them so they can be inspected, run or used as cache sources and expired using 'image gc --ref-ttl'")
+	f.BoolVar(&flagSquash, "squash", false, "Squashes all of the built image's layers into a single layer")
 }
 
 type iFromImage imageBuildFlags
@@ -115,6 +135,13 @@ func (o *iDockerfile) Set(file string) (err error) {
 				return
 			}
 		}
+		if flagKeepStages {
+			project := filepath.Base(o.dockerfileDir)
+			buildId := strconv.FormatInt(time.Now().Unix(), 10)
+			df.KeepStages(func(stageName string) string {
+				return project + "/" + stageName + ":" + buildId
+			})
+		}
 		b.SetImageResolver(builder.ResolveDockerImage)
 		defer b.SetImageResolver(image.GetImage)
 		return df.Apply(b)
@@ -169,7 +196,26 @@ func (o *iDockerfileArg) Set(kv string) (err error) {
 	if s.dockerfileCtx == nil {
 		return usageError("--dockerfile option must be specified first")
 	}
-	return addMapEntries(kv, &s.dockerfileCtx.args)
+	entries, err := shellwords.Parse(kv)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		sp := strings.SplitN(e, "=", 2)
+		k := strings.Trim(sp[0], " ")
+		if k == "" {
+			return usageError("expected build arg format: NAME[=VALUE]")
+		}
+		if len(sp) == 2 {
+			s.dockerfileCtx.args[k] = sp[1]
+		} else if v, ok := os.LookupEnv(k); ok {
+			// Pass the value of the caller's equally named env var
+			s.dockerfileCtx.args[k] = v
+		} else {
+			loggers.Warn.Printf("build arg %s is neither specified nor set in the environment and therefore omitted", k)
+		}
+	}
+	return
 }
 
 func (o *iDockerfileArg) Type() string {
@@ -0,0 +1,125 @@
+// Copyright © 2017 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/spf13/cobra"
+)
+
+var imageFindCmd = &cobra.Command{
+	Use:   "find FILEPATTERN",
+	Short: "Searches all images for files matching a pattern",
+	Long: `Searches the file system metadata of all images in the local store
+for files matching the provided glob pattern and reports which images
+contain them together with the files' size and content digest.
+A pattern containing a '/' is matched against the whole file path,
+otherwise against the file name only.`,
+	Run: wrapRun(runImageFind),
+}
+
+func init() {
+	imageCmd.AddCommand(imageFindCmd)
+}
+
+func runImageFind(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one FILEPATTERN argument expected")
+	}
+	pattern := args[0]
+	if _, err = filepath.Match(pattern, ""); err != nil {
+		return usageError(fmt.Sprintf("invalid FILEPATTERN %q: %s", pattern, err))
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+	imgs, err := store.Images()
+	if err != nil {
+		return
+	}
+	table := newTableWriter("%-50s  %-35s  %8s  %s\n")
+	table.Header("IMAGE", "PATH", "SIZE", "HASH")
+	for _, img := range imgs {
+		imageFs, e := lockedStore.FS(img.ID())
+		if e != nil {
+			loggers.Warn.Printf("image %s: %s", img.ID(), e)
+			continue
+		}
+		imgName := img.Tag.String()
+		if img.Tag == nil {
+			imgName = img.ID().String()
+		}
+		w := newFindWriter(pattern, imgName)
+		if e = imageFs.Write(w); e != nil {
+			loggers.Warn.Printf("image %s: %s", img.ID(), e)
+			continue
+		}
+		for _, m := range w.matches {
+			table.Row(w.image, m.path, humanize.Bytes(uint64(m.size)), m.hash)
+		}
+	}
+	return
+}
+
+type findMatch struct {
+	path string
+	size int64
+	hash string
+}
+
+// fs.Writer that records all nodes whose path matches a glob pattern.
+// Image fs specs consist of lower nodes only, so matching the lower
+// node callbacks is sufficient.
+type findWriter struct {
+	fs.Writer
+	pattern string
+	image   string
+	matches []findMatch
+}
+
+func newFindWriter(pattern, image string) *findWriter {
+	return &findWriter{fs.HashingNilWriter(), pattern, image, nil}
+}
+
+func (w *findWriter) match(path string) bool {
+	subject := filepath.Base(path)
+	if strings.ContainsRune(w.pattern, '/') {
+		subject = strings.TrimPrefix(path, "/")
+	}
+	matched, _ := filepath.Match(w.pattern, subject)
+	return matched
+}
+
+func (w *findWriter) LowerNode(path, name string, a *fs.NodeAttrs) error {
+	if w.match(path) {
+		w.matches = append(w.matches, findMatch{path, a.Size, a.Hash})
+	}
+	return nil
+}
+
+func (w *findWriter) LowerLink(path, target string, a *fs.NodeAttrs) error {
+	if w.match(path) {
+		w.matches = append(w.matches, findMatch{path, a.Size, a.Hash})
+	}
+	return nil
+}
+
+func (w *findWriter) Parent() error { return nil }
@@ -0,0 +1,93 @@
+// Copyright © 2017 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/containers/image/docker"
+	"github.com/spf13/cobra"
+)
+
+var (
+	imageSearchCmd = &cobra.Command{
+		Use:   "search TERM",
+		Short: "Searches a registry for images",
+		Long: `Searches a registry for images matching the provided term using
+the registry's search API (docker.io) or the v2 _catalog API.`,
+		Run: wrapRun(runImageSearch),
+	}
+	flagSearchRegistry string
+	flagSearchLimit    int
+	flagSearchStars    int
+	flagSearchOfficial bool
+	flagSearchJSON     bool
+)
+
+func init() {
+	f := imageSearchCmd.Flags()
+	f.StringVar(&flagSearchRegistry, "registry", "docker.io", "registry to search")
+	f.IntVarP(&flagSearchLimit, "limit", "l", 25, "max number of search results")
+	f.IntVarP(&flagSearchStars, "stars", "s", 0, "only show results with at least this number of stars")
+	f.BoolVar(&flagSearchOfficial, "official", false, "only show official builds")
+	f.BoolVar(&flagSearchJSON, "json", false, "print search results as JSON")
+	imageCmd.AddCommand(imageSearchCmd)
+}
+
+func runImageSearch(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one TERM argument expected")
+	}
+	results, err := docker.SearchRegistry(context.Background(), systemContext, flagSearchRegistry, args[0], flagSearchLimit)
+	if err != nil {
+		return
+	}
+	filtered := make([]docker.SearchResult, 0, len(results))
+	for _, result := range results {
+		if result.StarCount < flagSearchStars {
+			continue
+		}
+		if flagSearchOfficial && !result.IsOfficial {
+			continue
+		}
+		filtered = append(filtered, result)
+	}
+	if flagSearchJSON {
+		b, e := json.MarshalIndent(filtered, "", "  ")
+		if e != nil {
+			return e
+		}
+		fmt.Fprintln(os.Stdout, string(b))
+		return
+	}
+	w := newTableWriter("%-40s  %6s  %-8s  %s\n")
+	w.Header("NAME", "STARS", "OFFICIAL", "DESCRIPTION")
+	for _, result := range filtered {
+		official := ""
+		if result.IsOfficial {
+			official = "[OK]"
+		}
+		desc := result.Description
+		if len(desc) > 60 {
+			desc = desc[:57] + "..."
+		}
+		w.Row(result.Name, strconv.Itoa(result.StarCount), official, desc)
+	}
+	return
+}
@@ -0,0 +1,111 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containers/image/docker"
+	humanize "github.com/dustin/go-humanize"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	imageTagsCmd = &cobra.Command{
+		Use:   "tags NAME",
+		Short: "Lists a remote repository's tags",
+		Long: `Lists the tags of a remote image repository with manifest digest
+and creation date (when available) without pulling the images.`,
+		Run: wrapRun(runImageTags),
+	}
+	flagTagsLimit int
+	flagTagsLast  string
+	flagTagsQuiet bool
+)
+
+func init() {
+	f := imageTagsCmd.Flags()
+	f.IntVarP(&flagTagsLimit, "limit", "l", 25, "max number of tags per page (0 == unlimited)")
+	f.StringVar(&flagTagsLast, "last", "", "lists only tags after the given one to fetch the next page")
+	f.BoolVar(&flagTagsQuiet, "tags-only", false, "lists tag names only without querying each tag's manifest")
+	imageCmd.AddCommand(imageTagsCmd)
+}
+
+func runImageTags(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one NAME argument expected")
+	}
+	repo := args[0]
+	if li := strings.LastIndex(repo, ":"); li > 0 && !strings.Contains(repo[li+1:], "/") {
+		repo = repo[:li]
+	}
+	ref, err := docker.ParseReference("//" + repo)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	tags, err := docker.GetRepositoryTags(ctx, systemContext, ref)
+	if err != nil {
+		return
+	}
+	sort.Strings(tags)
+	if flagTagsLast != "" {
+		for i, tag := range tags {
+			if tag > flagTagsLast {
+				tags = tags[i:]
+				break
+			}
+			if i == len(tags)-1 {
+				tags = nil
+			}
+		}
+	}
+	truncated := false
+	if flagTagsLimit > 0 && len(tags) > flagTagsLimit {
+		tags = tags[:flagTagsLimit]
+		truncated = true
+	}
+	if flagTagsQuiet {
+		for _, tag := range tags {
+			fmt.Println(tag)
+		}
+	} else {
+		w := newTableWriter("%-20s  %-71s  %s\n")
+		w.Header("TAG", "DIGEST", "CREATED")
+		for _, tag := range tags {
+			d, created := "-", "-"
+			if tagRef, e := docker.ParseReference("//" + repo + ":" + tag); e == nil {
+				if img, e := tagRef.NewImage(ctx, systemContext); e == nil {
+					if raw, _, e := img.Manifest(ctx); e == nil {
+						d = digest.FromBytes(raw).String()
+					}
+					if info, e := img.Inspect(ctx); e == nil && info.Created != nil {
+						created = humanize.Time(*info.Created)
+					}
+					img.Close()
+				}
+			}
+			w.Row(tag, d, created)
+		}
+	}
+	if truncated {
+		loggers.Info.Printf("More tags available - continue with --last %s", tags[len(tags)-1])
+	}
+	return
+}
@@ -0,0 +1,190 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/mgoltzsche/ctnr/pkg/fs/source"
+	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
+	ispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importCmd = &cobra.Command{
+		Use:   "import FILE|- [TAG]",
+		Short: "Imports a rootfs tarball as single-layer image",
+		Long: `Imports a rootfs tarball (optionally gzip compressed, '-' reads a tar
+stream from stdin) as a new single-layer image, mirroring docker
+import. Dockerfile instructions can be applied to the image config
+using --change. Prints the resulting image's ID.`,
+		Run: wrapRun(runImport),
+	}
+	flagImportChanges []string
+)
+
+func init() {
+	importCmd.Flags().StringSliceVarP(&flagImportChanges, "change", "c", nil, "applies a Dockerfile instruction to the image config: CMD|ENTRYPOINT|ENV|EXPOSE|LABEL|USER|VOLUME|WORKDIR|STOPSIGNAL")
+}
+
+func runImport(cmd *cobra.Command, args []string) (err error) {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("FILE argument and optional TAG expected")
+	}
+	file := args[0]
+	if file == "-" {
+		tmp, e := ioutil.TempFile("", ".ctnr-import-")
+		if e != nil {
+			return errors.New(e.Error())
+		}
+		defer os.Remove(tmp.Name())
+		if _, err = io.Copy(tmp, os.Stdin); err != nil {
+			tmp.Close()
+			return errors.New(err.Error())
+		}
+		if err = tmp.Close(); err != nil {
+			return errors.New(err.Error())
+		}
+		file = tmp.Name()
+	}
+	gzipped, err := isGzipped(file)
+	if err != nil {
+		return
+	}
+	var src fs.Source
+	if gzipped {
+		src = source.NewSourceTarGz(file)
+	} else {
+		src = source.NewSourceTar(file)
+	}
+	rootfs := tree.NewFS()
+	if _, err = rootfs.AddUpper(".", src); err != nil {
+		return
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+	img, err := lockedStore.AddLayer(rootfs, nil, "", "ctnr import")
+	if err != nil {
+		return
+	}
+	if len(flagImportChanges) > 0 {
+		conf := img.Config
+		for _, change := range flagImportChanges {
+			if err = applyConfigChange(&conf, change); err != nil {
+				return
+			}
+		}
+		imageId := img.ID()
+		if img, err = lockedStore.AddImageConfig(conf, &imageId); err != nil {
+			return
+		}
+	}
+	if len(args) > 1 {
+		if _, err = lockedStore.TagImage(img.ID(), args[1]); err != nil {
+			return
+		}
+	}
+	fmt.Fprintln(os.Stdout, img.ID())
+	return
+}
+
+func isGzipped(file string) (r bool, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, errors.New(err.Error())
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	if _, err = io.ReadFull(f, magic); err != nil {
+		return false, errors.Wrap(err, "read archive header")
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// Applies a docker import --change style Dockerfile instruction to the
+// image config
+func applyConfigChange(conf *ispecs.Image, change string) (err error) {
+	s := strings.SplitN(strings.TrimSpace(change), " ", 2)
+	arg := ""
+	if len(s) > 1 {
+		arg = strings.TrimSpace(s[1])
+	}
+	switch strings.ToUpper(s[0]) {
+	case "CMD":
+		conf.Config.Cmd, err = toCommand(arg)
+	case "ENTRYPOINT":
+		conf.Config.Entrypoint, err = toCommand(arg)
+	case "ENV":
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			kv = strings.SplitN(arg, " ", 2)
+		}
+		if len(kv) != 2 {
+			return errors.Errorf("invalid ENV change (expected KEY=VALUE): %s", change)
+		}
+		conf.Config.Env = append(conf.Config.Env, kv[0]+"="+strings.TrimSpace(kv[1]))
+	case "EXPOSE":
+		if conf.Config.ExposedPorts == nil {
+			conf.Config.ExposedPorts = map[string]struct{}{}
+		}
+		for _, port := range strings.Fields(arg) {
+			conf.Config.ExposedPorts[port] = struct{}{}
+		}
+	case "LABEL":
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return errors.Errorf("invalid LABEL change (expected KEY=VALUE): %s", change)
+		}
+		if conf.Config.Labels == nil {
+			conf.Config.Labels = map[string]string{}
+		}
+		conf.Config.Labels[kv[0]] = kv[1]
+	case "USER":
+		conf.Config.User = arg
+	case "VOLUME":
+		if conf.Config.Volumes == nil {
+			conf.Config.Volumes = map[string]struct{}{}
+		}
+		conf.Config.Volumes[arg] = struct{}{}
+	case "WORKDIR":
+		conf.Config.WorkingDir = arg
+	case "STOPSIGNAL":
+		conf.Config.StopSignal = arg
+	default:
+		err = errors.Errorf("unsupported --change instruction: %s", change)
+	}
+	return
+}
+
+// Parses a CMD/ENTRYPOINT argument in exec (JSON array) or shell form
+func toCommand(arg string) (r []string, err error) {
+	if strings.HasPrefix(arg, "[") {
+		if err = json.Unmarshal([]byte(arg), &r); err != nil {
+			err = errors.Errorf("invalid command array %s: %s", arg, err)
+		}
+		return
+	}
+	return []string{"/bin/sh", "-c", arg}, nil
+}
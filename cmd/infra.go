@@ -0,0 +1,45 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var infraCmd = &cobra.Command{
+	Use:    "infra",
+	Short:  "Runs a pod's infra pause process (not to be used manually)",
+	Hidden: true,
+	Long: `Runs the pause process of a pod's infra container which holds the
+pod's shared network, IPC and UTS namespaces until it is terminated.
+The infra container is created on demand when a container is run with
+the --pod option or a compose service declares network_mode pod:NAME.`,
+	Run: wrapRun(runInfra),
+}
+
+func runInfra(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("no arguments expected")
+	}
+	// Block until the container is stopped
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+	return
+}
@@ -0,0 +1,104 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mgoltzsche/ctnr/image"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inspectCmd = &cobra.Command{
+		Use:   "inspect [flags] CONTAINERID|IMAGE",
+		Short: "Prints metadata of a container or image",
+		Long: `Prints a container's bundle spec or an image's metadata as JSON.
+With --env-file only the effective environment is printed in dotenv
+format so that it can be sourced by shell scripts or reused with --env-from.`,
+		Run: wrapRun(runInspect),
+	}
+	flagInspectEnvFile bool
+)
+
+func init() {
+	inspectCmd.Flags().BoolVar(&flagInspectEnvFile, "env-file", false, "prints the effective environment in dotenv format")
+}
+
+func runInspect(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one CONTAINERID or IMAGE argument expected")
+	}
+
+	// Inspect container bundle if the argument matches one
+	if b, e := store.Bundle(args[0]); e == nil {
+		spec, err := b.Spec()
+		if err != nil {
+			return err
+		}
+		if flagInspectEnvFile {
+			env := []string{}
+			if spec.Process != nil {
+				env = spec.Process.Env
+			}
+			printDotenv(env)
+			return nil
+		}
+		return printJSON(&spec)
+	}
+
+	// Fall back to image inspection
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+	img, err := image.GetLocalImage(lockedStore, args[0])
+	if err != nil {
+		return
+	}
+	if flagInspectEnvFile {
+		printDotenv(img.Config.Config.Env)
+		return nil
+	}
+	return printJSON(&img.Config)
+}
+
+func printJSON(o interface{}) (err error) {
+	b, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return
+	}
+	fmt.Println(string(b))
+	return
+}
+
+// Writes the given KEY=VALUE pairs in dotenv format,
+// quoting values that a shell would not parse verbatim
+func printDotenv(env []string) {
+	for _, kv := range env {
+		s := strings.SplitN(kv, "=", 2)
+		v := ""
+		if len(s) == 2 {
+			v = s[1]
+		}
+		if strings.ContainsAny(v, " \t\n\"'#$\\") {
+			v = strconv.Quote(v)
+		}
+		fmt.Println(s[0] + "=" + v)
+	}
+}
@@ -39,11 +39,12 @@ var (
 func init() {
 	killCmd.Flags().VarP(&fSignal{&flagSignal}, "signal", "s", "Signal to be sent to container process")
 	killCmd.Flags().BoolVarP(&flagAll, "all", "a", false, "Send the specified signal to all processes inside the container")
+	initSelectorFlag(killCmd)
 }
 
 func runKill(cmd *cobra.Command, args []string) (err error) {
-	if len(args) == 0 {
-		return usageError("At least one container ID argument expected")
+	if len(args) == 0 && len(flagSelector) == 0 {
+		return usageError("At least one container ID argument or --selector expected")
 	}
 
 	containers, err := newContainerManager()
@@ -51,6 +52,16 @@ func runKill(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
+	ids, err := selectedBundleIds(flagSelector)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if exist, e := containers.Exist(id); e == nil && exist {
+			args = append(args, id)
+		}
+	}
+
 	for _, id := range args {
 		if e := containers.Kill(id, flagSignal, flagAll); e != nil {
 			loggers.Debug.Println("Failed to kill container:", e)
@@ -15,7 +15,7 @@
 package cmd
 
 import (
-	"fmt"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -42,10 +42,10 @@ func runList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	// TODO: print pid, created, image (annotation) and ip
-	f := "%-26s  %-10s\n"
-	fmt.Printf(f, "ID", "STATUS")
+	w := newTableWriter("%-26s  %-10s  %8s\n")
+	w.Header("ID", "STATUS", "RESTARTS")
 	for _, c := range l {
-		fmt.Printf(f, c.ID, c.Status)
+		w.StyledRow(statusStyle(c.Status), c.ID, c.Status, strconv.Itoa(readRestartCount(c.ID)))
 	}
 	return nil
 }
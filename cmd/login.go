@@ -0,0 +1,108 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/containers/image/docker"
+	dockerauth "github.com/containers/image/pkg/docker/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var (
+	loginCmd = &cobra.Command{
+		Use:   "login REGISTRY",
+		Short: "Logs in to a registry",
+		Long: `Verifies and stores credentials for a registry
+(docker config.json compatible, supports credential helpers)
+so that subsequent image imports and pushes are authenticated.`,
+		Run: wrapRun(runLogin),
+	}
+	logoutCmd = &cobra.Command{
+		Use:   "logout REGISTRY",
+		Short: "Logs out of a registry",
+		Long:  `Removes the stored credentials for a registry.`,
+		Run:   wrapRun(runLogout),
+	}
+	flagLoginUsername string
+	flagLoginPassword string
+	flagLogoutAll     bool
+)
+
+func init() {
+	loginCmd.Flags().StringVarP(&flagLoginUsername, "username", "u", "", "registry user name")
+	loginCmd.Flags().StringVarP(&flagLoginPassword, "password", "p", "", "registry password (prompted when not provided)")
+	logoutCmd.Flags().BoolVar(&flagLogoutAll, "all", false, "removes the credentials of all registries")
+}
+
+func runLogin(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("REGISTRY argument required")
+	}
+	registry := args[0]
+	username := flagLoginUsername
+	password := flagLoginPassword
+	stdin := bufio.NewReader(os.Stdin)
+	if username == "" {
+		fmt.Print("Username: ")
+		if username, err = stdin.ReadString('\n'); err != nil {
+			return errors.New("read user name: " + err.Error())
+		}
+		username = strings.TrimSpace(username)
+	}
+	if password == "" {
+		fmt.Print("Password: ")
+		pw, err := terminal.ReadPassword(int(syscall.Stdin))
+		fmt.Println()
+		if err != nil {
+			return errors.New("read password: " + err.Error())
+		}
+		password = string(pw)
+	}
+
+	// Verify credentials before storing them
+	if err = docker.CheckAuth(context.Background(), systemContext, username, password, registry); err != nil {
+		return errors.WithMessage(err, "login")
+	}
+	if err = dockerauth.SetAuthentication(systemContext, registry, username, password); err != nil {
+		return errors.WithMessage(err, "store credentials")
+	}
+	fmt.Fprintln(os.Stdout, "Login succeeded")
+	return
+}
+
+func runLogout(cmd *cobra.Command, args []string) (err error) {
+	if flagLogoutAll {
+		if len(args) != 0 {
+			return usageError("No argument expected with --all: " + args[0])
+		}
+		return dockerauth.RemoveAllAuthentication(systemContext)
+	}
+	if len(args) != 1 {
+		return usageError("REGISTRY argument required")
+	}
+	if err = dockerauth.RemoveAuthentication(systemContext, args[0]); err != nil {
+		return errors.WithMessage(err, "logout")
+	}
+	return
+}
@@ -0,0 +1,48 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mgoltzsche/ctnr/run/logs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsCmd = &cobra.Command{
+		Use:   "logs [flags] CONTAINERID",
+		Short: "Prints a container's captured output",
+		Long:  `Prints the stdout/stderr output a container wrote while it was running.`,
+		Run:   wrapRun(runLogs),
+	}
+	flagLogsFollow bool
+	flagLogsTail   int
+)
+
+func init() {
+	f := logsCmd.Flags()
+	f.BoolVarP(&flagLogsFollow, "follow", "f", false, "streams new output lines as they are written")
+	f.IntVar(&flagLogsTail, "tail", 0, "prints only the last n output lines (default all)")
+}
+
+func runLogs(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("CONTAINERID argument required")
+	}
+	logDriver := logs.NewJsonFileDriver(filepath.Join(flagStateDir, "logs"))
+	return logDriver.Read(args[0], os.Stdout, flagLogsTail, flagLogsFollow)
+}
@@ -16,13 +16,17 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/libcni"
 	"github.com/mgoltzsche/ctnr/net"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
 	"github.com/mitchellh/go-homedir"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
@@ -32,10 +36,25 @@ import (
 var (
 	netCmd = &cobra.Command{
 		Use:   "net",
-		Short: "OCI runtime hooks to setup networking (not to be used outside an OCI hook)",
-		Long: `Subcommands below this command support initialization and destruction 
-of container networks and are meant to be declared as hooks of an OCI runtime bundle
-and not executed manually.`,
+		Short: "Manages named networks and provides OCI runtime hooks to setup container networking",
+		Long: `Subcommands below this command manage named networks within the network
+configuration directory (NETCONFPATH) and support initialization and
+destruction of container networks - the latter are meant to be declared
+as hooks of an OCI runtime bundle and not executed manually.`,
+	}
+	netCreateCmd = &cobra.Command{
+		Use:   "create [flags] NETWORK",
+		Short: "Creates a named bridge network",
+		Long: `Creates a named bridge network by materializing a CNI configuration
+file within the network configuration directory (NETCONFPATH) so that
+the network can be referenced by name using the --network option and
+within compose files.`,
+		Run: wrapRun(runNetCreate),
+	}
+	netListCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "Lists the networks declared within NETCONFPATH",
+		Run:   wrapRun(runNetList),
 	}
 	netInitCmd = &cobra.Command{
 		Use:   "init",
@@ -46,21 +65,64 @@ See OCI state spec at https://github.com/opencontainers/runtime-spec/blob/master
 		Run: wrapRun(runNetInit),
 	}
 	netRemoveCmd = &cobra.Command{
-		Use:   "rm",
-		Short: "Removes container networks",
-		Long: `Removes a container's networks.
-The OCI container state JSON is expected on stdin.
-See OCI state spec at https://github.com/opencontainers/runtime-spec/blob/master/runtime.md`,
+		Use:   "rm NETWORK...",
+		Short: "Removes container networks or deletes named networks",
+		Long: `When the OCI container state JSON [1] is provided on stdin (OCI poststop
+hook invocation) the container's networks are removed. When invoked from
+a terminal the named networks are deleted from the network configuration
+directory (NETCONFPATH) instead.
+[1] https://github.com/opencontainers/runtime-spec/blob/master/runtime.md`,
 		Run: wrapRun(runNetRemove),
 	}
+	netPortBindCmd = &cobra.Command{
+		Use:   "portbind [flags] SPEC...",
+		Short: "Binds privileged host ports and forwards them to a container (not to be used manually)",
+		Long: `Runs the privileged port binding helper: binds the given privileged
+host ports - or adopts listeners passed in via systemd socket activation -
+and forwards their connections to the container.
+The helper is started by 'ctnr net init' when a rootless container
+publishes ports <1024 and terminated by 'ctnr net rm'. To grant it the
+required capability install a privileged copy of the ctnr binary (setuid
+root or with the cap_net_bind_service file capability) and point the
+CTNR_PORTBIND_HELPER environment variable at it.`,
+		Run: wrapRun(runNetPortBind),
+	}
+	netSyncDnsCmd = &cobra.Command{
+		Use:   "sync-dns",
+		Short: "Propagates host resolver changes to containers",
+		Long: `Watches the host's resolver configuration and propagates nameserver
+changes (e.g. after Wi-Fi/VPN changes) to the containers' generated
+resolv.conf files so that running containers keep resolving.
+Only the host-derived nameserver section of each file is rewritten.`,
+		Run: wrapRun(runNetSyncDns),
+	}
+	flagDnsSyncInterval time.Duration
+	flagPortBindTarget  string
+	flagPortBindPidFile string
+	flagNetSubnet       string
+	flagNetGateway      string
+	flagNetBridge       string
+	flagNetMasquerade   bool
 )
 
 func init() {
+	netCmd.AddCommand(netCreateCmd)
+	netCmd.AddCommand(netListCmd)
 	netCmd.AddCommand(netInitCmd)
 	netCmd.AddCommand(netRemoveCmd)
+	netCmd.AddCommand(netPortBindCmd)
+	netCmd.AddCommand(netSyncDnsCmd)
 
 	initNetFlags(netInitCmd.Flags())
+	initNetworkOptFlags(netRemoveCmd.Flags())
 	initPortBindFlags(netRemoveCmd.Flags())
+	netCreateCmd.Flags().StringVar(&flagNetSubnet, "subnet", "", "subnet in CIDR notation the network's container IPs are allocated from")
+	netCreateCmd.Flags().StringVar(&flagNetGateway, "gateway", "", "gateway IP within the subnet (derived from the subnet when not set)")
+	netCreateCmd.Flags().StringVar(&flagNetBridge, "bridge", "", "name of the bridge interface created on the host (default ctnr-NETWORK)")
+	netCreateCmd.Flags().BoolVar(&flagNetMasquerade, "masquerade", false, "masquerade the containers' outgoing traffic with the host IP")
+	netPortBindCmd.Flags().StringVar(&flagPortBindTarget, "target", "", "container IP connections are forwarded to")
+	netPortBindCmd.Flags().StringVar(&flagPortBindPidFile, "pid-file", "", "file the helper's pid is written to after all ports are bound")
+	netSyncDnsCmd.Flags().DurationVar(&flagDnsSyncInterval, "interval", 3*time.Second, "host resolv.conf poll interval")
 }
 
 func runNetInit(cmd *cobra.Command, args []string) (err error) {
@@ -78,27 +140,59 @@ func runNetInit(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	netConfigs, err := loadNetConfigs(args)
+	capArgs, err := net.CapabilityArgs(flagNetworkOpts)
 	if err != nil {
 		return
 	}
+	mngr.AddCapabilityArgs(capArgs)
+	cniNets, usePasta := splitPastaNetwork(args)
+	netConfigs, err := loadNetConfigs(cniNets)
+	if err != nil {
+		return
+	}
+	for _, netConf := range netConfigs {
+		if err = net.ValidateCapabilities(netConf, capArgs); err != nil {
+			return
+		}
+	}
+	if len(netConfigs) == 0 && !usePasta && len(flagPorts) > 0 {
+		return errors.New("Cannot publish a port without a container network! Please remove the --publish option or add --network")
+	}
+	if usePasta {
+		if err = net.AddPastaNet(state, flagPorts); err != nil {
+			return
+		}
+	}
 	defer func() {
 		if err != nil {
 			// Free all network resources on error
 			for i, netConf := range netConfigs {
 				mngr.DelNet("cni"+strconv.Itoa(i), netConf)
 			}
+			net.ReleasePrivilegedPorts(state)
 		}
 	}()
 	cfg := net.NewConfigFileGenerator()
+	containerIP := ""
 	for i, netConf := range netConfigs {
 		r, err := mngr.AddNet("cni"+strconv.Itoa(i), netConf)
 		if err != nil {
 			return err
 		}
+		if containerIP == "" && len(r.IPs) > 0 {
+			containerIP = r.IPs[0].Address.IP.String()
+		}
 		cfg.AddCniResult(r)
 	}
 
+	// Privileged host ports cannot be bound by an unprivileged process -
+	// delegate them to the privileged port binding helper
+	if privPorts := net.PrivilegedPorts(flagPorts); len(privPorts) > 0 && flagRootless && len(netConfigs) > 0 {
+		if err = net.BindPrivilegedPorts(state, containerIP, privPorts); err != nil {
+			return
+		}
+	}
+
 	// Generate hostname, hosts, resolv.conf files
 	cfg.SetHostname(spec.Hostname)
 	applyArgs(&cfg)
@@ -118,6 +212,11 @@ func runNetRemove(cmd *cobra.Command, args []string) (err error) {
 		ioutil.WriteFile("/tmp/postrun-error", []byte(out), 0644)
 	}()*/
 
+	// Without the container state JSON on stdin (provided when invoked as
+	// OCI poststop hook) the named networks are deleted from NETCONFPATH
+	if fi, e := os.Stdin.Stat(); e == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		return deleteNetworks(args)
+	}
 	state, err := readContainerState()
 	if err != nil {
 		return
@@ -126,10 +225,22 @@ func runNetRemove(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	netConfigs, err := loadNetConfigs(args)
+	capArgs, err := net.CapabilityArgs(flagNetworkOpts)
+	if err != nil {
+		return
+	}
+	mngr.AddCapabilityArgs(capArgs)
+	cniNets, usePasta := splitPastaNetwork(args)
+	netConfigs, err := loadNetConfigs(cniNets)
 	if err != nil {
 		return
 	}
+	if usePasta {
+		err = net.DelPastaNet(state)
+	}
+	if e := net.ReleasePrivilegedPorts(state); e != nil && err == nil {
+		err = e
+	}
 	for i, netConf := range netConfigs {
 		// TODO: Check that/when/how /etc/lib/cni/networks/<net>/last_reserved_ip is reset
 		if e := mngr.DelNet("cni"+strconv.Itoa(i), netConf); e != nil && err == nil {
@@ -139,6 +250,140 @@ func runNetRemove(cmd *cobra.Command, args []string) (err error) {
 	return
 }
 
+func runNetCreate(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("expected exactly one NETWORK argument")
+	}
+	confDir, err := getNetConfPath()
+	if err != nil {
+		return
+	}
+	return net.NewNetworkStore(confDir).Create(args[0], net.NetworkOptions{
+		Subnet:     flagNetSubnet,
+		Gateway:    flagNetGateway,
+		BridgeName: flagNetBridge,
+		Masquerade: flagNetMasquerade,
+	})
+}
+
+func runNetList(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("no arguments expected")
+	}
+	confDir, err := getNetConfPath()
+	if err != nil {
+		return
+	}
+	l, err := net.NewNetworkStore(confDir).List()
+	if err != nil {
+		return
+	}
+	f := "%-20s  %-25s  %s\n"
+	fmt.Printf(f, "NETWORK", "PLUGINS", "FILE")
+	for _, n := range l {
+		fmt.Printf(f, n.Name, strings.Join(n.Plugins, ","), n.File)
+	}
+	return
+}
+
+// Deletes the named networks from the network configuration directory
+func deleteNetworks(networks []string) (err error) {
+	if len(networks) == 0 {
+		return usageError("no network specified")
+	}
+	confDir, err := getNetConfPath()
+	if err != nil {
+		return
+	}
+	store := net.NewNetworkStore(confDir)
+	for _, name := range networks {
+		if e := store.Delete(name); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// Runs the privileged port binding helper (see 'ctnr net portbind --help')
+func runNetPortBind(cmd *cobra.Command, args []string) (err error) {
+	if len(args) == 0 {
+		return usageError("No port binding argument provided")
+	}
+	if flagPortBindTarget == "" {
+		return usageError("No --target provided")
+	}
+	return net.RunPortBindHelper(flagPortBindTarget, flagPortBindPidFile, args)
+}
+
+// Separates the built-in pasta network backend from the CNI network names
+func splitPastaNetwork(networks []string) (cniNets []string, usePasta bool) {
+	cniNets = make([]string, 0, len(networks))
+	for _, name := range networks {
+		if name == net.PastaNetwork {
+			usePasta = true
+		} else {
+			cniNets = append(cniNets, name)
+		}
+	}
+	return
+}
+
+// Polls the host's resolver configuration and rewrites the host-derived
+// nameserver section of every bundle's generated resolv.conf on change.
+func runNetSyncDns(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("No args expected")
+	}
+	hostResolvConf := net.HostResolvConfFile()
+	loggers.Info.Printf("Watching %s", hostResolvConf)
+	var last []string
+	for {
+		nameservers, e := net.ReadNameservers(hostResolvConf)
+		if e != nil {
+			loggers.Warn.Println(e)
+		} else if changed(last, nameservers) {
+			if last != nil {
+				loggers.Info.Printf("Host nameservers changed: %s", strings.Join(nameservers, " "))
+			}
+			if e = syncBundleDns(nameservers); e != nil {
+				loggers.Warn.Println(e)
+			} else {
+				last = nameservers
+			}
+		}
+		time.Sleep(flagDnsSyncInterval)
+	}
+}
+
+func syncBundleDns(nameservers []string) (err error) {
+	bundles, err := store.Bundles()
+	if err != nil {
+		return
+	}
+	for _, b := range bundles {
+		file := filepath.Join(b.Dir(), "mount", "etc", "resolv.conf")
+		updated, e := net.UpdateHostDnsSection(file, nameservers)
+		if e != nil {
+			err = exterrors.Append(err, e)
+		} else if updated {
+			loggers.Debug.Printf("Updated nameservers of bundle %s", b.ID())
+		}
+	}
+	return
+}
+
+func changed(a, b []string) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for i, s := range a {
+		if s != b[i] {
+			return true
+		}
+	}
+	return false
+}
+
 func applyArgs(cfg *net.ConfigFileGenerator) {
 	if flagHostname != "" {
 		cfg.SetHostname(flagHostname)
@@ -159,13 +404,10 @@ func loadNetConfigs(args []string) (r []*libcni.NetworkConfigList, err error) {
 	if err != nil {
 		return
 	}
-	if len(args) == 0 && len(flagPorts) > 0 {
-		return nil, errors.New("Cannot publish a port without a container network! Please remove the --publish option or add --network")
-	}
 	networks := net.NewNetConfigs(netConfPath)
 	r = make([]*libcni.NetworkConfigList, len(args))
 	for i, name := range args {
-		cfg, err := networks.GetConfig(name)
+		cfg, err := networks.GetConfig(name, flagNetworkOpts)
 		if err != nil {
 			return nil, err
 		}
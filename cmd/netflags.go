@@ -30,6 +30,7 @@ var (
 	flagDnsOptions   []string
 	flagHostsEntries []hostsEntry
 	flagPorts        []net.PortMapEntry
+	flagNetworkOpts  map[string]string
 )
 
 func initPortBindFlags(f *pflag.FlagSet) {
@@ -43,9 +44,14 @@ func initNetFlags(f *pflag.FlagSet) {
 	f.StringSliceVar(&flagDnsSearch, "dns-search", nil, "DNS search domains to write in container's /etc/resolv.conf")
 	f.StringSliceVar(&flagDnsOptions, "dns-opts", nil, "DNS search options to write in container's /etc/resolv.conf")
 	f.Var((*fExtraHosts)(&flagHostsEntries), "hosts-entry", "additional entries to write in container's /etc/hosts")
+	initNetworkOptFlags(f)
 	initPortBindFlags(f)
 }
 
+func initNetworkOptFlags(f *pflag.FlagSet) {
+	f.Var((*fNetworkOpts)(&flagNetworkOpts), "network-opt", "options passed to the container's networks, e.g. device=eth1")
+}
+
 type hostsEntry struct {
 	name string
 	ip   string
@@ -75,6 +81,20 @@ func (c *fExtraHosts) String() string {
 	return s
 }
 
+type fNetworkOpts map[string]string
+
+func (c *fNetworkOpts) Set(s string) error {
+	return addMapEntries(s, (*map[string]string)(c))
+}
+
+func (c *fNetworkOpts) Type() string {
+	return "NAME=VALUE..."
+}
+
+func (c *fNetworkOpts) String() string {
+	return mapToString((map[string]string)(*c))
+}
+
 type fPortBinding []net.PortMapEntry
 
 func (c *fPortBinding) Set(s string) error {
@@ -0,0 +1,87 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ANSI styles shared by the list/status commands
+const (
+	styleReset  = "\033[0m"
+	styleBold   = "\033[1m"
+	styleRed    = "\033[31m"
+	styleGreen  = "\033[32m"
+	styleYellow = "\033[33m"
+)
+
+// Returns true when ANSI styles should be applied to stdout.
+// Styling is disabled with the --no-color option, a set NO_COLOR env var
+// (see https://no-color.org) or when stdout is not a terminal.
+func useColor() bool {
+	if flagNoColor {
+		return false
+	}
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return false
+	}
+	return terminal.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Writes column-aligned table rows to stdout applying consistent styling
+// across the list/status commands. The style is applied to whole rows so
+// that the escape sequences do not interfere with the column widths.
+type tableWriter struct {
+	format string
+	color  bool
+}
+
+func newTableWriter(format string) *tableWriter {
+	return &tableWriter{format, useColor()}
+}
+
+func (t *tableWriter) Header(cells ...interface{}) {
+	t.StyledRow(styleBold, cells...)
+}
+
+func (t *tableWriter) Row(cells ...interface{}) {
+	fmt.Printf(t.format, cells...)
+}
+
+func (t *tableWriter) StyledRow(style string, cells ...interface{}) {
+	if !t.color || style == "" {
+		t.Row(cells...)
+		return
+	}
+	fmt.Print(style)
+	fmt.Printf(t.format, cells...)
+	fmt.Print(styleReset)
+}
+
+// Maps a container status to the style its table row is displayed with
+func statusStyle(status string) string {
+	switch status {
+	case "running", "healthy":
+		return styleGreen
+	case "created", "creating", "paused", "pausing", "starting":
+		return styleYellow
+	case "stopped", "destroyed", "unhealthy":
+		return styleRed
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pauseCmd = &cobra.Command{
+		Use:   "pause CONTAINERID...",
+		Short: "Suspends all processes within one or more containers",
+		Long:  `Suspends all processes within one or more containers using the freezer cgroup.`,
+		Run:   wrapRun(runPause),
+	}
+	unpauseCmd = &cobra.Command{
+		Use:   "unpause CONTAINERID...",
+		Short: "Resumes all processes within one or more paused containers",
+		Long:  `Resumes all processes within one or more paused containers.`,
+		Run:   wrapRun(runUnpause),
+	}
+)
+
+func runPause(cmd *cobra.Command, args []string) (err error) {
+	return pauseContainers(args, true)
+}
+
+func runUnpause(cmd *cobra.Command, args []string) (err error) {
+	return pauseContainers(args, false)
+}
+
+func pauseContainers(ids []string, pause bool) (err error) {
+	if len(ids) == 0 {
+		return usageError("At least one container ID argument expected")
+	}
+	containers, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		var e error
+		if pause {
+			e = containers.Pause(id)
+		} else {
+			e = containers.Resume(id)
+		}
+		err = exterrors.Append(err, e)
+	}
+	return
+}
@@ -0,0 +1,128 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	humanize "github.com/dustin/go-humanize"
+	istore "github.com/mgoltzsche/ctnr/image/store"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Creates the pull progress reporter: terminal progress bars on a tty,
+// containers/image's plain status lines otherwise and nothing when quiet.
+func newProgressReporter(quiet bool) istore.ProgressReporter {
+	if quiet {
+		return istore.NopProgressReporter()
+	}
+	if terminal.IsTerminal(int(os.Stdout.Fd())) {
+		return &progressBars{out: os.Stdout, index: map[digest.Digest]*blobProgress{}}
+	}
+	return istore.NewPlainProgressReporter(os.Stdout)
+}
+
+// Renders one terminal progress bar line per pulled blob.
+type progressBars struct {
+	mutex    sync.Mutex
+	out      *os.File
+	blobs    []*blobProgress
+	index    map[digest.Digest]*blobProgress
+	rendered int
+}
+
+type blobProgress struct {
+	blob   digest.Digest
+	offset int64
+	size   int64
+	done   bool
+}
+
+func (p *progressBars) Progress(blob digest.Digest, offset int64, size int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	b := p.index[blob]
+	if b == nil {
+		b = &blobProgress{blob: blob, size: -1}
+		p.index[blob] = b
+		p.blobs = append(p.blobs, b)
+	}
+	if offset > b.offset {
+		b.offset = offset
+	}
+	if size > 0 {
+		b.size = size
+	}
+	if b.size > 0 && b.offset >= b.size {
+		b.done = true
+	}
+	p.render()
+}
+
+func (p *progressBars) Done(blob digest.Digest) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if b := p.index[blob]; b != nil {
+		b.done = true
+		if b.size > 0 {
+			b.offset = b.size
+		}
+		p.render()
+	}
+}
+
+func (p *progressBars) ReportWriter() io.Writer {
+	return ioutil.Discard
+}
+
+func (p *progressBars) render() {
+	// Move the cursor up to overwrite the previously rendered bars
+	if p.rendered > 0 {
+		fmt.Fprintf(p.out, "\033[%dA", p.rendered)
+	}
+	for _, b := range p.blobs {
+		fmt.Fprintf(p.out, "\r\033[K  %.13s [%-30s] %s\n", b.blob.Hex(), bar(b, 30), sizeInfo(b))
+	}
+	p.rendered = len(p.blobs)
+}
+
+func bar(b *blobProgress, width int) string {
+	filled := 0
+	if b.done {
+		filled = width
+	} else if b.size > 0 {
+		filled = int(int64(width) * b.offset / b.size)
+		if filled > width {
+			filled = width
+		}
+	}
+	s := make([]byte, filled)
+	for i := range s {
+		s[i] = '='
+	}
+	return string(s)
+}
+
+func sizeInfo(b *blobProgress) string {
+	if b.size > 0 {
+		return humanize.Bytes(uint64(b.offset)) + " / " + humanize.Bytes(uint64(b.size))
+	}
+	return humanize.Bytes(uint64(b.offset))
+}
@@ -0,0 +1,78 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Executes the invoked command on the --host machine's ctnr via SSH,
+// forwarding all CLI arguments except the --host option itself as well as
+// the process' stdio, and terminates this process with the remote command's
+// exit code. This way containers on servers can be managed with the local
+// CLI UX without requiring an additional daemon on the server.
+func execRemote(cmd *cobra.Command, host string) {
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+		exitOnError(cmd, usageError("invalid --host value (expected format: ssh://[USER@]HOST[:PORT]): "+host))
+	}
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	args := []string{}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, target, "ctnr")
+	args = append(args, stripHostArg(os.Args[1:])...)
+
+	c := exec.Command("ssh", args...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err = c.Run(); err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				os.Exit(status.ExitStatus())
+			}
+		}
+		exitOnError(cmd, errors.Wrap(err, "remote host"))
+	}
+	os.Exit(0)
+}
+
+// Removes the --host option from the given argument list
+func stripHostArg(args []string) (r []string) {
+	r = make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--host" {
+			i++ // also skip the option's value
+			continue
+		}
+		if strings.HasPrefix(args[i], "--host=") {
+			continue
+		}
+		r = append(r, args[i])
+	}
+	return
+}
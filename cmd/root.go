@@ -15,8 +15,10 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/mgoltzsche/ctnr/pkg/log"
 	"github.com/mgoltzsche/ctnr/pkg/log/logrusadapt"
@@ -32,20 +34,32 @@ import (
 	istore "github.com/mgoltzsche/ctnr/image/store"
 	storepkg "github.com/mgoltzsche/ctnr/store"
 	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
 var (
 	flagRootless    = os.Geteuid() != 0
 	flagPRootPath   = findPRootBinary()
+	flagHost        string
+	flagAuditLog    string
 	flagVerbose     bool
 	flagCfgFile     string
-	flagStoreDir    string
-	flagStateDir    string
-	flagImagePolicy string
+	flagStoreProfile string
+	flagStoreDir     string
+	flagTempDir      string
+	flagStateDir     string
+	flagStateBackend string
+	flagImagePolicy  string
+	flagPullJobs     int
+	flagQuiet        bool
+	flagPlatform     string
+	flagLocalOnly    bool
+	flagNoColor      bool
 
 	store            storepkg.Store
 	lockedImageStore image.ImageStoreRW
+	systemContext    *types.SystemContext
 	loggers          log.Loggers
 	logger           *logrus.Logger
 )
@@ -65,14 +79,35 @@ func Execute() {
 	RootCmd.AddCommand(runCmd)
 	RootCmd.AddCommand(execCmd)
 	RootCmd.AddCommand(killCmd)
+	RootCmd.AddCommand(pauseCmd)
+	RootCmd.AddCommand(unpauseCmd)
+	RootCmd.AddCommand(waitCmd)
+	RootCmd.AddCommand(checkpointCmd)
+	RootCmd.AddCommand(restoreCmd)
 	RootCmd.AddCommand(listCmd)
+	RootCmd.AddCommand(inspectCmd)
+	RootCmd.AddCommand(diffCmd)
+	RootCmd.AddCommand(statsCmd)
+	RootCmd.AddCommand(logsCmd)
+	RootCmd.AddCommand(attachCmd)
 	RootCmd.AddCommand(imageCmd)
 	RootCmd.AddCommand(imageBuildCmd)
 	RootCmd.AddCommand(bundleCmd)
+	RootCmd.AddCommand(volumeCmd)
+	RootCmd.AddCommand(storeCmd)
 	RootCmd.AddCommand(composeCmd)
 	RootCmd.AddCommand(netCmd)
+	RootCmd.AddCommand(infraCmd)
 	RootCmd.AddCommand(commitCmd)
+	RootCmd.AddCommand(loginCmd)
+	RootCmd.AddCommand(logoutCmd)
+	RootCmd.AddCommand(snapshotCmd)
+	RootCmd.AddCommand(cloneCmd)
+	RootCmd.AddCommand(exportCmd)
+	RootCmd.AddCommand(importCmd)
 	RootCmd.AddCommand(gcCmd)
+	RootCmd.AddCommand(systemCmd)
+	RootCmd.AddCommand(completionCmd)
 	if err := RootCmd.Execute(); err != nil {
 		loggers.Error.Println(err)
 		os.Exit(1)
@@ -109,12 +144,23 @@ func init() {
 		flagImagePolicy = policyFile
 	}
 	f := RootCmd.PersistentFlags()
+	f.StringVar(&flagHost, "host", "", "runs the command on a remote host's ctnr via SSH (format: ssh://[USER@]HOST[:PORT])")
+	f.StringVar(&flagAuditLog, "audit-log", "", "append-only file privileged operations are logged to")
 	f.BoolVar(&flagVerbose, "verbose", false, "enables verbose log output")
 	f.BoolVar(&flagRootless, "rootless", flagRootless, "enables image and container management as unprivileged user")
 	f.StringVar(&flagPRootPath, "proot-path", flagPRootPath, "proot binary location")
+	f.StringVar(&flagCfgFile, "config", "", "config file declaring store profiles (default is $HOME/.ctnr.json)")
+	f.StringVar(&flagStoreProfile, "store", "", "applies the named store profile from the config file")
 	f.StringVar(&flagStoreDir, "store-dir", flagStoreDir, "directory to store images and containers")
+	f.StringVar(&flagTempDir, "temp-dir", "", "directory to store temporary files (default is .temp within the store directory; must be on the store's filesystem)")
 	f.StringVar(&flagStateDir, "state-dir", flagStateDir, "directory to store OCI container states (should be tmpfs)")
+	f.StringVar(&flagStateBackend, "state-backend", "auto", "container state backend: 'tmpfs' (below /run), 'dir' (plain directory within the store) or 'auto' (tmpfs with fallback to dir when /run is unavailable)")
 	f.StringVar(&flagImagePolicy, "image-policy", flagImagePolicy, "image trust policy configuration file or 'insecure'")
+	f.IntVar(&flagPullJobs, "pull-jobs", 4, "number of concurrent layer downloads during an image pull")
+	f.StringVar(&flagPlatform, "platform", "", "platform (os/arch[/variant]) to select from multi-arch images (default: host platform)")
+	f.BoolVarP(&flagQuiet, "quiet", "q", false, "suppresses image pull progress output")
+	f.BoolVar(&flagLocalOnly, "local-only", false, "strict offline mode: fails any operation that requires registry access")
+	f.BoolVar(&flagNoColor, "no-color", false, "disables colorized output (also disabled by the NO_COLOR env var or when stdout is no terminal)")
 }
 
 func preRun(cmd *cobra.Command, args []string) {
@@ -122,18 +168,39 @@ func preRun(cmd *cobra.Command, args []string) {
 		loggers.Debug = logrusadapt.NewDebugLogger(logger)
 	}
 
+	if flagHost != "" {
+		// Run the command on the remote host instead (does not return)
+		execRemote(cmd, flagHost)
+	}
+
+	exitOnError(cmd, applyConfig())
+	if flagStoreProfile != "" {
+		exitOnError(cmd, applyStoreProfile(cmd, flagStoreProfile))
+	}
+
 	// init store
 	// TODO: provide CLI options
-	ctx := &types.SystemContext{
+	systemContext = &types.SystemContext{
 		RegistriesDirPath:           "",
 		DockerCertPath:              "",
 		DockerInsecureSkipTLSVerify: true,
 		OSTreeTmpDirPath:            "ostree-tmp-dir",
-		// TODO: add docker auth
-		//DockerAuthConfig: dockerAuth,
+		// registry credentials are read from the credential store
+		// maintained by the login/logout commands
 	}
-	if flagRootless && ctx.DockerCertPath == "" {
-		ctx.DockerCertPath = "./docker-certs"
+	if flagRootless && systemContext.DockerCertPath == "" {
+		systemContext.DockerCertPath = "./docker-certs"
+	}
+	if flagPlatform != "" {
+		// Select the matching manifest from multi-arch image indexes.
+		// The optional variant is accepted but not matched since manifest
+		// list resolution only considers os and architecture.
+		platform := strings.SplitN(flagPlatform, "/", 3)
+		if len(platform) < 2 || platform[0] == "" || platform[1] == "" {
+			exitOnError(cmd, usageError("invalid --platform value (expected os/arch[/variant]): "+flagPlatform))
+		}
+		systemContext.OSChoice = platform[0]
+		systemContext.ArchitectureChoice = platform[1]
 	}
 
 	var (
@@ -143,14 +210,58 @@ func preRun(cmd *cobra.Command, args []string) {
 	if flagImagePolicy == "reject" {
 		imagePolicy = istore.TrustPolicyReject()
 	} else if flagImagePolicy == "insecure" {
+		audit("image-policy-override", "insecure")
 		imagePolicy = istore.TrustPolicyInsecure()
 	} else if flagImagePolicy != "" {
 		imagePolicy = istore.TrustPolicyFromFile(flagImagePolicy)
 	} else {
 		exitOnError(cmd, usageError("empty value for --image-policy option"))
 	}
-	store, err = storepkg.NewStore(flagStoreDir, flagRootless, ctx, imagePolicy, loggers)
+	store, err = storepkg.NewStore(flagStoreDir, flagTempDir, flagPullJobs, newProgressReporter(flagQuiet), flagRootless, systemContext, imagePolicy, loggers)
 	exitOnError(cmd, err)
+	exitOnError(cmd, resolveStateDir(cmd))
+}
+
+// Resolves the container state directory according to --state-backend.
+// The tmpfs backend requires the configured state dir (usually below /run) to
+// be writeable while the dir backend keeps the state in a plain directory
+// within the store so that ctnr also works in environments with a read-only
+// or missing /run (e.g. within containers or on some distros).
+func resolveStateDir(cmd *cobra.Command) (err error) {
+	dirFallback := filepath.Join(flagStoreDir, "state")
+	switch flagStateBackend {
+	case "tmpfs":
+		err = ensureWritableDir(flagStateDir)
+	case "dir":
+		if !cmd.Root().PersistentFlags().Changed("state-dir") {
+			flagStateDir = dirFallback
+		}
+		err = ensureWritableDir(flagStateDir)
+	case "auto":
+		if e := ensureWritableDir(flagStateDir); e != nil {
+			loggers.Warn.Printf("state dir %s is not writeable (%s), falling back to %s", flagStateDir, e, dirFallback)
+			flagStateDir = dirFallback
+			err = ensureWritableDir(flagStateDir)
+		}
+	default:
+		err = usageError("invalid --state-backend value: " + flagStateBackend)
+	}
+	return
+}
+
+func ensureWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return errors.New(err.Error())
+	}
+	probe, err := ioutil.TempFile(dir, ".probe-")
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	probe.Close()
+	if err = os.Remove(probe.Name()); err != nil {
+		return errors.New(err.Error())
+	}
+	return nil
 }
 
 func findPRootBinary() string {
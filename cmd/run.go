@@ -15,8 +15,18 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/mgoltzsche/ctnr/bundle"
 	"github.com/mgoltzsche/ctnr/model"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var (
@@ -26,6 +36,7 @@ var (
 		Long:  `Runs a container.`,
 		Run:   wrapRun(runRun),
 	}
+	flagRunSpecFile string
 
 /*
 	TODO:
@@ -36,34 +47,104 @@ var (
 func init() {
 	flagsBundle.InitContainerFlags(runCmd.Flags())
 	flagsBundle.InitRunFlags(runCmd.Flags())
+	runCmd.Flags().StringVar(&flagRunSpecFile, "spec-file", "", "reads the service declaration (a single compose service as YAML or JSON) from the given file instead of image and container flags")
 }
 
 func runRun(cmd *cobra.Command, args []string) (err error) {
-	argSet := split(args, "---")
-	services := make([]model.Service, 0, len(argSet))
-	if err := flagsBundle.SetBundleArgs(argSet[0]); err != nil {
-		return err
-	}
-	service, err := flagsBundle.Read()
-	if err != nil {
-		return
-	}
-	services = append(services, *service)
-	for _, a := range argSet[1:] {
-		if err = cmd.Flags().Parse(a); err != nil {
-			return usageError(err.Error())
+	resDir := ""
+	var services []model.Service
+	if flagRunSpecFile != "" {
+		if len(args) > 0 {
+			return usageError("--spec-file cannot be combined with IMAGE args")
+		}
+		service, err := loadServiceSpec(flagRunSpecFile)
+		if err != nil {
+			return err
 		}
-		if err = flagsBundle.SetBundleArgs(cmd.Flags().Args()); err != nil {
-			return
+		services = []model.Service{*service}
+		// Resolve relative bind mount sources against the spec file's directory
+		if resDir, err = filepath.Abs(filepath.Dir(flagRunSpecFile)); err != nil {
+			return errors.New(err.Error())
 		}
-		service, e := flagsBundle.Read()
-		if e != nil {
-			return
+	} else {
+		argSet := split(args, "---")
+		services = make([]model.Service, 0, len(argSet))
+		if err := flagsBundle.SetBundleArgs(argSet[0]); err != nil {
+			return err
+		}
+		service, err := flagsBundle.Read()
+		if err != nil {
+			return err
 		}
 		services = append(services, *service)
+		for _, a := range argSet[1:] {
+			if err = cmd.Flags().Parse(a); err != nil {
+				return usageError(err.Error())
+			}
+			if err = flagsBundle.SetBundleArgs(cmd.Flags().Args()); err != nil {
+				return err
+			}
+			service, e := flagsBundle.Read()
+			if e != nil {
+				return e
+			}
+			services = append(services, *service)
+		}
 	}
 
-	return runServices(services, resourceResolver("", nil))
+	res := resourceResolver(resDir, nil)
+
+	if flagsBundle.detach {
+		// Create the bundles and hand them over to detached supervisor processes
+		for _, s := range services {
+			var b *bundle.LockedBundle
+			if b, err = createRuntimeBundle(&s, res); err != nil {
+				return
+			}
+			id := b.ID()
+			if err = b.Close(); err != nil {
+				return
+			}
+			if err = awaitHostDependencies(&s); err != nil {
+				return
+			}
+			if err = startDetached(id); err != nil {
+				return
+			}
+			fmt.Println(id)
+		}
+		return
+	}
+
+	return runServices(services, res)
+}
+
+// Reads a declarative service definition (YAML or JSON, equivalent to a
+// single compose service) from the given file. The service name defaults
+// to the file's base name.
+func loadServiceSpec(file string) (s *model.Service, err error) {
+	defer exterrors.Wrapdf(&err, "load spec file %s", file)
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	var v interface{}
+	if err = yaml.Unmarshal(b, &v); err != nil {
+		return nil, errors.New(err.Error())
+	}
+	// The model provides json tags only - convert the yaml representation
+	if b, err = json.Marshal(jsonCompat(v)); err != nil {
+		return nil, errors.New(err.Error())
+	}
+	name := filepath.Base(file)
+	service := model.NewService(strings.TrimSuffix(name, filepath.Ext(name)))
+	if err = json.Unmarshal(b, &service); err != nil {
+		return nil, errors.New(err.Error())
+	}
+	if service.Image == "" && service.Build == nil {
+		return nil, errors.New("neither image nor build declared")
+	}
+	return &service, nil
 }
 
 func split(args []string, sep string) [][]string {
@@ -16,8 +16,11 @@ package cmd
 
 import (
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mgoltzsche/ctnr/bundle"
 	"github.com/mgoltzsche/ctnr/model"
 	"github.com/mgoltzsche/ctnr/net"
 	"github.com/pkg/errors"
@@ -28,15 +31,31 @@ var flagsBundle = bundleFlags{}
 
 type bundleFlags struct {
 	netCfg
-	update       bool
-	stdin        bool
-	tty          bool
-	readonly     bool
-	privileged   bool
-	noPivot      bool
-	noNewKeyring bool
-	proot        bool
-	app          *model.Service
+	update          bool
+	deterministicId bool
+	mountCreate     string
+	detach          bool
+	healthInterval  time.Duration
+	healthTimeout   time.Duration
+	healthRetries   uint
+	waitFor         []string
+	waitTimeout     time.Duration
+	stdin           bool
+	tty             bool
+	readonly        bool
+	privileged      bool
+	noPivot         bool
+	noNewKeyring    bool
+	noWrapper       bool
+	clockOffset     time.Duration
+	intelRdtL3      string
+	pod             string
+	proot           bool
+	rootfsOverlay   bool
+	rootfsClone     string
+	rootfsSquashfs  bool
+	pull            string
+	app             *model.Service
 }
 
 func (c *bundleFlags) InitContainerFlags(f *pflag.FlagSet) {
@@ -45,20 +64,48 @@ func (c *bundleFlags) InitContainerFlags(f *pflag.FlagSet) {
 	f.BoolVar(&c.update, "rm", false, "alias for update")
 	f.MarkHidden("rm") // docker compatibility
 	f.VarP((*cBundle)(c), "bundle", "b", "bundle name or directory")
+	f.BoolVar(&c.deterministicId, "deterministic-id", false, "derives the bundle ID from the container name and options instead of generating a random one (enables idempotent re-invocation)")
 	c.InitProcessFlags(f)
-	f.Var((*cSeccomp)(c), "seccomp", "seccomp profile file or 'default' or 'unconfined'")
+	f.Var((*cEnvFrom)(c), "env-from", "copies the environment of the given image into the container")
+	f.StringVar(&c.pull, "pull", "", "image pull policy: always|missing|never (default missing)")
+	f.Var((*cSeccomp)(c), "seccomp", "seccomp profile file or 'default', 'unconfined', 'audit-log' or 'block-network'")
 	f.Var((*cMountCgroups)(c), "mount-cgroups", "mounts the host's cgroups with the given option: ro|rw|no")
 	f.Var((*cMount)(c), "mount", "mounts a volume: type=T,src=S,dst=D,opt=O")
 	f.VarP((*cVolumeMount)(c), "volume", "v", "bind mounts a volume: TARGET|SOURCE:TARGET[:OPTIONS]")
+	f.Var((*cDevice)(c), "device", "adds a host device to the container: HOSTPATH[:CONTAINERPATH][:PERMISSIONS]")
 	f.MarkHidden("volume")
+	f.StringVar(&c.mountCreate, "mount-create", "error", "creates missing bind mount sources: error|dir|file (overridable per mount using the create/create-dir/create-file option)")
 	f.Var((*cExpose)(c), "expose", "container ports to be exposed")
+	f.Var((*cLabel)(c), "label", "adds labels to the container (matchable with --selector)")
+	f.Var((*cCpuShares)(c), "cpu-shares", "container cpu shares (relative weight, requires root)")
+	f.Var((*cIONice)(c), "ionice", "io scheduling class for the container process: 0-3")
+	f.Var((*cMemory)(c), "memory", "container memory limit (format: NUM[k|m|g], requires root)")
+	f.Var((*cMemorySwap)(c), "memory-swap", "total memory+swap limit (format: NUM[k|m|g], -1 == unlimited swap, requires root)")
+	f.Var((*cCpus)(c), "cpus", "number of cpus the container may fully utilize (requires root)")
+	f.Var((*cPidsLimit)(c), "pids-limit", "container process number limit (-1 == unlimited, requires root)")
+	f.Var((*cHugepageLimit)(c), "hugepage-limit", "container hugepage usage limit: PAGESIZE=LIMITBYTES, e.g. 2MB=1073741824 (requires root and host hugepage support)")
+	f.StringVar(&c.intelRdtL3, "intel-rdt-l3", "", "Intel RDT L3 cache allocation schema (CAT) for the container, e.g. 'L3:0=f0;1=f' (requires root and mounted resctrl fs)")
+	f.Var((*cRestart)(c), "restart", "restart policy applied by the container's supervisor: no|on-failure|always|unless-stopped")
+	f.Var((*cHealthCheck)(c), "healthcheck", "container health probe: SHELLCMD|tcp://HOST:PORT|http://URL")
+	f.DurationVar(&c.healthInterval, "healthcheck-interval", 0, "time between health probes")
+	f.DurationVar(&c.healthTimeout, "healthcheck-timeout", 0, "time after which a single health probe fails")
+	f.UintVar(&c.healthRetries, "healthcheck-retries", 0, "number of failed probes after which the container counts as unhealthy")
+	f.StringSliceVar(&c.waitFor, "wait-for", nil, "delays the container start until the host dependency (HOST:PORT or unix socket path) accepts connections")
+	f.DurationVar(&c.waitTimeout, "wait-timeout", 0, "time after which waiting for host dependencies fails (default 10s)")
+	f.BoolVar(&c.noWrapper, "no-wrapper", false, "opts the container out of the entrypoint wrapper configured in the config file")
+	f.DurationVar(&c.clockOffset, "clock-offset", 0, "shifts the container's monotonic and boot-time clocks by the given offset within its own time namespace (requires kernel >=5.6)")
+	f.StringVar(&c.pod, "pod", "", "runs the container within the named pod, joining its shared network, IPC and UTS namespaces (the pod's infra container is created on demand)")
 	f.BoolVar(&c.readonly, "readonly", false, "mounts the root file system in read only mode")
 	f.BoolVar(&c.privileged, "privileged", false, "give extended privileges to the container")
 	f.BoolVar(&c.proot, "proot", false, "enables PRoot")
+	f.BoolVar(&c.rootfsOverlay, "rootfs-overlay", false, "mounts the rootfs as overlay of shared image layer directories instead of extracting a copy (requires fuse-overlayfs when rootless)")
+	f.StringVar(&c.rootfsClone, "rootfs-clone", "", "clones the cached image file system into the rootfs: reflink|hardlink|copy (for hosts without overlayfs support; hardlink shares inodes with the image cache)")
+	f.BoolVar(&c.rootfsSquashfs, "rootfs-squashfs", false, "mounts the image's cached squashfs blob read-only as rootfs lower layer (requires squashfs-tools and, when rootless, squashfuse)")
 	initNetConfFlags(f, &c.netCfg)
 }
 
 func (c *bundleFlags) InitRunFlags(f *pflag.FlagSet) {
+	f.BoolVarP(&c.detach, "detach", "d", false, "runs the container detached in the background and prints its ID")
 	f.BoolVarP(&c.stdin, "stdin", "i", false, "binds stdin to the container")
 	f.BoolVar(&c.noNewKeyring, "no-new-keyring", false, "do not create a new session keyring for the container. This will cause the container to inherit the calling processes session key")
 	f.BoolVar(&c.noPivot, "no-pivot", false, "do not use pivot root to jail process inside rootfs. This should be used whenever the rootfs is on top of a ramdisk")
@@ -85,7 +132,8 @@ func initNetConfFlags(f *pflag.FlagSet, c *netCfg) {
 	f.Var((*cDnsOptions)(c), "dns-opts", "DNS search options to write in container's /etc/resolv.conf")
 	f.Var((*cExtraHosts)(c), "hosts-entry", "additional entries to write in container's /etc/hosts")
 	f.VarP((*cPortBinding)(c), "publish", "p", "container ports to be published on the host: [[HOSTIP:]HOSTPORT:]PORT[/PROT]")
-	f.Var((*cNetworks)(c), "network", "add CNI network to container's network namespace")
+	f.Var((*cNetworks)(c), "network", "add CNI network or the 'pasta' backend to container's network namespace")
+	f.Var((*cNetworkOpts)(c), "network-opt", "options passed to the container's networks, e.g. device=eth1")
 }
 
 func (c *bundleFlags) curr() *model.Service {
@@ -104,14 +152,67 @@ func (c *bundleFlags) Read() (*model.Service, error) {
 		return nil, usageError("--proot enabled but no --proot-path specified")
 	}
 	s := c.app
+	switch c.mountCreate {
+	case "", "error":
+	case "dir", "file":
+		for i, m := range s.Volumes {
+			if m.Type == "" || m.Type == model.MOUNT_TYPE_BIND || m.Type == model.MOUNT_TYPE_VOLUME {
+				if _, create := bundle.SplitMountCreateOptions(m.Options); create == "" {
+					s.Volumes[i].Options = append(m.Options, "create-"+c.mountCreate)
+				}
+			}
+		}
+	default:
+		return nil, usageError("invalid --mount-create value: " + c.mountCreate)
+	}
+	if s.HealthCheck != nil {
+		if c.healthInterval > 0 {
+			s.HealthCheck.Interval = &c.healthInterval
+		}
+		if c.healthTimeout > 0 {
+			s.HealthCheck.Timeout = &c.healthTimeout
+		}
+		if c.healthRetries > 0 {
+			s.HealthCheck.Retries = c.healthRetries
+		}
+	}
+	if len(c.waitFor) > 0 {
+		s.WaitFor = c.waitFor
+		if c.waitTimeout > 0 {
+			s.WaitForTimeout = &c.waitTimeout
+		}
+	}
 	s.BundleUpdate = c.update
+	s.DeterministicId = c.deterministicId
 	s.NetConf = c.net
+	if c.pod != "" {
+		s.NetworkMode = "pod:" + c.pod
+	}
 	s.Tty = c.tty
 	s.StdinOpen = c.stdin
 	s.Privileged = c.privileged
 	s.ReadOnly = c.readonly
 	s.NoPivot = c.noPivot
 	s.NoNewKeyring = c.noNewKeyring
+	s.NoEntrypointWrapper = c.noWrapper
+	if c.clockOffset != 0 {
+		s.ClockOffset = &c.clockOffset
+	}
+	s.IntelRdtL3CacheSchema = c.intelRdtL3
+	s.RootfsOverlay = c.rootfsOverlay
+	s.RootfsSquashfs = c.rootfsSquashfs
+	switch c.rootfsClone {
+	case "", "copy", "reflink", "hardlink":
+		s.RootfsClone = c.rootfsClone
+	default:
+		return nil, usageError("invalid --rootfs-clone value: " + c.rootfsClone)
+	}
+	switch c.pull {
+	case "", "always", "missing", "never":
+		s.Pull = c.pull
+	default:
+		return nil, usageError("invalid --pull value: " + c.pull)
+	}
 	s.PRoot = c.proot
 	c.app = nil
 	c.net = model.NetConf{}
@@ -219,6 +320,256 @@ func (c *cEnvironment) String() string {
 	return mapToString((*bundleFlags)(c).curr().Environment)
 }
 
+type cLabel bundleFlags
+
+func (c *cLabel) Set(s string) error {
+	return addMapEntries(s, &(*bundleFlags)(c).curr().Labels)
+}
+
+func (c *cLabel) Type() string {
+	return "NAME=VALUE..."
+}
+
+func (c *cLabel) String() string {
+	return mapToString((*bundleFlags)(c).curr().Labels)
+}
+
+type cCpuShares bundleFlags
+
+func (c *cCpuShares) Set(s string) error {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return usageError("invalid cpu shares value: " + s)
+	}
+	(*bundleFlags)(c).curr().CpuShares = &v
+	return nil
+}
+
+func (c *cCpuShares) Type() string {
+	return "uint"
+}
+
+func (c *cCpuShares) String() string {
+	v := (*bundleFlags)(c).curr().CpuShares
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatUint(*v, 10)
+}
+
+type cMemory bundleFlags
+
+func (c *cMemory) Set(s string) error {
+	v, err := parseBytes(s)
+	if err != nil {
+		return usageError("invalid memory value: " + s)
+	}
+	(*bundleFlags)(c).curr().Memory = &v
+	return nil
+}
+
+func (c *cMemory) Type() string {
+	return "bytes"
+}
+
+func (c *cMemory) String() string {
+	return formatInt64Ptr((*bundleFlags)(c).curr().Memory)
+}
+
+type cMemorySwap bundleFlags
+
+func (c *cMemorySwap) Set(s string) error {
+	v, err := parseBytes(s)
+	if err != nil {
+		return usageError("invalid memory-swap value: " + s)
+	}
+	(*bundleFlags)(c).curr().MemorySwap = &v
+	return nil
+}
+
+func (c *cMemorySwap) Type() string {
+	return "bytes"
+}
+
+func (c *cMemorySwap) String() string {
+	return formatInt64Ptr((*bundleFlags)(c).curr().MemorySwap)
+}
+
+type cCpus bundleFlags
+
+func (c *cCpus) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return usageError("invalid cpus value: " + s)
+	}
+	(*bundleFlags)(c).curr().Cpus = &v
+	return nil
+}
+
+func (c *cCpus) Type() string {
+	return "decimal"
+}
+
+func (c *cCpus) String() string {
+	v := (*bundleFlags)(c).curr().Cpus
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+type cPidsLimit bundleFlags
+
+func (c *cPidsLimit) Set(s string) error {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return usageError("invalid pids limit value: " + s)
+	}
+	(*bundleFlags)(c).curr().PidsLimit = &v
+	return nil
+}
+
+func (c *cPidsLimit) Type() string {
+	return "int"
+}
+
+func (c *cPidsLimit) String() string {
+	return formatInt64Ptr((*bundleFlags)(c).curr().PidsLimit)
+}
+
+type cHugepageLimit bundleFlags
+
+func (c *cHugepageLimit) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return usageError("invalid hugepage limit (expected format: PAGESIZE=LIMITBYTES): " + s)
+	}
+	limit, err := strconv.ParseUint(kv[1], 10, 64)
+	if err != nil {
+		return usageError("invalid hugepage limit value: " + s)
+	}
+	app := (*bundleFlags)(c).curr()
+	app.HugepageLimits = append(app.HugepageLimits, model.HugepageLimit{kv[0], limit})
+	return nil
+}
+
+func (c *cHugepageLimit) Type() string {
+	return "string"
+}
+
+func (c *cHugepageLimit) String() string {
+	l := (*bundleFlags)(c).curr().HugepageLimits
+	s := make([]string, len(l))
+	for i, e := range l {
+		s[i] = e.PageSize + "=" + strconv.FormatUint(e.Limit, 10)
+	}
+	return strings.Join(s, ",")
+}
+
+// Parses a byte quantity with an optional binary unit suffix (k|m|g|t)
+func parseBytes(s string) (v int64, err error) {
+	mul := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		mul = 1024
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "M"):
+		mul = 1024 * 1024
+	case strings.HasSuffix(s, "g"), strings.HasSuffix(s, "G"):
+		mul = 1024 * 1024 * 1024
+	case strings.HasSuffix(s, "t"), strings.HasSuffix(s, "T"):
+		mul = 1024 * 1024 * 1024 * 1024
+	}
+	if mul > 1 {
+		s = s[:len(s)-1]
+	}
+	if v, err = strconv.ParseInt(s, 10, 64); err == nil {
+		v *= mul
+	}
+	return
+}
+
+func formatInt64Ptr(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+type cIONice bundleFlags
+
+func (c *cIONice) Set(s string) error {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > 3 {
+		return usageError("invalid ionice class (expected 0-3): " + s)
+	}
+	(*bundleFlags)(c).curr().IONice = &v
+	return nil
+}
+
+func (c *cIONice) Type() string {
+	return "int"
+}
+
+func (c *cIONice) String() string {
+	v := (*bundleFlags)(c).curr().IONice
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+type cHealthCheck bundleFlags
+
+func (c *cHealthCheck) Set(s string) error {
+	if s == "" {
+		return usageError("empty healthcheck probe")
+	}
+	app := (*bundleFlags)(c).curr()
+	if app.HealthCheck == nil {
+		app.HealthCheck = &model.Check{}
+	}
+	app.HealthCheck.SetProbe(s)
+	return nil
+}
+
+func (c *cHealthCheck) Type() string {
+	return "string"
+}
+
+func (c *cHealthCheck) String() string {
+	check := (*bundleFlags)(c).curr().HealthCheck
+	if check == nil {
+		return ""
+	}
+	if check.Tcp != "" {
+		return "tcp://" + check.Tcp
+	}
+	if check.Http != "" {
+		return check.Http
+	}
+	return strings.Join(check.Command, " ")
+}
+
+type cRestart bundleFlags
+
+func (c *cRestart) Set(s string) error {
+	switch s {
+	case "no", "on-failure", "always", "unless-stopped":
+	default:
+		return usageError("invalid restart policy (expected no|on-failure|always|unless-stopped): " + s)
+	}
+	(*bundleFlags)(c).curr().Restart = s
+	return nil
+}
+
+func (c *cRestart) Type() string {
+	return "string"
+}
+
+func (c *cRestart) String() string {
+	return (*bundleFlags)(c).curr().Restart
+}
+
 type cUser bundleFlags
 
 func (c *cUser) Set(s string) error {
@@ -348,6 +699,60 @@ func (c *cExpose) String() string {
 	return entriesToString((*bundleFlags)(c).curr().Entrypoint)
 }
 
+type cDevice bundleFlags
+
+func (c *cDevice) Set(s string) error {
+	d := model.Device{}
+	parts := strings.Split(s, ":")
+	switch len(parts) {
+	case 3:
+		d.Permissions = parts[2]
+		for _, p := range d.Permissions {
+			if p != 'r' && p != 'w' && p != 'm' {
+				return usageError("invalid device permissions (expected any of r, w, m): " + s)
+			}
+		}
+		fallthrough
+	case 2:
+		d.Target = parts[1]
+		fallthrough
+	case 1:
+		d.Source = parts[0]
+	default:
+		return usageError("invalid device (expected format: HOSTPATH[:CONTAINERPATH][:PERMISSIONS]): " + s)
+	}
+	app := (*bundleFlags)(c).curr()
+	app.Devices = append(app.Devices, d)
+	return nil
+}
+
+func (c *cDevice) Type() string {
+	return "device..."
+}
+
+func (c *cDevice) String() string {
+	devices := (*bundleFlags)(c).curr().Devices
+	s := make([]string, len(devices))
+	for i, d := range devices {
+		s[i] = d.String()
+	}
+	return entriesToString(s)
+}
+
+type cEnvFrom bundleFlags
+
+func (c *cEnvFrom) Set(s string) (err error) {
+	return addStringEntries(s, &(*bundleFlags)(c).curr().EnvFrom)
+}
+
+func (c *cEnvFrom) Type() string {
+	return "image..."
+}
+
+func (c *cEnvFrom) String() string {
+	return entriesToString((*bundleFlags)(c).curr().EnvFrom)
+}
+
 type cMount bundleFlags
 
 func (c *cMount) Set(s string) (err error) {
@@ -355,9 +760,10 @@ func (c *cMount) Set(s string) (err error) {
 	if err != nil {
 		return
 	}
-	v.Source, err = filepath.Abs(v.Source)
-	if err != nil {
-		err = errors.New(err.Error())
+	if v.Source != "" && v.Type == model.MOUNT_TYPE_BIND {
+		if v.Source, err = filepath.Abs(v.Source); err != nil {
+			err = errors.New(err.Error())
+		}
 	}
 	r := &(*bundleFlags)(c).curr().Volumes
 	*r = append(*r, v)
@@ -555,3 +961,17 @@ func (c *cNetworks) Type() string {
 func (c *cNetworks) String() string {
 	return strings.Join((*netCfg)(c).net.Networks, ",")
 }
+
+type cNetworkOpts netCfg
+
+func (c *cNetworkOpts) Set(s string) error {
+	return addMapEntries(s, &(*netCfg)(c).net.NetworkOpts)
+}
+
+func (c *cNetworkOpts) Type() string {
+	return "NAME=VALUE..."
+}
+
+func (c *cNetworkOpts) String() string {
+	return mapToString((*netCfg)(c).net.NetworkOpts)
+}
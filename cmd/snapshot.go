@@ -0,0 +1,190 @@
+// Copyright © 2017 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/mgoltzsche/ctnr/image"
+	"github.com/mgoltzsche/ctnr/pkg/atomic"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
+	"github.com/opencontainers/go-digest"
+	rspecs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotCmd = &cobra.Command{
+		Use:   "snapshot [flags] CONTAINER",
+		Short: "Creates a crash-consistent image snapshot of a container",
+		Long: `Freezes the container's processes, commits the rootfs diff as a new
+image layer together with a record of the container's runtime spec and
+thaws the container again. The snapshot is tagged as
+snapshot/CONTAINER:TIMESTAMP and can be used to create new containers.`,
+		Run: wrapRun(runSnapshotCreate),
+	}
+	snapshotListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists all snapshots in the local store",
+		Long:  `Lists all snapshots in the local store.`,
+		Run:   wrapRun(runSnapshotList),
+	}
+)
+
+func init() {
+	snapshotCmd.AddCommand(snapshotListCmd)
+}
+
+type snapshotRecord struct {
+	Container string        `json:"container"`
+	Image     digest.Digest `json:"image"`
+	Tag       string        `json:"tag"`
+	Created   time.Time     `json:"created"`
+	Spec      *rspecs.Spec  `json:"spec"`
+}
+
+func snapshotDir() string {
+	return filepath.Join(flagStoreDir, "snapshots")
+}
+
+func runSnapshotCreate(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one CONTAINER argument expected")
+	}
+	containerId := args[0]
+	b, err := store.Bundle(containerId)
+	if err != nil {
+		return
+	}
+	lockedBundle, err := b.Lock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, lockedBundle.Close())
+	}()
+	spec, err := lockedBundle.Spec()
+	if err != nil {
+		return
+	}
+	if spec.Root == nil {
+		return errors.Errorf("container %q has no root path", containerId)
+	}
+	lockedStore, err := openImageStore()
+	if err != nil {
+		return
+	}
+
+	// Freeze the container while its rootfs is captured
+	containers, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	running, err := containers.Exist(containerId)
+	if err != nil {
+		return
+	}
+	if running {
+		if err = containers.Kill(containerId, syscall.SIGSTOP, true); err != nil {
+			return errors.WithMessage(err, "freeze container")
+		}
+		defer func() {
+			e := errors.WithMessage(containers.Kill(containerId, syscall.SIGCONT, true), "thaw container")
+			err = exterrors.Append(err, e)
+		}()
+	}
+
+	rootfs, err := tree.FromDir(filepath.Join(b.Dir(), spec.Root.Path), flagRootless)
+	if err != nil {
+		return
+	}
+	var imgId digest.Digest
+	img, err := lockedStore.AddLayer(rootfs, lockedBundle.Image(), "", "snapshot")
+	if err == nil {
+		imgId = img.ID()
+	} else if image.IsEmptyLayerDiff(err) {
+		bImgId := lockedBundle.Image()
+		if bImgId == nil {
+			panic("container has no parent image but provides no layer contents")
+		}
+		imgId = *bImgId
+		err = nil
+	} else {
+		return
+	}
+
+	// Tag snapshot and write spec record
+	created := time.Now()
+	tag := fmt.Sprintf("snapshot/%s:%d", containerId, created.Unix())
+	if _, err = lockedStore.TagImage(imgId, tag); err != nil {
+		return
+	}
+	record := snapshotRecord{containerId, imgId, tag, created, spec}
+	if err = os.MkdirAll(snapshotDir(), 0775); err != nil {
+		return errors.New(err.Error())
+	}
+	recordFile := filepath.Join(snapshotDir(), containerId+"-"+strconv.FormatInt(created.Unix(), 10)+".json")
+	if _, err = atomic.WriteJson(recordFile, &record); err != nil {
+		return errors.WithMessage(err, "write snapshot record")
+	}
+	fmt.Println(tag)
+	return
+}
+
+func runSnapshotList(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("No args expected")
+	}
+	files, err := ioutil.ReadDir(snapshotDir())
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New(err.Error())
+	}
+	records := make([]snapshotRecord, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		var record snapshotRecord
+		c, e := ioutil.ReadFile(filepath.Join(snapshotDir(), f.Name()))
+		if e == nil {
+			e = json.Unmarshal(c, &record)
+		}
+		if e != nil {
+			loggers.Warn.Printf("invalid snapshot record %s: %s", f.Name(), e)
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Created.Before(records[j].Created)
+	})
+	w := newTableWriter("%-35s  %-26s  %-71s  %s\n")
+	w.Header("TAG", "CONTAINER", "IMAGE", "CREATED")
+	for _, record := range records {
+		w.Row(record.Tag, record.Container, record.Image, humanize.Time(record.Created))
+	}
+	return
+}
@@ -0,0 +1,101 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/mgoltzsche/ctnr/run"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsCmd = &cobra.Command{
+		Use:   "stats [CONTAINERID...]",
+		Short: "Shows resource usage of running containers",
+		Long:  `Shows CPU, memory, block io and network usage of all or the given running containers.`,
+		Run:   wrapRun(runStats),
+	}
+	flagStatsStream     bool
+	flagStatsInterfaces bool
+)
+
+func init() {
+	statsCmd.Flags().BoolVar(&flagStatsStream, "stream", false, "refreshes the table periodically until interrupted")
+	statsCmd.Flags().BoolVar(&flagStatsInterfaces, "interfaces", false, "shows per-interface network counters below each container")
+}
+
+func runStats(cmd *cobra.Command, args []string) (err error) {
+	containers, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	rendered := 0
+	for {
+		ids := args
+		if len(ids) == 0 {
+			l, e := containers.List()
+			if e != nil {
+				return e
+			}
+			ids = make([]string, len(l))
+			for i, c := range l {
+				ids[i] = c.ID
+			}
+		}
+		stats := make([]run.ContainerStats, 0, len(ids))
+		for _, id := range ids {
+			s, e := containers.Stats(id)
+			if e != nil {
+				loggers.Debug.WithField("id", id).Println("stats:", e)
+				continue
+			}
+			stats = append(stats, s)
+		}
+		// Move the cursor up to overwrite the previously rendered table
+		if rendered > 0 {
+			fmt.Printf("\033[%dA", rendered)
+		}
+		f := "\r\033[K%-26s  %10s  %21s  %21s  %21s\n"
+		fmt.Printf(f, "ID", "CPU TIME", "MEM USAGE / LIMIT", "BLKIO R / W", "NET RX / TX")
+		rows := 1
+		for _, s := range stats {
+			memLimit := "-"
+			if s.MemoryLimit > 0 {
+				memLimit = humanize.Bytes(s.MemoryLimit)
+			}
+			fmt.Printf(f, s.ID,
+				(time.Duration(s.CpuUsage) * time.Nanosecond).Round(10*time.Millisecond).String(),
+				humanize.Bytes(s.MemoryUsage)+" / "+memLimit,
+				humanize.Bytes(s.BlkioRead)+" / "+humanize.Bytes(s.BlkioWrite),
+				humanize.Bytes(s.NetworkRx)+" / "+humanize.Bytes(s.NetworkTx))
+			rows++
+			if flagStatsInterfaces {
+				for _, ifc := range s.Interfaces {
+					fmt.Printf(f, "  "+ifc.Name, "", "", "",
+						fmt.Sprintf("%s (%d pkt) / %s (%d pkt)", humanize.Bytes(ifc.RxBytes), ifc.RxPackets, humanize.Bytes(ifc.TxBytes), ifc.TxPackets))
+					rows++
+				}
+			}
+		}
+		if !flagStatsStream {
+			return
+		}
+		rendered = rows
+		time.Sleep(time.Second)
+	}
+}
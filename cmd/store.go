@@ -0,0 +1,194 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mgoltzsche/ctnr/pkg/atomic"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/lock"
+	rspecs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	storeCmd = &cobra.Command{
+		Use:   "store",
+		Short: "Manage the store directory",
+		Long:  `Manages the store directory containing images, bundles and volumes.`,
+	}
+	storeMoveCmd = &cobra.Command{
+		Use:   "move DEST",
+		Short: "Moves the store to another directory",
+		Long: `Moves the store directory to another location on the same file system,
+rewriting internal absolute references and pointing matching store
+profiles within the config file at the new location.`,
+		Run: wrapRun(runStoreMove),
+	}
+)
+
+func init() {
+	storeCmd.AddCommand(storeMoveCmd)
+}
+
+func runStoreMove(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("Exactly one DEST argument expected")
+	}
+	src := flagStoreDir
+	dest, err := filepath.Abs(args[0])
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if dest == src {
+		return usageError("destination equals the current store directory")
+	}
+	if _, e := os.Stat(dest); e == nil {
+		return errors.Errorf("destination %s exists already", dest)
+	} else if !os.IsNotExist(e) {
+		return errors.New(e.Error())
+	}
+	// Await concurrent store operations. The exclusive lock cannot be held
+	// across the rename since its lock file lives within the store
+	// directory itself.
+	locker, err := lock.NewExclusiveDirLocker(src)
+	if err != nil {
+		return
+	}
+	if err = locker.Lock(); err != nil {
+		return
+	}
+	if err = locker.Unlock(); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), 0750); err != nil {
+		return errors.New(err.Error())
+	}
+	if err = os.Rename(src, dest); err != nil {
+		return errors.Wrap(err, "move store (the destination must be on the store's file system)")
+	}
+	if err = relocateStoreRefs(src, dest); err != nil {
+		return
+	}
+	if err = updateStoreProfiles(src, dest); err != nil {
+		return
+	}
+	fmt.Fprintln(os.Stdout, dest)
+	return
+}
+
+// Rewrites absolute references within the moved store that still point
+// into the old store location: blob directory symlinks within the image
+// repos and bundle spec root and mount source paths
+func relocateStoreRefs(src, dest string) (err error) {
+	defer exterrors.Wrapd(&err, "relocate store references")
+	bundleDir := filepath.Join(dest, "bundles")
+	return filepath.Walk(dest, func(path string, fi os.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return relocateSymlink(src, dest, path)
+		}
+		if !fi.IsDir() && fi.Name() == "config.json" && filepath.Dir(filepath.Dir(path)) == bundleDir {
+			return relocateBundleSpec(src, dest, path)
+		}
+		return nil
+	})
+}
+
+func relocateSymlink(src, dest, path string) (err error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if relocated := relocatePath(src, dest, target); relocated != target {
+		if err = os.Remove(path); err != nil {
+			return errors.New(err.Error())
+		}
+		if err = os.Symlink(relocated, path); err != nil {
+			err = errors.New(err.Error())
+		}
+	}
+	return
+}
+
+func relocateBundleSpec(src, dest, file string) (err error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	spec := rspecs.Spec{}
+	if err = json.Unmarshal(b, &spec); err != nil {
+		return errors.Wrap(err, file)
+	}
+	changed := false
+	if spec.Root != nil {
+		if p := relocatePath(src, dest, spec.Root.Path); p != spec.Root.Path {
+			spec.Root.Path = p
+			changed = true
+		}
+	}
+	for i, m := range spec.Mounts {
+		if p := relocatePath(src, dest, m.Source); p != m.Source {
+			spec.Mounts[i].Source = p
+			changed = true
+		}
+	}
+	if changed {
+		_, err = atomic.WriteJson(file, &spec)
+	}
+	return
+}
+
+// Maps an absolute path below the old store directory to the
+// corresponding path below the new one
+func relocatePath(src, dest, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if rel, err := filepath.Rel(src, path); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		return filepath.Join(dest, rel)
+	}
+	return path
+}
+
+// Points store profiles within the config file that refer to the old
+// store location at the new one
+func updateStoreProfiles(src, dest string) (err error) {
+	c, err := loadConfig()
+	if err != nil {
+		return
+	}
+	changed := false
+	for name, profile := range c.Stores {
+		if profile.StoreDir == src {
+			profile.StoreDir = dest
+			c.Stores[name] = profile
+			changed = true
+		}
+	}
+	if changed {
+		err = saveConfig(c)
+	}
+	return
+}
@@ -0,0 +1,142 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	systemCmd = &cobra.Command{
+		Use:   "system",
+		Short: "Engine-wide operations",
+		Long:  `Provides subcommands operating on all containers at once.`,
+	}
+	systemStopAllCmd = &cobra.Command{
+		Use:   "stop-all",
+		Short: "Stops all running containers",
+		Long: `Stops all running containers in reverse bundle creation order so that
+containers created later (e.g. a compose project's dependent services)
+are stopped before the ones they depend on. Containers still running
+when the timeout elapsed are killed.
+Intended for host shutdown hooks (see the systemd-unit command).`,
+		Run: wrapRun(runSystemStopAll),
+	}
+	systemSystemdUnitCmd = &cobra.Command{
+		Use:   "systemd-unit",
+		Short: "Prints a systemd unit template",
+		Long: `Prints a systemd unit template that stops all containers gracefully
+on host shutdown using the stop-all command.`,
+		Run: wrapRun(runSystemSystemdUnit),
+	}
+	flagStopAllTimeout time.Duration
+)
+
+func init() {
+	systemCmd.AddCommand(systemStopAllCmd)
+	systemCmd.AddCommand(systemSystemdUnitCmd)
+	systemStopAllCmd.Flags().DurationVar(&flagStopAllTimeout, "timeout", time.Duration(30*time.Second), "time after which still running containers are killed")
+	systemSystemdUnitCmd.Flags().DurationVar(&flagStopAllTimeout, "timeout", time.Duration(30*time.Second), "stop timeout written into the unit")
+}
+
+func runSystemStopAll(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("No args expected")
+	}
+	manager, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	l, err := manager.List()
+	if err != nil {
+		return
+	}
+	running := make([]string, 0, len(l))
+	for _, c := range l {
+		if c.Status == "running" {
+			running = append(running, c.ID)
+		}
+	}
+	if len(running) == 0 {
+		return
+	}
+	// Stop dependent containers created later first (compose up creates
+	// a project's services in order)
+	sort.Slice(running, func(i, j int) bool {
+		return bundleCreated(running[j]).Before(bundleCreated(running[i]))
+	})
+	deadline := time.Now().Add(flagStopAllTimeout)
+	for _, id := range running {
+		loggers.Info.Printf("stopping container %s", id)
+		if e := manager.Kill(id, syscall.SIGTERM, true); e != nil {
+			err = exterrors.Append(err, e)
+			continue
+		}
+		for time.Now().Before(deadline) {
+			if exist, _ := manager.Exist(id); !exist {
+				break
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+		if exist, _ := manager.Exist(id); exist {
+			loggers.Warn.Printf("container %s did not stop within timeout, killing it", id)
+			err = exterrors.Append(err, manager.Kill(id, syscall.SIGKILL, true))
+		}
+	}
+	return
+}
+
+// Returns the creation time of the container's bundle or the zero time
+// when the container has no bundle within the store
+func bundleCreated(id string) time.Time {
+	if b, err := store.Bundle(id); err == nil {
+		return b.Created()
+	}
+	return time.Time{}
+}
+
+func runSystemSystemdUnit(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("No args expected")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	fmt.Printf(`[Unit]
+Description=ctnr container shutdown
+DefaultDependencies=no
+Before=shutdown.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/bin/true
+ExecStop=%s --store-dir=%s --state-dir=%s system stop-all --timeout=%s
+TimeoutStopSec=%.0f
+
+[Install]
+WantedBy=multi-user.target
+`, self, flagStoreDir, flagStateDir, flagStopAllTimeout, (flagStopAllTimeout + 10*time.Second).Seconds())
+	return
+}
@@ -0,0 +1,273 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/mgoltzsche/ctnr/model"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
+	fswriter "github.com/mgoltzsche/ctnr/pkg/fs/writer"
+	"github.com/mgoltzsche/ctnr/run"
+	storepkg "github.com/mgoltzsche/ctnr/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	volumeCmd = &cobra.Command{
+		Use:   "volume",
+		Short: "Manages volumes",
+		Long:  `This subcommand operates on named store volumes and bundle volumes.`,
+	}
+	volumeCreateCmd = &cobra.Command{
+		Use:   "create NAME",
+		Short: "Creates a named volume",
+		Long: `Creates a named volume in the local store that can be
+mounted into containers using the volume mount type.`,
+		Run: wrapRun(runVolumeCreate),
+	}
+	volumeListCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "Lists all named volumes",
+		Long:  `Lists all named volumes in the local store.`,
+		Run:   wrapRun(runVolumeList),
+	}
+	volumeRmCmd = &cobra.Command{
+		Use:   "rm NAME...",
+		Short: "Removes one or many named volumes",
+		Long:  `Removes one or many named volumes including their data from the local store.`,
+		Run:   wrapRun(runVolumeRm),
+	}
+	volumePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Removes all unreferenced named volumes",
+		Long:  `Removes all named volumes from the local store that are not mounted by any bundle.`,
+		Run:   wrapRun(runVolumePrune),
+	}
+	volumeBackupCmd = &cobra.Command{
+		Use:   "backup BUNDLEID VOLUME FILE",
+		Short: "Archives a volume to a tarball",
+		Long: `Archives a bundle's volume to a tarball.
+VOLUME is either a named volume or the absolute container path
+of an anonymous volume.`,
+		Run: wrapRun(runVolumeBackup),
+	}
+	volumeRestoreCmd = &cobra.Command{
+		Use:   "restore BUNDLEID VOLUME FILE",
+		Short: "Restores a volume from a tarball",
+		Long: `Restores a bundle's volume from a tarball,
+mapping file ownership when the store is rootless.
+VOLUME is either a named volume or the absolute container path
+of an anonymous volume.`,
+		Run: wrapRun(runVolumeRestore),
+	}
+	flagVolumePause  bool
+	flagVolumeDriver string
+	flagVolumeLabels map[string]string
+)
+
+func init() {
+	volumeCmd.AddCommand(volumeCreateCmd)
+	volumeCmd.AddCommand(volumeListCmd)
+	volumeCmd.AddCommand(volumeRmCmd)
+	volumeCmd.AddCommand(volumePruneCmd)
+	volumeCmd.AddCommand(volumeBackupCmd)
+	volumeCmd.AddCommand(volumeRestoreCmd)
+	volumeCreateCmd.Flags().StringVar(&flagVolumeDriver, "driver", "local", "volume driver")
+	volumeCreateCmd.Flags().Var(volumeLabelFlag{}, "label", "adds a volume label")
+	volumeBackupCmd.Flags().BoolVar(&flagVolumePause, "pause", false, "pauses the bundle's container during the backup")
+	volumeRestoreCmd.Flags().BoolVar(&flagVolumePause, "pause", false, "pauses the bundle's container during the restore")
+}
+
+type volumeLabelFlag struct{}
+
+func (volumeLabelFlag) Set(s string) error {
+	return addMapEntries(s, &flagVolumeLabels)
+}
+
+func (volumeLabelFlag) Type() string {
+	return "NAME=VALUE..."
+}
+
+func (volumeLabelFlag) String() string {
+	return mapToString(flagVolumeLabels)
+}
+
+func runVolumeCreate(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 1 {
+		return usageError("NAME argument required")
+	}
+	v, err := store.CreateVolume(args[0], flagVolumeDriver, flagVolumeLabels)
+	if err == nil {
+		fmt.Fprintln(os.Stdout, v.Name)
+	}
+	return
+}
+
+func runVolumeList(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("No args expected")
+	}
+	l, err := store.Volumes()
+	if err != nil {
+		return
+	}
+	w := newTableWriter("%-30s  %-8s  %s\n")
+	w.Header("NAME", "DRIVER", "CREATED")
+	for _, v := range l {
+		w.Row(v.Name, v.Driver, humanize.Time(v.Created))
+	}
+	return
+}
+
+func runVolumeRm(cmd *cobra.Command, args []string) (err error) {
+	if len(args) == 0 {
+		return usageError("No NAME provided")
+	}
+	for _, name := range args {
+		err = exterrors.Append(err, store.DelVolume(name))
+	}
+	return
+}
+
+func runVolumePrune(cmd *cobra.Command, args []string) (err error) {
+	if len(args) > 0 {
+		return usageError("No args expected")
+	}
+	referenced, err := referencedMountSources()
+	if err != nil {
+		return
+	}
+	gcd, err := store.VolumeGC(nil, func(v *storepkg.Volume) bool {
+		return referenced[filepath.Join(v.Dir, "data")]
+	})
+	for _, v := range gcd {
+		os.Stdout.WriteString(v.Name + "\n")
+	}
+	return
+}
+
+// Returns the mount sources of all bundles to let the volume GC
+// preserve volumes that are still mounted by a bundle.
+func referencedMountSources() (r map[string]bool, err error) {
+	bundles, err := store.Bundles()
+	r = make(map[string]bool, len(bundles))
+	for _, b := range bundles {
+		spec, e := b.Spec()
+		if e != nil {
+			err = exterrors.Append(err, e)
+			continue
+		}
+		for _, m := range spec.Mounts {
+			r[filepath.Clean(m.Source)] = true
+		}
+	}
+	return
+}
+
+func runVolumeBackup(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 3 {
+		return usageError("BUNDLEID, VOLUME and FILE arguments required")
+	}
+	dir, release, err := lockedVolumeDir(args[0], args[1])
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, release())
+	}()
+	if _, err = os.Stat(dir); err != nil {
+		return
+	}
+	fsBuilder := tree.NewFsBuilder(tree.NewFS(), fs.NewFSOptions(flagRootless))
+	fsBuilder.CopyAll(dir, []string{"."}, "/", nil)
+	f, err := os.Create(args[2])
+	if err != nil {
+		return
+	}
+	tarWriter := fswriter.NewTarWriter(f)
+	err = fsBuilder.Write(tarWriter)
+	err = exterrors.Append(err, tarWriter.Close())
+	return exterrors.Append(err, f.Close())
+}
+
+func runVolumeRestore(cmd *cobra.Command, args []string) (err error) {
+	if len(args) != 3 {
+		return usageError("BUNDLEID, VOLUME and FILE arguments required")
+	}
+	file, err := filepath.Abs(args[2])
+	if err != nil {
+		return
+	}
+	dir, release, err := lockedVolumeDir(args[0], args[1])
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, release())
+	}()
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	fsBuilder := tree.NewFsBuilder(tree.NewFS(), fs.NewFSOptions(flagRootless))
+	fsBuilder.AddAll(filepath.Dir(file), []string{filepath.Base(file)}, "/", nil)
+	dirWriter := fswriter.NewDirWriter(dir, fs.NewFSOptions(flagRootless), loggers.Warn)
+	if err = fsBuilder.Write(dirWriter); err != nil {
+		return
+	}
+	return dirWriter.Close()
+}
+
+// Resolves a bundle's volume directory, locking the bundle and optionally
+// pausing its container while the returned release function has not been called.
+func lockedVolumeDir(bundleId string, volume string) (dir string, release func() error, err error) {
+	b, err := store.Bundle(bundleId)
+	if err != nil {
+		return
+	}
+	lb, err := b.Lock()
+	if err != nil {
+		return
+	}
+	release = lb.Close
+	if strings.HasPrefix(volume, "/") {
+		dir = filepath.Join(lb.Dir(), model.AnonymousVolumeDir(volume))
+	} else {
+		dir = filepath.Join(lb.Dir(), model.NamedVolumeDir(volume))
+	}
+	if flagVolumePause {
+		var containers run.ContainerManager
+		if containers, err = newContainerManager(); err != nil {
+			err = exterrors.Append(err, lb.Close())
+			return
+		}
+		if exist, _ := containers.Exist(bundleId); exist {
+			if err = containers.Pause(bundleId); err != nil {
+				err = exterrors.Append(err, lb.Close())
+				return
+			}
+			release = func() error {
+				return exterrors.Append(containers.Resume(bundleId), lb.Close())
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,148 @@
+// Copyright © 2018 Max Goltzsche
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mgoltzsche/ctnr/model"
+	"github.com/mgoltzsche/ctnr/model/oci"
+	"github.com/mgoltzsche/ctnr/run"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	waitCmd = &cobra.Command{
+		Use:   "wait [flags] CONTAINERID...",
+		Short: "Waits until one or more containers reach a condition",
+		Long: `Waits until one or more containers reach a condition.
+Useful in scripts that orchestrate dependent containers without compose.`,
+		Run: wrapRun(runWait),
+	}
+	flagWaitCondition = "exited"
+	flagWaitTimeout   time.Duration
+)
+
+func init() {
+	waitCmd.Flags().StringVar(&flagWaitCondition, "condition", "exited", "condition to wait for: exited|running|healthy|removed")
+	waitCmd.Flags().DurationVar(&flagWaitTimeout, "timeout", 0, "maximum time to wait for the condition (0 = unlimited)")
+}
+
+func runWait(cmd *cobra.Command, args []string) (err error) {
+	if len(args) == 0 {
+		return usageError("At least one container ID argument expected")
+	}
+	switch flagWaitCondition {
+	case "exited", "running", "healthy", "removed":
+	default:
+		return usageError("invalid --condition value: " + flagWaitCondition)
+	}
+	manager, err := newContainerManager()
+	if err != nil {
+		return
+	}
+	deadline := time.Time{}
+	if flagWaitTimeout > 0 {
+		deadline = time.Now().Add(flagWaitTimeout)
+	}
+	for _, id := range args {
+		if err = awaitCondition(id, flagWaitCondition, deadline, manager); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Polls the container's state until it meets the given condition
+// or the deadline is exceeded.
+func awaitCondition(id, condition string, deadline time.Time, manager run.ContainerManager) (err error) {
+	for {
+		met, e := conditionMet(id, condition, manager)
+		if e != nil {
+			return e
+		}
+		if met {
+			return
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return errors.Errorf("wait: container %s did not reach condition %q within %s", id, condition, flagWaitTimeout)
+		}
+		time.Sleep(time.Millisecond * 500)
+	}
+}
+
+func conditionMet(id, condition string, manager run.ContainerManager) (met bool, err error) {
+	exist, err := manager.Exist(id)
+	if err != nil {
+		return
+	}
+	switch condition {
+	case "exited":
+		met = !exist
+	case "removed":
+		if !exist {
+			// The condition is met when the container's bundle is gone as well
+			_, e := store.Bundle(id)
+			met = e != nil
+		}
+	case "running":
+		met = exist && containerStatus(id, manager) == "running"
+	case "healthy":
+		if exist && containerStatus(id, manager) == "running" {
+			check, e := bundleHealthCheck(id)
+			if e != nil {
+				return false, e
+			}
+			if check == nil {
+				// A container without health check counts as healthy when running
+				return true, nil
+			}
+			met = execHealthCheck(id, check, manager) == nil
+		}
+	}
+	return
+}
+
+func containerStatus(id string, manager run.ContainerManager) string {
+	if l, e := manager.List(); e == nil {
+		for _, c := range l {
+			if c.ID == id {
+				return c.Status
+			}
+		}
+	}
+	return ""
+}
+
+// Reads the container's health check definition from its bundle annotation
+func bundleHealthCheck(id string) (check *model.Check, err error) {
+	b, err := store.Bundle(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "read bundle healthcheck")
+	}
+	ann, err := b.Annotations()
+	if err != nil {
+		return nil, errors.Wrap(err, "read bundle healthcheck")
+	}
+	if checkJson := ann[oci.ANNOTATION_BUNDLE_HEALTHCHECK]; checkJson != "" {
+		check = &model.Check{}
+		if err = json.Unmarshal([]byte(checkJson), check); err != nil {
+			return nil, errors.Wrap(err, "unmarshal bundle healthcheck annotation")
+		}
+	}
+	return
+}
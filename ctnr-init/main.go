@@ -0,0 +1,21 @@
+// ctnr-init is a minimal helper binary that runs the container init process
+// without loading the full ctnr binary (which links image distribution,
+// CLI and networking code the init process never uses) - reducing the init
+// process' startup time and memory footprint.
+// It is picked up automatically by the container manager when installed
+// next to the ctnr binary.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	// The librunner package's init function intercepts the "init" arg
+	// (passed by libcontainer) and does not return
+	_ "github.com/mgoltzsche/ctnr/run/librunner"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "ctnr-init is an internal helper binary that is invoked with the 'init' arg by the ctnr container manager")
+	os.Exit(1)
+}
@@ -0,0 +1,245 @@
+package builder
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mgoltzsche/ctnr/pkg/fs/source"
+	"github.com/mgoltzsche/ctnr/pkg/log"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// Coordinates the image build cache between concurrent builder processes on
+// the same host using a unix socket: the first process that misses a cache
+// key leases it and builds the step while other processes that miss the same
+// key wait for the lease to be released and then reuse the first process'
+// cached result instead of building the step again.
+// The first builder process acts as the coordination service, all others
+// connect to it as clients. A lease is released when its result has been
+// written to the cache or when the owning process' connection terminates.
+type sharedImageBuildCache struct {
+	delegate ImageBuildCache
+	coord    *cacheCoordinator
+}
+
+func NewSharedImageBuildCache(delegate ImageBuildCache, socketFile string, debug log.Logger) ImageBuildCache {
+	return &sharedImageBuildCache{delegate, newCacheCoordinator(socketFile, debug)}
+}
+
+func (s *sharedImageBuildCache) GetCachedImageId(parent *digest.Digest, uniqHistoryEntry string) (child digest.Digest, err error) {
+	child, err = s.delegate.GetCachedImageId(parent, uniqHistoryEntry)
+	if err == nil || !IsCacheKeyNotExist(err) {
+		return
+	}
+	acquired, e := s.coord.lease(cacheLeaseKey(parent, uniqHistoryEntry))
+	if e != nil {
+		// Proceed uncoordinated when the coordination service is unavailable
+		s.coord.debug.Println("build cache coordination:", e)
+		return
+	}
+	if !acquired {
+		// Another builder finished the step meanwhile - reuse its result
+		return s.delegate.GetCachedImageId(parent, uniqHistoryEntry)
+	}
+	return
+}
+
+func (s *sharedImageBuildCache) PutCachedImageId(parent *digest.Digest, uniqHistoryEntry string, child digest.Digest) (err error) {
+	err = s.delegate.PutCachedImageId(parent, uniqHistoryEntry, child)
+	if e := s.coord.release(cacheLeaseKey(parent, uniqHistoryEntry)); e != nil {
+		s.coord.debug.Println("build cache coordination:", e)
+	}
+	return
+}
+
+func (s *sharedImageBuildCache) HttpHeaderCache(image *digest.Digest) source.HttpHeaderCache {
+	return s.delegate.HttpHeaderCache(image)
+}
+
+func cacheLeaseKey(parent *digest.Digest, uniqHistoryEntry string) string {
+	key := uniqHistoryEntry
+	if parent != nil {
+		key = parent.String() + " " + key
+	}
+	return digest.SHA256.FromString(key).Hex()
+}
+
+type cacheCoordinator struct {
+	socketFile string
+	mutex      sync.Mutex
+	conn       net.Conn
+	reader     *bufio.Reader
+	listener   net.Listener
+	leases     map[string]*cacheLease
+	leaseMutex sync.Mutex
+	debug      log.Logger
+}
+
+type cacheLease struct {
+	owner   net.Conn // nil when leased by the coordinating process itself
+	waiters []chan struct{}
+}
+
+func newCacheCoordinator(socketFile string, debug log.Logger) *cacheCoordinator {
+	return &cacheCoordinator{socketFile: socketFile, debug: debug}
+}
+
+// Acquires the lease for the provided key, blocking while another process
+// holds it. Returns true if the caller should build the step itself or false
+// if another process built it meanwhile.
+func (c *cacheCoordinator) lease(key string) (acquired bool, err error) {
+	if err = c.connect(); err != nil {
+		return
+	}
+	if c.listener != nil {
+		return c.serverLease(key, nil), nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err = c.conn.Write([]byte("lease " + key + "\n")); err != nil {
+		return false, errors.Wrap(err, "lease")
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return false, errors.Wrap(err, "lease")
+	}
+	return strings.TrimSpace(line) == "acquired", nil
+}
+
+func (c *cacheCoordinator) release(key string) (err error) {
+	if c.conn == nil && c.listener == nil {
+		return
+	}
+	if c.listener != nil {
+		c.serverRelease(key, nil)
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, err = c.conn.Write([]byte("release " + key + "\n"))
+	return errors.Wrap(err, "release lease")
+}
+
+// Connects to the coordination service or becomes it if none is running
+func (c *cacheCoordinator) connect() (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn != nil || c.listener != nil {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		var conn net.Conn
+		if conn, err = net.Dial("unix", c.socketFile); err == nil {
+			c.conn = conn
+			c.reader = bufio.NewReader(conn)
+			return
+		}
+		if os.IsNotExist(errors.Cause(err)) || isConnRefused(err) {
+			// No coordination service running - try to become it
+			os.Remove(c.socketFile)
+			if e := os.MkdirAll(filepath.Dir(c.socketFile), 0750); e != nil {
+				return errors.New(e.Error())
+			}
+			var listener net.Listener
+			if listener, err = net.Listen("unix", c.socketFile); err == nil {
+				c.listener = listener
+				c.leases = map[string]*cacheLease{}
+				go c.serve()
+				return
+			}
+			// Another process won the socket race - retry dialing
+		}
+	}
+	return errors.Wrap(err, "connect build cache coordination service")
+}
+
+func isConnRefused(err error) bool {
+	if opErr, ok := errors.Cause(err).(*net.OpError); ok {
+		return strings.Contains(opErr.Err.Error(), "connection refused")
+	}
+	return false
+}
+
+func (c *cacheCoordinator) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.handleClient(conn)
+	}
+}
+
+func (c *cacheCoordinator) handleClient(conn net.Conn) {
+	defer func() {
+		c.releaseAll(conn)
+		conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) != 2 {
+			continue
+		}
+		switch words[0] {
+		case "lease":
+			reply := "released"
+			if c.serverLease(words[1], conn) {
+				reply = "acquired"
+			}
+			if _, err := conn.Write([]byte(reply + "\n")); err != nil {
+				return
+			}
+		case "release":
+			c.serverRelease(words[1], conn)
+		}
+	}
+}
+
+// Acquires a lease within the coordinating process, blocking while held by another owner
+func (c *cacheCoordinator) serverLease(key string, owner net.Conn) (acquired bool) {
+	c.leaseMutex.Lock()
+	lease := c.leases[key]
+	if lease == nil {
+		c.leases[key] = &cacheLease{owner: owner}
+		c.leaseMutex.Unlock()
+		return true
+	}
+	released := make(chan struct{})
+	lease.waiters = append(lease.waiters, released)
+	c.leaseMutex.Unlock()
+	<-released
+	return false
+}
+
+func (c *cacheCoordinator) serverRelease(key string, owner net.Conn) {
+	c.leaseMutex.Lock()
+	defer c.leaseMutex.Unlock()
+	lease := c.leases[key]
+	if lease == nil || lease.owner != owner {
+		return
+	}
+	delete(c.leases, key)
+	for _, waiter := range lease.waiters {
+		close(waiter)
+	}
+}
+
+// Releases all leases held by a terminated client connection
+func (c *cacheCoordinator) releaseAll(owner net.Conn) {
+	c.leaseMutex.Lock()
+	defer c.leaseMutex.Unlock()
+	for key, lease := range c.leases {
+		if lease.owner == owner {
+			delete(c.leases, key)
+			for _, waiter := range lease.waiters {
+				close(waiter)
+			}
+		}
+	}
+}
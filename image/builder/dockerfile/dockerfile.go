@@ -32,6 +32,12 @@ type ImageBuilder interface {
 	SetUser(string) error
 	SetWorkingDir(string) error
 	Image() digest.Digest
+	DiscardImage(digest.Digest) error
+	TagImage(imageId digest.Digest, tag string) error
+	AddOnBuild(instruction string) error
+	// Returns the base image's ONBUILD triggers and marks them as consumed
+	// so that they are run within the directly derived image only
+	OnBuildTriggers() []string
 }
 
 type DockerfileBuilder struct {
@@ -47,6 +53,7 @@ type DockerfileBuilder struct {
 	shell     []string
 	// build state
 	selectedTargets map[*buildStage]bool
+	stageTag        func(stageName string) string
 }
 
 type buildStage struct {
@@ -77,8 +84,17 @@ func (s *buildStage) apply(b ImageBuilder) (err error) {
 	return
 }
 
+// Wraps an ImageBuilder to run the base image's ONBUILD triggers after FROM
 type buildState struct {
 	ImageBuilder
+	df *DockerfileBuilder
+}
+
+func (s *buildState) FromImage(name string) (err error) {
+	if err = s.ImageBuilder.FromImage(name); err != nil {
+		return
+	}
+	return s.df.applyOnBuildTriggers(s)
 }
 
 func LoadDockerfile(src []byte, ctxDir string, args map[string]string, warn log.Logger) (b *DockerfileBuilder, err error) {
@@ -131,16 +147,42 @@ func (s *DockerfileBuilder) Apply(b ImageBuilder) (err error) {
 	if len(s.stages) == 0 {
 		return errors.New("dockerfile: no build stage defined")
 	}
+	state := &buildState{b, s}
+	applied := make([]*buildStage, 0, len(s.stages))
 	for _, stage := range s.stages {
 		if s.selectedTargets == nil || s.selectedTargets[stage] {
-			if err = stage.apply(b); err != nil {
+			if err = stage.apply(state); err != nil {
 				return
 			}
+			applied = append(applied, stage)
+		}
+	}
+	// Tag or discard intermediate stage images after the final stage completed
+	if len(applied) > 1 {
+		finalImageId := applied[len(applied)-1].builtImageId
+		visited := map[digest.Digest]bool{finalImageId: true}
+		for _, stage := range applied[:len(applied)-1] {
+			if stage.builtImageId != "" && !visited[stage.builtImageId] {
+				visited[stage.builtImageId] = true
+				if s.stageTag != nil {
+					if err = b.TagImage(stage.builtImageId, s.stageTag(stage.name)); err != nil {
+						return errors.WithMessage(err, "dockerfile: tag intermediate build stage image")
+					}
+				} else if err = b.DiscardImage(stage.builtImageId); err != nil {
+					return errors.WithMessage(err, "dockerfile: discard intermediate build stage image")
+				}
+			}
 		}
 	}
 	return
 }
 
+// Makes Apply tag intermediate build stage images with the name the given
+// function derives from the stage name instead of discarding them
+func (s *DockerfileBuilder) KeepStages(tag func(stageName string) string) {
+	s.stageTag = tag
+}
+
 func (s *DockerfileBuilder) resetState() {
 	s.envMap = map[string]bool{}
 	s.runEnvMap = map[string]string{}
@@ -183,8 +225,9 @@ func (b *DockerfileBuilder) readNode(node *parser.Node) (err error) {
 		err = b.cmd(node)
 	case "stopsignal":
 		err = b.stopsignal(node)
+	case "onbuild":
+		err = b.onbuild(node)
 		// TODO: HEALTHCHECK
-		// onbuild ignored here because not supported by OCI image format
 	default:
 		err = errors.Errorf("unsupported instruction: %s", node.Dump())
 	}
@@ -326,6 +369,60 @@ func findStage(stages []*buildStage, name string) (*buildStage, error) {
 	return nil, nil
 }
 
+// See https://docs.docker.com/engine/reference/builder/#onbuild
+func (s *DockerfileBuilder) onbuild(n *parser.Node) (err error) {
+	if n.Next == nil || len(n.Next.Children) != 1 {
+		return errors.New("incomplete instruction: " + n.Dump())
+	}
+	if err = validateOnBuildTrigger(n.Next.Children[0]); err != nil {
+		return
+	}
+	line := strings.TrimSpace(n.Original)
+	trigger := strings.TrimSpace(line[len("onbuild"):])
+	return s.add(func(b ImageBuilder) error {
+		return b.AddOnBuild(trigger)
+	})
+}
+
+func validateOnBuildTrigger(n *parser.Node) error {
+	switch n.Value {
+	case "onbuild", "from", "maintainer":
+		return errors.Errorf("%s instruction is not allowed as ONBUILD trigger", strings.ToUpper(n.Value))
+	}
+	return nil
+}
+
+// Runs the ONBUILD triggers the base image recorded when it was built
+func (s *DockerfileBuilder) applyOnBuildTriggers(b ImageBuilder) (err error) {
+	triggers := b.OnBuildTriggers()
+	if len(triggers) == 0 {
+		return
+	}
+	sub := &DockerfileBuilder{ctxDir: s.ctxDir, buildArgs: s.buildArgs, lex: s.lex, warn: s.warn}
+	sub.resetState()
+	sub.stages = []*buildStage{{"onbuild", nil, map[*buildStage]bool{}, digest.Digest("")}}
+	for _, trigger := range triggers {
+		r, e := parser.Parse(bytes.NewReader([]byte(trigger)))
+		if e != nil {
+			return errors.Errorf("onbuild trigger %q: %s", trigger, e)
+		}
+		for _, n := range r.AST.Children {
+			if err = validateOnBuildTrigger(n); err == nil {
+				err = sub.readNode(n)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "onbuild trigger %q", trigger)
+			}
+		}
+	}
+	for _, op := range sub.stages[0].instructions {
+		if err = op(b); err != nil {
+			return errors.WithMessage(err, "onbuild trigger")
+		}
+	}
+	return
+}
+
 // See https://docs.docker.com/engine/reference/builder/#label
 func (s *DockerfileBuilder) label(n *parser.Node) (err error) {
 	v, err := readInstructionNode(n)
@@ -140,6 +140,23 @@ func (s *mockBuilder) Image() digest.Digest {
 	return digest.Digest("stage" + strconv.Itoa(s.stageCount-1) + "-image")
 }
 
+func (s *mockBuilder) DiscardImage(id digest.Digest) error {
+	return nil
+}
+
+func (s *mockBuilder) TagImage(id digest.Digest, tag string) error {
+	return nil
+}
+
+func (s *mockBuilder) AddOnBuild(trigger string) error {
+	s.add("ONBUILD " + trigger)
+	return s.err()
+}
+
+func (s *mockBuilder) OnBuildTriggers() []string {
+	return nil
+}
+
 func (s *mockBuilder) AddEnv(e map[string]string) error {
 	s.add("ENV " + mapToString(e))
 	return s.err()
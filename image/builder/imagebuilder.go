@@ -32,6 +32,14 @@ import (
 
 var portsRegex = regexp.MustCompile("^(( |^)[1-9][0-9]*(/[a-z0-9]+)?)+$")
 
+// Label used to persist ONBUILD triggers within the image config
+// since the OCI image format has no dedicated field for them
+const LabelOnBuildTriggers = "com.github.mgoltzsche.ctnr.onbuild"
+
+// Annotation marking a bundle as warm build container that may be reused
+// by a later build based on the same image
+const AnnotationBuildBundle = "com.github.mgoltzsche.ctnr.build.bundle"
+
 type ImageBuildConfig struct {
 	Images                 image.ImageStoreRW
 	Bundles                bundle.BundleStore
@@ -42,13 +50,17 @@ type ImageBuildConfig struct {
 	PRoot                  string
 	RemoveSucceededBundles bool
 	RemoveFailedBundle     bool
-	Loggers                log.Loggers
+	// Keeps a warm build container per base image and reuses it in
+	// subsequent builds to avoid unpacking the rootfs for each build
+	ReuseBuildBundle bool
+	Loggers          log.Loggers
 }
 
 type ImageBuilder struct {
 	images                 image.ImageStoreRW
 	bundles                bundle.BundleStore
 	imageResolver          ImageResolver
+	pullPolicy             image.PullPolicy
 	config                 ispecs.Image
 	image                  *image.Image
 	cache                  ImageBuildCache
@@ -67,6 +79,7 @@ type ImageBuilder struct {
 	proot                  string
 	removeSucceededBundles bool
 	removeFailedBundle     bool
+	reuseBuildBundle       bool
 	loggers                log.Loggers
 }
 
@@ -119,6 +132,7 @@ func NewImageBuilder(cfg ImageBuildConfig) (r *ImageBuilder) {
 	r.namedImages = map[string]*image.Image{}
 	r.removeSucceededBundles = cfg.RemoveSucceededBundles
 	r.removeFailedBundle = cfg.RemoveFailedBundle
+	r.reuseBuildBundle = cfg.ReuseBuildBundle
 	return
 }
 
@@ -134,6 +148,33 @@ func (b *ImageBuilder) SetImageResolver(r ImageResolver) {
 	b.imageResolver = r
 }
 
+// Controls when base images are re-resolved from their remote source.
+// An empty policy uses the configured image resolver's behaviour.
+func (b *ImageBuilder) SetPullPolicy(pull image.PullPolicy) {
+	b.pullPolicy = pull
+}
+
+func (b *ImageBuilder) resolveImage(imageName string) (image.Image, error) {
+	switch b.pullPolicy {
+	case image.PullAlways:
+		// An image ID refers to immutable content - nothing to re-resolve
+		if imgId, e := digest.Parse(imageName); e == nil && imgId.Validate() == nil {
+			return b.images.Image(imgId)
+		}
+		transport := ""
+		if p := strings.Index(imageName, ":"); p > 0 {
+			transport = imageName[:p]
+		}
+		if !b.images.SupportsTransport(transport) {
+			imageName = "docker://" + imageName
+		}
+		return b.images.ImportImage(imageName)
+	case image.PullNever:
+		return image.GetImagePulled(b.images, imageName, b.pullPolicy)
+	}
+	return b.imageResolver(b.images, imageName)
+}
+
 func (b *ImageBuilder) closeBundle(lb *bundle.LockedBundle) error { return lb.Close() }
 
 func (b *ImageBuilder) deleteBundle(lb *bundle.LockedBundle) error { return lb.Delete() }
@@ -189,15 +230,23 @@ func (b *ImageBuilder) initBundle() (err error) {
 		return
 	}
 
-	// Create locked bundle
-	newBundle, err := b.bundles.CreateBundle("", false)
-	if err != nil {
-		return
+	// Reuse a warm bundle from a previous build or create a new locked bundle
+	var newBundle *bundle.LockedBundle
+	if b.reuseBuildBundle && b.image != nil {
+		if newBundle = b.findWarmBundle(); newBundle != nil {
+			b.loggers.Debug.WithField("bundle", newBundle.ID()).Println("Reusing warm build bundle")
+		}
+	}
+	if newBundle == nil {
+		if newBundle, err = b.bundles.CreateBundle("", false); err != nil {
+			return
+		}
 	}
 	b.bundle = newBundle
 	b.lockedBundles = append(b.lockedBundles, newBundle)
 
-	// Derive bundle spec from image
+	// Derive bundle spec from image. The rootfs of a reused warm bundle is
+	// left untouched since it matches the image already.
 	builder := builder.Builder(newBundle.ID())
 	if b.image != nil {
 		builder.SetImage(image.NewUnpackableImage(b.image, b.images))
@@ -212,9 +261,46 @@ func (b *ImageBuilder) initBundle() (err error) {
 	builder.UseHostNetwork()
 	builder.SetProcessTerminal(false)
 	builder.SetLinuxSeccompDefault()
+	if b.reuseBuildBundle {
+		builder.AddAnnotation(AnnotationBuildBundle, "true")
+	}
 	return builder.Build(newBundle)
 }
 
+// Returns a locked warm bundle left over from a previous build of the
+// current image or nil. Only bundles marked as build bundles whose recorded
+// parent image matches the current image exactly are reused so that a
+// reused rootfs cannot taint later build steps or cached layers.
+func (b *ImageBuilder) findWarmBundle() *bundle.LockedBundle {
+	l, err := b.bundles.Bundles()
+	if err != nil {
+		b.loggers.Debug.Println("find warm bundle:", err)
+		return nil
+	}
+	imgId := b.image.ID()
+	for _, candidate := range l {
+		if cImgId := candidate.Image(); cImgId == nil || *cImgId != imgId {
+			continue
+		}
+		if ann, e := candidate.Annotations(); e != nil || ann[AnnotationBuildBundle] != "true" {
+			continue
+		}
+		// The lock fails fast when the bundle is in use
+		lb, e := candidate.Lock()
+		if e != nil {
+			continue
+		}
+		// Re-check the parent image now that the bundle cannot change anymore
+		if lbImgId := lb.Image(); lbImgId != nil && *lbImgId == imgId {
+			return lb
+		}
+		if e = lb.Close(); e != nil {
+			b.loggers.Debug.Println("find warm bundle:", e)
+		}
+	}
+	return nil
+}
+
 func (b *ImageBuilder) initContainer() (err error) {
 	if b.container != nil {
 		return
@@ -272,6 +358,27 @@ func (b *ImageBuilder) Image() digest.Digest {
 	return b.image.ID()
 }
 
+// Removes an intermediate build image from the store.
+// The current image as well as its blobs (which may be shared with other
+// images) are preserved; unreferenced blobs are left to the garbage collector.
+func (b *ImageBuilder) DiscardImage(imageId digest.Digest) (err error) {
+	if b.image != nil && b.image.ID() == imageId {
+		return errors.New("refusing to discard the current build image")
+	}
+	b.loggers.Debug.WithField("img", imageId).Println("Discarding intermediate image")
+	return b.images.DelImage(imageId)
+}
+
+// Tags an intermediate build image so that it survives the build and can
+// be inspected, run or used as cache source later
+func (b *ImageBuilder) TagImage(imageId digest.Digest, tag string) (err error) {
+	_, err = b.images.TagImage(imageId, tag)
+	if err == nil {
+		b.loggers.Info.WithField("img", imageId).WithField("tag", tag).Println("Tagged image")
+	}
+	return
+}
+
 func (b *ImageBuilder) BuildName(name string) {
 	_, fsNameExists := b.namedFs[name]
 	_, imgNameExists := b.namedImages[name]
@@ -318,7 +425,7 @@ func (b *ImageBuilder) FromImage(imageName string) (err error) {
 	b.loggers.Info.Println("FROM", imageName)
 	var imgp *image.Image
 	if imageName != "scratch" {
-		img, err := b.imageResolver(b.images, imageName)
+		img, err := b.resolveImage(imageName)
 		if err != nil {
 			return err
 		}
@@ -430,6 +537,38 @@ func (b *ImageBuilder) AddLabels(labels map[string]string) (err error) {
 	return b.cached(createdBy, b.commitConfig)
 }
 
+// Records an ONBUILD trigger within the image config to be run when the
+// image is used as base image
+func (b *ImageBuilder) AddOnBuild(trigger string) (err error) {
+	triggers := append(b.onBuildTriggers(), trigger)
+	j, err := json.Marshal(triggers)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if b.config.Config.Labels == nil {
+		b.config.Config.Labels = map[string]string{}
+	}
+	b.config.Config.Labels[LabelOnBuildTriggers] = string(j)
+	return b.cached("ONBUILD "+trigger, b.commitConfig)
+}
+
+// Returns the base image's ONBUILD triggers and removes them from the build
+// state so that they are run within the directly derived image only
+func (b *ImageBuilder) OnBuildTriggers() (triggers []string) {
+	triggers = b.onBuildTriggers()
+	delete(b.config.Config.Labels, LabelOnBuildTriggers)
+	return
+}
+
+func (b *ImageBuilder) onBuildTriggers() (triggers []string) {
+	if v := b.config.Config.Labels[LabelOnBuildTriggers]; v != "" {
+		if e := json.Unmarshal([]byte(v), &triggers); e != nil {
+			b.loggers.Warn.Printf("invalid %s label in image config: %s", LabelOnBuildTriggers, e)
+		}
+	}
+	return
+}
+
 func (b *ImageBuilder) AddExposedPorts(ports []string) (err error) {
 	if b.config.Config.ExposedPorts == nil {
 		b.config.Config.ExposedPorts = map[string]struct{}{}
@@ -495,6 +634,13 @@ func (b *ImageBuilder) Run(args []string, addEnv map[string]string) (err error)
 		if err = b.initContainer(); err != nil {
 			return
 		}
+		// Invalidate the recorded parent image while the rootfs is mutated
+		// so that an aborted step's bundle is never reused as warm bundle
+		if b.reuseBuildBundle {
+			if err = b.bundle.SetParentImageId(nil); err != nil {
+				return
+			}
+		}
 
 		// Run bundle and create new image layer from the result
 		spec, err := b.bundle.Spec()
@@ -629,7 +775,7 @@ func (b *ImageBuilder) CopyFilesFromImage(srcImage string, srcPattern []string,
 		// Copy from image
 		img, ok := b.namedImages[srcImage]
 		if !ok {
-			resolvedImg, e := b.imageResolver(b.images, srcImage)
+			resolvedImg, e := b.resolveImage(srcImage)
 			if e != nil {
 				return e
 			}
@@ -707,6 +853,13 @@ func (b *ImageBuilder) addLayerAndUpdateBundleFS(imagefs fs.FsNode, createdBy st
 			return errors.Wrap(err, "update bundle with new layer contents")
 		}
 		if bspec.Root != nil {
+			// Invalidate the recorded parent image while the rootfs is mutated
+			// so that an aborted step's bundle is never reused as warm bundle
+			if b.reuseBuildBundle {
+				if err = b.bundle.SetParentImageId(nil); err != nil {
+					return
+				}
+			}
 			bundlefs := filepath.Join(b.bundle.Dir(), bspec.Root.Path)
 			dirWriter := writer.NewDirWriter(bundlefs, fs.NewFSOptions(b.rootless), b.loggers.Warn)
 			if err = imagefs.Write(dirWriter); err == nil {
@@ -176,7 +176,7 @@ func withNewTestee(t *testing.T, tmpDir string, loggers extlog.Loggers, assertio
 	ctx := &types.SystemContext{DockerInsecureSkipTLSVerify: true}
 
 	// Init image store
-	storero, err := store.NewStore(filepath.Join(tmpDir, "image-store"), true, ctx, istore.TrustPolicyInsecure(), loggers)
+	storero, err := store.NewStore(filepath.Join(tmpDir, "image-store"), "", 1, istore.NewPlainProgressReporter(os.Stdout), true, ctx, istore.TrustPolicyInsecure(), loggers)
 	require.NoError(t, err)
 	lockedStore, err := storero.OpenLockedImageStore()
 	require.NoError(t, err)
@@ -37,6 +37,18 @@ type Image struct {
 	Config ispecs.Image
 }
 
+// Aggregated image metadata as exposed by the inspect command
+type ImageDetails struct {
+	ID             digest.Digest   `json:"id"`
+	Tag            string          `json:"tag,omitempty"`
+	Created        time.Time       `json:"created"`
+	Size           uint64          `json:"size"`
+	ManifestDigest digest.Digest   `json:"manifestDigest"`
+	Manifest       ispecs.Manifest `json:"manifest"`
+	Config         ispecs.Image    `json:"config"`
+	Layers         []digest.Digest `json:"layers"`
+}
+
 type TagName struct {
 	Repo string
 	Ref  string
@@ -67,6 +79,30 @@ func (img *UnpackableImage) Unpack(dest string) error {
 	return img.unpacker.UnpackImageLayers(img.ID(), dest)
 }
 
+// Applies only the layers the image adds on top of the parent image to an
+// existing rootfs containing the unpacked parent image
+func (img *UnpackableImage) UnpackDelta(parentImageId digest.Digest, dest string) error {
+	return img.unpacker.UnpackImageLayerDiff(img.ID(), parentImageId, dest)
+}
+
+// Extracts the image's layers into the store's shared layer cache and
+// returns the layer directories for use as overlayfs lowerdirs
+func (img *UnpackableImage) UnpackLayersShared() ([]string, error) {
+	return img.unpacker.UnpackImageLayersShared(img.ID())
+}
+
+// Extracts the image's complete file system into the store's shared cache
+// and returns its directory
+func (img *UnpackableImage) UnpackFsShared() (string, error) {
+	return img.unpacker.UnpackImageFsShared(img.ID())
+}
+
+// Builds a squashfs blob of the image's complete file system within the
+// store's shared cache and returns its file
+func (img *UnpackableImage) UnpackSquashfs() (string, error) {
+	return img.unpacker.UnpackImageSquashfs(img.ID())
+}
+
 func (img *UnpackableImage) Config() *ispecs.Image {
 	return &img.Image.Config
 }
@@ -17,6 +17,9 @@ type ImageStore interface {
 	ImageStoreRO
 	OpenLockedImageStore() (ImageStoreRW, error)
 	ImageGC(ttl, refTTL time.Duration, maxPerRepo int) error
+	// Deletes unreferenced blobs, dangling image IDs and orphaned layer
+	// metadata, returning the number of bytes reclaimed
+	ImagePrune() (uint64, error)
 	DelImage(id ...digest.Digest) error
 }
 
@@ -24,24 +27,52 @@ type ImageStoreRO interface {
 	Images() ([]*ImageInfo, error)
 	Image(id digest.Digest) (Image, error)
 	ImageByName(name string) (Image, error)
+	// Returns aggregated metadata of the image with the given name or ID
+	Inspect(nameOrId string) (ImageDetails, error)
 }
 
 type ImageStoreRW interface {
 	ImageStoreRO
 	ImageUnpacker
 	ImportImage(name string) (Image, error)
+	// Pushes a tagged image to dest (or to the registry its name refers to
+	// if dest is empty), GPG-signing it when signBy names a key identity
+	PushImage(nameRef string, dest string, signBy string) error
 	SupportsTransport(transportName string) bool
+	// Pins commit timestamps to the given time so that builds of identical
+	// inputs yield identical image digests (reproducible builds)
+	SetBuildTimestamp(t time.Time)
 	AddImageConfig(m ispecs.Image, parentImageId *digest.Digest) (Image, error)
 	FS(imageId digest.Digest) (fs.FsNode, error)
 	// Creates a new layer as diff to parent. Returns errEmptyLayerDiff if nothing has changed
 	AddLayer(rootfs fs.FsNode, parentImageId *digest.Digest, author, createdByOp string) (Image, error)
+	// Squashes the image's last n layers (or all when n <= 0) into a single layer
+	SquashLayers(imageId digest.Digest, n int) (Image, error)
+	// Sets and removes annotations on the image's manifest, preserving the image ID
+	AnnotateImage(imageId digest.Digest, set map[string]string, remove []string) (Image, error)
+	// Sets and removes annotations on the repo's OCI image index
+	AnnotateImageIndex(repoName string, set map[string]string, remove []string) error
 	TagImage(imageId digest.Digest, tag string) (ImageInfo, error)
 	UntagImage(tag string) error
+	DelImage(id ...digest.Digest) error
 	Close() error
 }
 
 type ImageUnpacker interface {
 	UnpackImageLayers(id digest.Digest, rootfs string) error
+	// Applies only the layers id adds on top of parentId to a rootfs that
+	// contains the unpacked parent image already
+	UnpackImageLayerDiff(id, parentId digest.Digest, rootfs string) error
+	// Extracts each of the image's layers once into a shared read-only cache
+	// and returns the layer directories (lowest first) for use as overlayfs
+	// lowerdirs
+	UnpackImageLayersShared(id digest.Digest) (layerDirs []string, err error)
+	// Extracts the image's complete file system once into a shared read-only
+	// cache and returns its directory
+	UnpackImageFsShared(id digest.Digest) (dir string, err error)
+	// Builds a squashfs blob of the image's complete file system once within
+	// a shared cache and returns its file
+	UnpackImageSquashfs(id digest.Digest) (file string, err error)
 }
 
 type LayerSource interface {
@@ -86,3 +117,36 @@ func GetImage(store ImageStoreRW, image string) (img Image, err error) {
 	}
 	return
 }
+
+// Controls when an image is fetched from its remote source
+type PullPolicy string
+
+const (
+	// Re-resolves mutable tags from their source on every use
+	PullAlways = PullPolicy("always")
+	// Fetches an image only when it is not present in the local store
+	PullMissing = PullPolicy("missing")
+	// Forbids network access, failing when the image is not stored locally
+	PullNever = PullPolicy("never")
+)
+
+// Resolves an image applying the given pull policy.
+// An empty policy behaves like PullMissing.
+func GetImagePulled(store ImageStoreRW, image string, pull PullPolicy) (img Image, err error) {
+	switch pull {
+	case PullAlways:
+		// An image ID refers to immutable content - nothing to re-resolve
+		if imgId, e := digest.Parse(image); e == nil && imgId.Validate() == nil {
+			return store.Image(imgId)
+		}
+		return store.ImportImage(image)
+	case PullNever:
+		if img, err = GetLocalImage(store, image); IsNotExist(err) {
+			err = errors.Errorf("image %q is not in the local store and must not be pulled (pull policy %q)", image, pull)
+		}
+		return
+	case "", PullMissing:
+		return GetImage(store, image)
+	}
+	return img, errors.Errorf("unsupported pull policy %q (expected always|missing|never)", pull)
+}
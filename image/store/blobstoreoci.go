@@ -5,11 +5,16 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/mgoltzsche/ctnr/image"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
 	"github.com/mgoltzsche/ctnr/pkg/fs"
 	"github.com/mgoltzsche/ctnr/pkg/fs/source"
 	"github.com/mgoltzsche/ctnr/pkg/fs/tree"
@@ -23,10 +28,11 @@ import (
 
 type OCIBlobStore struct {
 	*ContentAddressableStore
-	fsspecs  *FsSpecStore
-	rootless bool
-	warn     log.Logger
-	debug    log.Logger
+	fsspecs    *FsSpecStore
+	rootless   bool
+	buildEpoch *time.Time
+	warn       log.Logger
+	debug      log.Logger
 }
 
 type CommitResult struct {
@@ -36,7 +42,13 @@ type CommitResult struct {
 }
 
 func NewOCIBlobStore(blobStore *ContentAddressableStore, fsSpecStore *FsSpecStore, rootless bool, warn log.Logger, debug log.Logger) OCIBlobStore {
-	return OCIBlobStore{blobStore, fsSpecStore, rootless, warn, debug}
+	return OCIBlobStore{blobStore, fsSpecStore, rootless, nil, warn, debug}
+}
+
+// Pins layer and config creation timestamps to the given time so that
+// builds of identical inputs yield identical image digests
+func (s *OCIBlobStore) SetBuildTimestamp(t time.Time) {
+	s.buildEpoch = &t
 }
 
 func (s *OCIBlobStore) ImageManifest(manifestDigest digest.Digest) (r ispecs.Manifest, err error) {
@@ -54,6 +66,26 @@ func (s *OCIBlobStore) ImageManifest(manifestDigest digest.Digest) (r ispecs.Man
 	return
 }
 
+// Rewrites the manifest with the given annotations set and removed,
+// leaving the image's config and layers untouched
+func (s *OCIBlobStore) AnnotateManifest(manifestDigest digest.Digest, set map[string]string, remove []string) (d ispecs.Descriptor, manifest ispecs.Manifest, err error) {
+	defer exterrors.Wrapd(&err, "annotate manifest")
+	if manifest, err = s.ImageManifest(manifestDigest); err != nil {
+		return
+	}
+	if len(set) > 0 && manifest.Annotations == nil {
+		manifest.Annotations = map[string]string{}
+	}
+	for k, v := range set {
+		manifest.Annotations[k] = v
+	}
+	for _, k := range remove {
+		delete(manifest.Annotations, k)
+	}
+	d, err = s.putImageManifest(manifest)
+	return
+}
+
 func (s *OCIBlobStore) putImageManifest(m ispecs.Manifest) (d ispecs.Descriptor, err error) {
 	d.Digest, d.Size, err = s.putJsonBlob(m)
 	d.MediaType = ispecs.MediaTypeImageManifest
@@ -146,21 +178,45 @@ func (s *OCIBlobStore) FS(manifestDigest digest.Digest) (r fs.FsNode, err error)
 }
 
 func (s *OCIBlobStore) fsFromManifest(manifest *ispecs.Manifest) (r fs.FsNode, err error) {
-	r = tree.NewFS()
-	for _, l := range manifest.Layers {
-		layerFile, e := s.keyFile(l.Digest)
+	layers, err := s.layerFiles(manifest)
+	if err != nil {
+		return
+	}
+	return fsFromLayerFiles(layers)
+}
+
+type layerFile struct {
+	file      string
+	mediaType string
+}
+
+// Returns the local blob file and media type of each of the manifest's layers.
+func (s *OCIBlobStore) layerFiles(manifest *ispecs.Manifest) (r []layerFile, err error) {
+	r = make([]layerFile, len(manifest.Layers))
+	for i, l := range manifest.Layers {
+		file, e := s.keyFile(l.Digest)
 		if e != nil {
-			return nil, errors.Wrap(e, "fsspec from manifest")
+			return nil, errors.Wrap(e, "layer files")
 		}
-		var src fs.Source
 		switch l.MediaType {
-		case ispecs.MediaTypeImageLayerGzip:
-			src = source.NewSourceTarGz(layerFile)
-		case ispecs.MediaTypeImageLayer:
-			src = source.NewSourceTar(layerFile)
+		case ispecs.MediaTypeImageLayerGzip, ispecs.MediaTypeImageLayer:
 		default:
 			return nil, errors.Errorf("unsupported layer media type %q", l.MediaType)
 		}
+		r[i] = layerFile{file, l.MediaType}
+	}
+	return
+}
+
+func fsFromLayerFiles(layers []layerFile) (r fs.FsNode, err error) {
+	r = tree.NewFS()
+	for _, l := range layers {
+		var src fs.Source
+		if l.mediaType == ispecs.MediaTypeImageLayerGzip {
+			src = source.NewSourceTarGz(l.file)
+		} else {
+			src = source.NewSourceTar(l.file)
+		}
 		if _, err = r.AddUpper(".", src); err != nil {
 			return
 		}
@@ -168,6 +224,132 @@ func (s *OCIBlobStore) fsFromManifest(manifest *ispecs.Manifest) (r fs.FsNode, e
 	return
 }
 
+// Decompresses the given gzipped layers concurrently into temporary tar
+// files so that the sequential rootfs write does not block on each
+// layer's decompression. The number of concurrent decompressions is
+// bounded by the number of CPUs. Decompressed entries replace their
+// compressed counterparts within layers.
+func (s *OCIBlobStore) decompressLayers(layers []layerFile) (cleanup func(), err error) {
+	cleanup = func() {}
+	gzCount := 0
+	for _, l := range layers {
+		if l.mediaType == ispecs.MediaTypeImageLayerGzip {
+			gzCount++
+		}
+	}
+	if gzCount < 2 {
+		// Temporary files don't pay off for a single compressed layer
+		return
+	}
+	tmpDir, e := ioutil.TempDir("", ".ctnr-unpack-")
+	if e != nil {
+		return cleanup, errors.New(e.Error())
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+	s.debug.Printf("Decompressing %d layers concurrently", gzCount)
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, runtime.NumCPU())
+		errs = make([]error, len(layers))
+	)
+	for i, l := range layers {
+		if l.mediaType != ispecs.MediaTypeImageLayerGzip {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, file string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tarFile := filepath.Join(tmpDir, strconv.Itoa(i)+".tar")
+			if e := decompressFile(file, tarFile); e != nil {
+				errs[i] = e
+				return
+			}
+			layers[i] = layerFile{tarFile, ispecs.MediaTypeImageLayer}
+		}(i, l.file)
+	}
+	wg.Wait()
+	for _, e := range errs {
+		err = exterrors.Append(err, e)
+	}
+	err = errors.WithMessage(err, "decompress layers")
+	return
+}
+
+func decompressFile(src, dest string) (err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	defer gzr.Close()
+	w, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	defer func() {
+		if e := w.Close(); e != nil && err == nil {
+			err = errors.New(e.Error())
+		}
+	}()
+	if _, err = io.Copy(w, gzr); err != nil {
+		err = errors.Wrap(err, "decompress layer")
+	}
+	return
+}
+
+// Applies only the layers a manifest adds on top of a parent manifest to an
+// existing rootfs directory that contains the parent manifest's unpacked
+// layers. Fails if the parent manifest's layers are no prefix of the
+// manifest's layers.
+func (s *OCIBlobStore) UnpackLayerDiff(manifestDigest, parentManifestDigest digest.Digest, dest string) (err error) {
+	defer func() {
+		err = errors.Wrap(err, "unpack image layer diff")
+	}()
+	manifest, err := s.ImageManifest(manifestDigest)
+	if err != nil {
+		return
+	}
+	parentManifest, err := s.ImageManifest(parentManifestDigest)
+	if err != nil {
+		return
+	}
+	if len(parentManifest.Layers) >= len(manifest.Layers) {
+		return errors.Errorf("image %s adds no layers to %s", manifestDigest, parentManifestDigest)
+	}
+	for i, l := range parentManifest.Layers {
+		if manifest.Layers[i].Digest != l.Digest {
+			return errors.Errorf("parent manifest %s layers are no prefix of manifest %s", parentManifestDigest, manifestDigest)
+		}
+	}
+	s.debug.Printf("Unpacking %d new layers", len(manifest.Layers)-len(parentManifest.Layers))
+	deltaManifest := manifest
+	deltaManifest.Layers = manifest.Layers[len(parentManifest.Layers):]
+	layers, err := s.layerFiles(&deltaManifest)
+	if err != nil {
+		return
+	}
+	cleanup, err := s.decompressLayers(layers)
+	defer cleanup()
+	if err != nil {
+		return
+	}
+	layerfs, err := fsFromLayerFiles(layers)
+	if err != nil {
+		return
+	}
+	dirWriter := writer.NewDirWriter(dest, fs.NewFSOptions(s.rootless), s.warn)
+	if err = layerfs.Write(dirWriter); err != nil {
+		return
+	}
+	return dirWriter.Close()
+}
+
 func (s *OCIBlobStore) FSSpec(manifestDigest digest.Digest) (r fs.FsNode, err error) {
 	manifest, err := s.ImageManifest(manifestDigest)
 	if err != nil {
@@ -201,6 +383,9 @@ func (s *OCIBlobStore) AddLayer(rootfs fs.FsNode, parentManifestDigest *digest.D
 	parentFs := tree.NewFS()
 	r = &CommitResult{}
 	now := time.Now()
+	if s.buildEpoch != nil {
+		now = *s.buildEpoch
+	}
 	r.Config.Created = &now
 	r.Config.Architecture = runtime.GOARCH
 	r.Config.OS = runtime.GOOS
@@ -226,6 +411,10 @@ func (s *OCIBlobStore) AddLayer(rootfs fs.FsNode, parentManifestDigest *digest.D
 			// image would become regular files on commit)
 			parentFs.MockDevices()
 		}
+		if s.buildEpoch != nil {
+			// Override the created time inherited from the parent config
+			r.Config.Created = &now
+		}
 	}
 	// Create new layer as delta from parent
 	layerFs, err := parentFs.Diff(rootfs)
@@ -285,6 +474,108 @@ func (s *OCIBlobStore) AddLayer(rootfs fs.FsNode, parentManifestDigest *digest.D
 	return
 }
 
+// Squashes the image's last n layers (or all when n <= 0) into a single
+// layer, yielding a functionally equal image with fewer layers.
+// The new manifest refers to the source manifest as parent since it still
+// shares the remaining layer blobs with it.
+func (s *OCIBlobStore) SquashLayers(manifestDigest digest.Digest, n int) (r *CommitResult, err error) {
+	defer exterrors.Wrapd(&err, "squash layers")
+	manifest, err := s.ImageManifest(manifestDigest)
+	if err != nil {
+		return
+	}
+	cfg, err := s.ImageConfig(manifest.Config.Digest)
+	if err != nil {
+		return
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, errors.Errorf("image manifest %s has no layers", manifestDigest)
+	}
+	if n <= 0 || n > len(manifest.Layers) {
+		n = len(manifest.Layers)
+	}
+	keptLayers := len(manifest.Layers) - n
+
+	// Derive the squashed layer from the difference between the kept
+	// layers and the complete file system
+	parentFs := tree.NewFS()
+	if keptLayers > 0 {
+		parentManifest := manifest
+		parentManifest.Layers = manifest.Layers[:keptLayers]
+		if parentFs, err = s.fsFromManifest(&parentManifest); err != nil {
+			return
+		}
+	}
+	rootfs, err := s.fsFromManifest(&manifest)
+	if err != nil {
+		return
+	}
+	layerFs, err := parentFs.Diff(rootfs)
+	if err != nil {
+		return
+	}
+	tarReader := s.generateTar(layerFs)
+	defer func() {
+		if e := tarReader.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+	layerDescriptor, diffIdDigest, err := s.putGz(tarReader)
+	if err != nil {
+		return
+	}
+
+	// Keep the history entries that belong to the kept layers only
+	history := make([]ispecs.History, 0, len(cfg.History))
+	nonEmpty := 0
+	for _, h := range cfg.History {
+		if !h.EmptyLayer {
+			if nonEmpty == keptLayers {
+				break
+			}
+			nonEmpty++
+		}
+		history = append(history, h)
+	}
+
+	// Create new config and manifest
+	r = &CommitResult{Manifest: manifest, Config: cfg}
+	now := time.Now()
+	if s.buildEpoch != nil {
+		now = *s.buildEpoch
+	}
+	r.Config.Created = &now
+	r.Config.History = append(history, ispecs.History{
+		CreatedBy:  "squash",
+		EmptyLayer: false,
+	})
+	r.Config.RootFS.DiffIDs = append(append([]digest.Digest{}, cfg.RootFS.DiffIDs[:keptLayers]...), diffIdDigest)
+	r.Manifest.Layers = append(append([]ispecs.Descriptor{}, manifest.Layers[:keptLayers]...), layerDescriptor)
+	if r.Manifest.Annotations == nil {
+		r.Manifest.Annotations = map[string]string{}
+	}
+	r.Manifest.Annotations[AnnotationParentManifest] = manifestDigest.String()
+	if r.Descriptor, err = s.putImageConfig(r.Config, &r.Manifest); err != nil {
+		return
+	}
+	r.Descriptor.MediaType = ispecs.MediaTypeImageManifest
+	r.Descriptor.Platform = &ispecs.Platform{
+		Architecture: r.Config.Architecture,
+		OS:           r.Config.OS,
+	}
+
+	// Cache fsspec
+	chainId, err := layerChainID(&r.Config)
+	if err != nil {
+		return
+	}
+	if rootfs, err = rootfs.Normalized(); err != nil {
+		return
+	}
+	err = s.fsspecs.Put(chainId, rootfs)
+	return
+}
+
 func (s *OCIBlobStore) putGz(reader io.Reader) (layer ispecs.Descriptor, diffIdDigest digest.Digest, err error) {
 	// diffID digest
 	diffIdDigester := digest.SHA256.Digester()
@@ -323,6 +614,9 @@ func (s *OCIBlobStore) generateTar(rootfs fs.FsNode) io.ReadCloser {
 		}()
 		// Write tar
 		tarWriter := fswriter.NewTarWriter(writer)
+		if s.buildEpoch != nil {
+			tarWriter.ClampModTime(*s.buildEpoch)
+		}
 		defer func() {
 			if err == nil {
 				if e := tarWriter.Close(); e != nil {
@@ -354,7 +648,16 @@ func (s *OCIBlobStore) UnpackLayers(manifestDigest digest.Digest, dest string) (
 	if err != nil {
 		return
 	}
-	layerfs, err := s.fsFromManifest(&manifest)
+	layers, err := s.layerFiles(&manifest)
+	if err != nil {
+		return
+	}
+	cleanup, err := s.decompressLayers(layers)
+	defer cleanup()
+	if err != nil {
+		return
+	}
+	layerfs, err := fsFromLayerFiles(layers)
 	if err != nil {
 		return
 	}
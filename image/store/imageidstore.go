@@ -4,12 +4,14 @@ import (
 	"io/ioutil"
 	"strings"
 
+	"github.com/mgoltzsche/ctnr/pkg/dirindex"
 	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 )
 
 type ImageIdStore struct {
 	BlobStore
+	index dirindex.Index
 }
 
 type ImageID struct {
@@ -22,7 +24,9 @@ func (s ImageID) String() string {
 }
 
 func NewImageIdStore(dir string) ImageIdStore {
-	return ImageIdStore{NewBlobStore(dir)}
+	// The index lives next to the indexed directory and is maintained under
+	// the store lock. Depth 1 covers the store's algorithm directories.
+	return ImageIdStore{NewBlobStore(dir), dirindex.NewIndex(dir+".index", 1)}
 }
 
 func (s *ImageIdStore) Put(imageID, manifestDigest digest.Digest) (err error) {
@@ -48,6 +52,9 @@ func (s *ImageIdStore) Get(imageID digest.Digest) (r ImageID, err error) {
 }
 
 func (s *ImageIdStore) Entries() (r []ImageID, err error) {
+	if ok, _ := s.index.Load(s.dir(), &r); ok {
+		return
+	}
 	imageIds, err := s.Keys()
 	if err != nil {
 		return
@@ -60,5 +67,7 @@ func (s *ImageIdStore) Entries() (r []ImageID, err error) {
 		}
 		r = append(r, entry)
 	}
+	// Best-effort index update - a failure only costs a rescan next time
+	s.index.Store(s.dir(), r)
 	return
 }
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"github.com/mgoltzsche/ctnr/image"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/opencontainers/go-digest"
+)
+
+// Deletes unreferenced blobs, dangling image IDs and orphaned fsspec
+// entries by counting the blob references of all resolvable images.
+type imagePrune struct {
+	store       *ImageStoreRW
+	blobRefs    map[digest.Digest]int
+	keepFsSpecs map[digest.Digest]bool
+}
+
+func newImagePrune(store *ImageStoreRW) *imagePrune {
+	return &imagePrune{
+		store:       store,
+		blobRefs:    map[digest.Digest]int{},
+		keepFsSpecs: map[digest.Digest]bool{},
+	}
+}
+
+func (s *imagePrune) Prune() (reclaimed uint64, err error) {
+	defer exterrors.Wrapd(&err, "image prune")
+
+	// Count blob references of all image IDs whose manifest is still resolvable
+	imgIds, err := s.store.imageIds.Entries()
+	if err != nil {
+		return
+	}
+	keepImgIds := map[digest.Digest]bool{}
+	for _, imgId := range imgIds {
+		img, e := s.store.imageInfoFromManifestDigest(imgId.ManifestDigest)
+		if e != nil {
+			// Dangling image ID - its manifest or config blob is gone
+			s.store.warn.Printf("image prune: removing dangling image ID %s", imgId.ID)
+			continue
+		}
+		keepImgIds[imgId.ID] = true
+		s.countRefs(&img)
+	}
+
+	// Count blob references of tagged manifests so that a tag whose image ID
+	// entry is missing does not lose its blobs as well
+	repos, e := s.store.Repos()
+	err = exterrors.Append(err, e)
+	for _, repo := range repos {
+		manifests, e := repo.Manifests()
+		if e != nil {
+			err = exterrors.Append(err, e)
+			continue
+		}
+		for _, m := range manifests {
+			if img, e := s.store.imageInfoFromManifestDigest(m.Digest); e == nil {
+				s.countRefs(&img)
+			}
+		}
+	}
+
+	// Delete dangling image IDs, unreferenced blobs and orphaned fsspecs
+	err = exterrors.Append(err, s.store.imageIds.Retain(keepImgIds))
+	reclaimed, e = s.store.blobs.Sweep(s.blobRefs)
+	err = exterrors.Append(err, e)
+	err = exterrors.Append(err, s.store.blobs.fsspecs.Retain(s.keepFsSpecs))
+	return
+}
+
+func (s *imagePrune) countRefs(img *image.ImageInfo) {
+	s.blobRefs[img.ID()]++
+	s.blobRefs[img.ManifestDigest]++
+	for _, l := range img.Manifest.Layers {
+		s.blobRefs[l.Digest]++
+	}
+	if conf, e := s.store.ImageConfig(img.Manifest.Config.Digest); e == nil {
+		s.keepFsSpecs[chainID(conf.RootFS.DiffIDs)] = true
+	}
+}
@@ -179,6 +179,22 @@ func (r *LockedImageRepo) AddManifest(descriptor ispecs.Descriptor) {
 	r.index.Manifests = manifests
 }
 
+// Sets and removes annotations on the image index itself
+func (r *LockedImageRepo) AnnotateIndex(set map[string]string, remove []string) {
+	if r.err != nil {
+		return
+	}
+	if len(set) > 0 && r.index.Annotations == nil {
+		r.index.Annotations = map[string]string{}
+	}
+	for k, v := range set {
+		r.index.Annotations[k] = v
+	}
+	for _, k := range remove {
+		delete(r.index.Annotations, k)
+	}
+}
+
 func (r *LockedImageRepo) DelManifest(ref string) {
 	if r.err != nil {
 		return
@@ -17,14 +17,16 @@ type ImageStore struct {
 	lock lock.ExclusiveLocker
 	*ImageStoreRO
 	temp          string
+	pullJobs      int
+	progress      ProgressReporter
 	systemContext *types.SystemContext
 	trustPolicy   TrustPolicyContext
 	rootless      bool
 	loggers       log.Loggers
 }
 
-func NewImageStore(locker lock.ExclusiveLocker, store *ImageStoreRO, temp string, systemContext *types.SystemContext, trustPolicy TrustPolicyContext, rootless bool, loggers log.Loggers) *ImageStore {
-	return &ImageStore{locker, store, temp, systemContext, trustPolicy, rootless, loggers}
+func NewImageStore(locker lock.ExclusiveLocker, store *ImageStoreRO, temp string, pullJobs int, progress ProgressReporter, systemContext *types.SystemContext, trustPolicy TrustPolicyContext, rootless bool, loggers log.Loggers) *ImageStore {
+	return &ImageStore{locker, store, temp, pullJobs, progress, systemContext, trustPolicy, rootless, loggers}
 }
 
 func (s *ImageStore) OpenLockedImageStore() (image.ImageStoreRW, error) {
@@ -32,7 +34,7 @@ func (s *ImageStore) OpenLockedImageStore() (image.ImageStoreRW, error) {
 }
 
 func (s *ImageStore) openLockedImageStore(locker lock.Locker) (*ImageStoreRW, error) {
-	return NewImageStoreRW(locker, s.ImageStoreRO, s.temp, s.systemContext, s.trustPolicy, s.rootless, s.loggers)
+	return NewImageStoreRW(locker, s.ImageStoreRO, s.temp, s.pullJobs, s.progress, s.systemContext, s.trustPolicy, s.rootless, s.loggers)
 }
 
 func (s *ImageStore) DelImage(ids ...digest.Digest) (err error) {
@@ -44,28 +46,23 @@ func (s *ImageStore) DelImage(ids ...digest.Digest) (err error) {
 	defer func() {
 		err = exterrors.Append(err, lockedStore.Close())
 	}()
+	return lockedStore.DelImage(ids...)
+}
 
-	imgs, err := lockedStore.Images()
+func (s *ImageStore) ImageGC(ttl, refTTL time.Duration, maxPerRepo int) (err error) {
+	lockedStore, err := s.openLockedImageStore(s.lock)
 	if err != nil {
 		return
 	}
-	for _, id := range ids {
-		for _, img := range imgs {
-			if id == img.ID() && img.Tag != nil {
-				// TODO: single delete batch per repository
-				if err = lockedStore.UntagImage(img.Tag.String()); err != nil {
-					return
-				}
-			}
-		}
-		if err = s.imageIds.Delete(id); err != nil {
-			return
-		}
-	}
-	return
+	defer func() {
+		err = exterrors.Append(err, lockedStore.Close())
+	}()
+	return newImageGC(lockedStore, ttl, refTTL, maxPerRepo).GC()
 }
 
-func (s *ImageStore) ImageGC(ttl, refTTL time.Duration, maxPerRepo int) (err error) {
+// Deletes unreferenced blobs, dangling image IDs and orphaned fsspec entries
+// under the exclusive store lock, returning the number of bytes reclaimed.
+func (s *ImageStore) ImagePrune() (reclaimed uint64, err error) {
 	lockedStore, err := s.openLockedImageStore(s.lock)
 	if err != nil {
 		return
@@ -73,5 +70,5 @@ func (s *ImageStore) ImageGC(ttl, refTTL time.Duration, maxPerRepo int) (err err
 	defer func() {
 		err = exterrors.Append(err, lockedStore.Close())
 	}()
-	return newImageGC(lockedStore, ttl, refTTL, maxPerRepo).GC()
+	return newImagePrune(lockedStore).Prune()
 }
@@ -22,11 +22,12 @@ type ImageStoreRO struct {
 	blobs    *OCIBlobStore
 	imageIds ImageIdStore
 	repoDir  string
+	layerDir string
 	warn     log.Logger
 }
 
-func NewImageStoreRO(dir string, blobStore *OCIBlobStore, imageIds ImageIdStore, warn log.Logger) (r *ImageStoreRO) {
-	return &ImageStoreRO{blobStore, imageIds, dir, warn}
+func NewImageStoreRO(dir string, layerDir string, blobStore *OCIBlobStore, imageIds ImageIdStore, warn log.Logger) (r *ImageStoreRO) {
+	return &ImageStoreRO{blobStore, imageIds, dir, layerDir, warn}
 }
 
 func (s *ImageStoreRO) ImageConfig(id digest.Digest) (ispecs.Image, error) {
@@ -41,6 +42,19 @@ func (s *ImageStoreRO) UnpackImageLayers(imageId digest.Digest, rootfs string) (
 	return s.blobs.UnpackLayers(img.ManifestDigest, rootfs)
 }
 
+// Applies only the layers imageId adds on top of parentImageId to a rootfs
+// that contains the unpacked parent image already
+func (s *ImageStoreRO) UnpackImageLayerDiff(imageId, parentImageId digest.Digest, rootfs string) (err error) {
+	img, err := s.imageIds.Get(imageId)
+	if err == nil {
+		var parentImg ImageID
+		if parentImg, err = s.imageIds.Get(parentImageId); err == nil {
+			return s.blobs.UnpackLayerDiff(img.ManifestDigest, parentImg.ManifestDigest, rootfs)
+		}
+	}
+	return errors.Wrap(err, "unpack image layer diff")
+}
+
 func (s *ImageStoreRO) Image(id digest.Digest) (r image.Image, err error) {
 	imgId, err := s.imageIds.Get(id)
 	if err == nil {
@@ -115,6 +129,23 @@ func (s *ImageStoreRO) ImageByName(nameRef string) (r image.Image, err error) {
 	return
 }
 
+func (s *ImageStoreRO) Inspect(nameOrId string) (r image.ImageDetails, err error) {
+	defer exterrors.Wrapd(&err, "inspect image")
+	img, err := image.GetLocalImage(s, nameOrId)
+	if err != nil {
+		return
+	}
+	layers := make([]digest.Digest, len(img.Manifest.Layers))
+	for i, l := range img.Manifest.Layers {
+		layers[i] = l.Digest
+	}
+	tag := ""
+	if img.Tag != nil {
+		tag = img.Tag.String()
+	}
+	return image.ImageDetails{img.ID(), tag, img.Created, img.Size(), img.ManifestDigest, img.Manifest, img.Config, layers}, nil
+}
+
 func (s *ImageStoreRO) Images() (r []*image.ImageInfo, err error) {
 	defer exterrors.Wrapd(&err, "images")
 
@@ -2,14 +2,17 @@ package store
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/containers/image/copy"
 	ocitransport "github.com/containers/image/oci/layout"
+	"github.com/containers/image/signature"
 	"github.com/containers/image/transports"
 	"github.com/containers/image/transports/alltransports"
 	"github.com/containers/image/types"
@@ -32,15 +35,17 @@ type ImageStoreRW struct {
 	trustPolicy TrustPolicyContext
 	rootless    bool
 	temp        string
+	pullJobs    int
+	progress    ProgressReporter
 	lock        lock.Locker
 	loggers     log.Loggers
 }
 
-func NewImageStoreRW(locker lock.Locker, roStore *ImageStoreRO, tmpDir string, systemContext *types.SystemContext, trustPolicy TrustPolicyContext, rootless bool, loggers log.Loggers) (r *ImageStoreRW, err error) {
+func NewImageStoreRW(locker lock.Locker, roStore *ImageStoreRO, tmpDir string, pullJobs int, progress ProgressReporter, systemContext *types.SystemContext, trustPolicy TrustPolicyContext, rootless bool, loggers log.Loggers) (r *ImageStoreRW, err error) {
 	if err = locker.Lock(); err != nil {
 		err = errors.Wrap(err, "open read/write image store")
 	}
-	return &ImageStoreRW{roStore, systemContext, trustPolicy, rootless, tmpDir, locker, loggers}, err
+	return &ImageStoreRW{roStore, systemContext, trustPolicy, rootless, tmpDir, pullJobs, progress, locker, loggers}, err
 }
 
 func (s *ImageStoreRW) Close() (err error) {
@@ -59,6 +64,12 @@ func (s *ImageStoreRW) SupportsTransport(transportName string) bool {
 	return transports.Get(transportName) != nil
 }
 
+// Pins commit timestamps to the given time so that builds of identical
+// inputs yield identical image digests (SOURCE_DATE_EPOCH convention)
+func (s *ImageStoreRW) SetBuildTimestamp(t time.Time) {
+	s.blobs.SetBuildTimestamp(t)
+}
+
 func (s *ImageStoreRW) ImportImage(src string) (img image.Image, err error) {
 	defer exterrors.Wrapd(&err, "import")
 
@@ -100,13 +111,29 @@ func (s *ImageStoreRW) ImportImage(src string) (img image.Image, err error) {
 	if err != nil {
 		return
 	}
+	if err = s.validateSource(context.Background(), srcRef, trustPolicy); err != nil {
+		return
+	}
+	s.prefetchLayers(context.Background(), srcRef)
+	progress := make(chan types.ProgressProperties)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		for p := range progress {
+			s.progress.Progress(p.Artifact.Digest, int64(p.Offset), p.Artifact.Size)
+		}
+	}()
 	err = copy.Image(context.Background(), trustPolicy, destRef, srcRef, &copy.Options{
 		RemoveSignatures: false,
 		SignBy:           "",
-		ReportWriter:     os.Stdout,
+		ReportWriter:     s.progress.ReportWriter(),
 		SourceCtx:        s.systemContext,
 		DestinationCtx:   &types.SystemContext{},
+		Progress:         progress,
+		ProgressInterval: 150 * time.Millisecond,
 	})
+	close(progress)
+	<-progressDone
 	if err != nil {
 		return
 	}
@@ -151,6 +178,159 @@ func (s *ImageStoreRW) ImportImage(src string) (img image.Image, err error) {
 	return s.ImageByName(src)
 }
 
+// Fetches and validates the source image's manifest and config and runs
+// the trust policy checks so that a policy rejection or platform mismatch
+// fails fast before any large layer is downloaded.
+func (s *ImageStoreRW) validateSource(ctx context.Context, srcRef types.ImageReference, trustPolicy *signature.PolicyContext) (err error) {
+	defer exterrors.Wrapd(&err, "validate source image")
+	img, err := srcRef.NewImage(ctx, s.systemContext)
+	if err != nil {
+		return
+	}
+	defer img.Close()
+	if allowed, e := trustPolicy.IsRunningImageAllowed(ctx, img); !allowed {
+		return e
+	}
+	cfg, err := img.OCIConfig(ctx)
+	if err != nil {
+		return
+	}
+	if cfg.Architecture != "" && cfg.Architecture != runtime.GOARCH {
+		return errors.Errorf("platform mismatch: image architecture is %s but host is %s", cfg.Architecture, runtime.GOARCH)
+	}
+	if cfg.OS != "" && cfg.OS != runtime.GOOS {
+		return errors.Errorf("platform mismatch: image OS is %s but host is %s", cfg.OS, runtime.GOOS)
+	}
+	return
+}
+
+// Downloads the source image's layers concurrently into the blob store
+// using the configured number of pull jobs so that the subsequent
+// sequential copy finds them locally. Failures are only logged since the
+// copy re-fetches missing blobs anyway.
+func (s *ImageStoreRW) prefetchLayers(ctx context.Context, srcRef types.ImageReference) {
+	if s.pullJobs <= 1 {
+		return
+	}
+	img, err := srcRef.NewImage(ctx, s.systemContext)
+	if err != nil {
+		s.loggers.Debug.Println("prefetch layers:", err)
+		return
+	}
+	defer img.Close()
+	layers := img.LayerInfos()
+	if len(layers) < 2 {
+		return
+	}
+	src, err := srcRef.NewImageSource(ctx, s.systemContext)
+	if err != nil {
+		s.loggers.Debug.Println("prefetch layers:", err)
+		return
+	}
+	defer src.Close()
+	jobs := s.pullJobs
+	if len(layers) < jobs {
+		jobs = len(layers)
+	}
+	queue := make(chan types.BlobInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range queue {
+				logger := s.loggers.Info.WithField("layer", info.Digest.Hex()[:13])
+				logger.Println("Downloading layer")
+				if e := s.fetchBlob(ctx, src, info); e != nil {
+					s.warn.Printf("prefetch layer %s: %s", info.Digest, e)
+				} else {
+					logger.Println("Layer downloaded")
+				}
+			}
+		}()
+	}
+	for _, l := range layers {
+		queue <- l
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// Downloads a blob into the blob store unless it is already contained,
+// verifying its digest.
+func (s *ImageStoreRW) fetchBlob(ctx context.Context, src types.ImageSource, info types.BlobInfo) (err error) {
+	if exists, e := s.blobs.Exists(info.Digest); e != nil || exists {
+		return e
+	}
+	reader, size, err := src.GetBlob(ctx, info)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	defer reader.Close()
+	defer s.progress.Done(info.Digest)
+	if size < 1 {
+		size = info.Size
+	}
+	progress := &progressReader{reader: reader, progress: s.progress, blob: info.Digest, size: size}
+	digester := info.Digest.Algorithm().Digester()
+	if _, err = s.blobs.BlobStore.Put(info.Digest, io.TeeReader(progress, digester.Hash())); err != nil {
+		return
+	}
+	if d := digester.Digest(); d != info.Digest {
+		err = s.blobs.BlobStore.Delete(info.Digest)
+		return exterrors.Append(errors.Errorf("digest mismatch: expected %s but received %s", info.Digest, d), err)
+	}
+	return
+}
+
+// Pushes a locally stored image to dest which may use any supported
+// transport (e.g. docker://, oci:, docker-archive:). An empty dest pushes
+// the image to the registry its name refers to. When signBy names a GPG
+// key identity the pushed manifest is signed with it and the signature is
+// written to the destination's signature storage (see registries.d).
+func (s *ImageStoreRW) PushImage(nameRef string, dest string, signBy string) (err error) {
+	defer exterrors.Wrapd(&err, "push")
+
+	// Resolve locally stored image
+	img, err := s.ImageByName(nameRef)
+	if err != nil {
+		return
+	}
+	tag := img.Tag
+	dir, err := s.repo2dir(tag.Repo)
+	if err != nil {
+		return
+	}
+
+	// Parse source - the store's repo directory is a valid OCI layout
+	srcRef, err := ocitransport.Transport.ParseReference(dir + ":" + tag.Ref)
+	if err != nil {
+		return errors.Wrapf(err, "invalid source %q", dir)
+	}
+
+	// Parse destination
+	if dest == "" {
+		dest = "docker://" + tag.Repo + ":" + tag.Ref
+	}
+	destRef, err := alltransports.ParseImageName(dest)
+	if err != nil {
+		return errors.WithMessage(err, "destination")
+	}
+
+	// Copy image
+	trustPolicy, err := s.trustPolicy.Policy()
+	if err != nil {
+		return
+	}
+	return copy.Image(context.Background(), trustPolicy, destRef, srcRef, &copy.Options{
+		RemoveSignatures: false,
+		SignBy:           signBy,
+		ReportWriter:     s.progress.ReportWriter(),
+		SourceCtx:        &types.SystemContext{},
+		DestinationCtx:   s.systemContext,
+	})
+}
+
 // Returns the image's fs spec (files not extractable)
 func (s *ImageStoreRW) FS(imageId digest.Digest) (r fs.FsNode, err error) {
 	imgId, err := s.imageIds.Get(imageId)
@@ -184,6 +364,69 @@ func (s *ImageStoreRW) AddLayer(rootfs fs.FsNode, parentImageId *digest.Digest,
 	return image.NewImage(image.NewImageInfo(c.Descriptor.Digest, c.Manifest, nil, now, now), c.Config), nil
 }
 
+// Squashes the image's last n layers (or all when n <= 0) into a single
+// layer and returns the resulting new image
+func (s *ImageStoreRW) SquashLayers(imageId digest.Digest, n int) (img image.Image, err error) {
+	imgId, err := s.imageIds.Get(imageId)
+	if err != nil {
+		return img, errors.Wrap(err, "squash layers: resolve image ID")
+	}
+	c, err := s.blobs.SquashLayers(imgId.ManifestDigest, n)
+	if err != nil {
+		return
+	}
+	if err = s.imageIds.Put(c.Manifest.Config.Digest, c.Descriptor.Digest); err != nil {
+		return img, errors.WithMessage(err, "squash layers")
+	}
+	now := time.Now()
+	return image.NewImage(image.NewImageInfo(c.Descriptor.Digest, c.Manifest, nil, now, now), c.Config), nil
+}
+
+// Applies the given annotation changes to the image's manifest. The image ID
+// (config digest) is preserved and mapped to the new manifest afterwards.
+func (s *ImageStoreRW) AnnotateImage(imageId digest.Digest, set map[string]string, remove []string) (img image.Image, err error) {
+	defer exterrors.Wrapd(&err, "annotate image")
+	imgId, err := s.imageIds.Get(imageId)
+	if err != nil {
+		return
+	}
+	d, manifest, err := s.blobs.AnnotateManifest(imgId.ManifestDigest, set, remove)
+	if err != nil {
+		return
+	}
+	if err = s.imageIds.Put(manifest.Config.Digest, d.Digest); err != nil {
+		return
+	}
+	cfg, err := s.blobs.ImageConfig(manifest.Config.Digest)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	return image.NewImage(image.NewImageInfo(d.Digest, manifest, nil, now, now), cfg), nil
+}
+
+// Applies the given annotation changes to the repo's OCI image index
+func (s *ImageStoreRW) AnnotateImageIndex(repoName string, set map[string]string, remove []string) (err error) {
+	defer exterrors.Wrapd(&err, "annotate image index")
+	tag := normalizeImageName(repoName)
+	dir, err := s.repo2dir(tag.Repo)
+	if err != nil {
+		return
+	}
+	repo, err := NewLockedImageRepo(tag.Repo, dir, s.blobs.dir())
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, repo.Close())
+	}()
+	if len(repo.index.Manifests) == 0 {
+		return image.ErrNotExist(errors.Errorf("repo %q does not exist", tag.Repo))
+	}
+	repo.AnnotateIndex(set, remove)
+	return
+}
+
 func (s *ImageStoreRW) AddImageConfig(conf ispecs.Image, parentImageId *digest.Digest) (img image.Image, err error) {
 	// Lookup parent manifest digest and set image id annotation
 	var parentManifest *digest.Digest
@@ -217,6 +460,28 @@ func (s *ImageStoreRW) AddImageConfig(conf ispecs.Image, parentImageId *digest.D
 	return
 }
 
+func (s *ImageStoreRW) DelImage(ids ...digest.Digest) (err error) {
+	defer exterrors.Wrapd(&err, "del image")
+	imgs, err := s.Images()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		for _, img := range imgs {
+			if id == img.ID() && img.Tag != nil {
+				// TODO: single delete batch per repository
+				if err = s.UntagImage(img.Tag.String()); err != nil {
+					return
+				}
+			}
+		}
+		if err = s.imageIds.Delete(id); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // Creates a new image ref. Overwrites existing refs.
 func (s *ImageStoreRW) TagImage(imageId digest.Digest, tagStr string) (img image.ImageInfo, err error) {
 	defer exterrors.Wrapd(&err, "tag")
@@ -238,6 +503,17 @@ func (s *ImageStoreRW) TagImage(imageId digest.Digest, tagStr string) (img image
 	if err != nil {
 		return
 	}
+	// Record the image's own platform which may differ from the host's
+	// when it has been imported with an explicit platform selection
+	imgOS, imgArch := runtime.GOOS, runtime.GOARCH
+	if cfg, e := s.blobs.ImageConfig(manifest.Config.Digest); e == nil {
+		if cfg.OS != "" {
+			imgOS = cfg.OS
+		}
+		if cfg.Architecture != "" {
+			imgArch = cfg.Architecture
+		}
+	}
 	manifestDescriptor := ispecs.Descriptor{
 		MediaType: ispecs.MediaTypeImageManifest,
 		Digest:    manifestDigest,
@@ -246,8 +522,8 @@ func (s *ImageStoreRW) TagImage(imageId digest.Digest, tagStr string) (img image
 			ispecs.AnnotationRefName: tag.Ref,
 		},
 		Platform: &ispecs.Platform{
-			Architecture: runtime.GOARCH,
-			OS:           runtime.GOOS,
+			Architecture: imgArch,
+			OS:           imgOS,
 		},
 	}
 
@@ -139,6 +139,48 @@ func (s BlobStore) Retain(keep map[digest.Digest]bool) (err error) {
 	return
 }
 
+// Deletes all blobs that have no reference count,
+// returning the number of bytes reclaimed.
+func (s BlobStore) Sweep(refs map[digest.Digest]int) (reclaimed uint64, err error) {
+	defer func() {
+		err = errors.Wrap(err, "sweep blobs")
+	}()
+	var (
+		al, dl []os.FileInfo
+		dir    = s.dir()
+	)
+	if al, err = ioutil.ReadDir(dir); err != nil {
+		if os.IsNotExist(err) {
+			return reclaimed, nil
+		} else {
+			return
+		}
+	}
+	for _, f := range al {
+		if f.IsDir() {
+			alg := f.Name()
+			af := filepath.Join(dir, alg)
+			dl, err = ioutil.ReadDir(af)
+			if err != nil {
+				return
+			}
+			for _, f = range dl {
+				if blobDigest := digest.NewDigestFromHex(alg, f.Name()); blobDigest.Validate() == nil {
+					if refs[blobDigest] <= 0 {
+						size := uint64(f.Size())
+						if e := os.Remove(filepath.Join(af, f.Name())); e != nil {
+							err = exterrors.Append(err, e)
+						} else {
+							reclaimed += size
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
 func (s BlobStore) dir() string {
 	return string(s)
 }
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/mgoltzsche/ctnr/pkg/fs/source"
+	"github.com/mgoltzsche/ctnr/pkg/fs/writer"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// Extracts each of the image's layers once into the store's shared read-only
+// layer cache and returns the resulting directories in image layer order
+// (lowest first) for use as overlayfs lowerdirs.
+// Cache entries are keyed by layer blob digest and written atomically so that
+// concurrent unpacks of the same layer don't interfere.
+func (s *ImageStoreRO) UnpackImageLayersShared(imageId digest.Digest) (layerDirs []string, err error) {
+	defer func() {
+		err = errors.Wrap(err, "unpack image layers into shared cache")
+	}()
+	img, err := s.imageIds.Get(imageId)
+	if err != nil {
+		return
+	}
+	manifest, err := s.blobs.ImageManifest(img.ManifestDigest)
+	if err != nil {
+		return
+	}
+	layers, err := s.blobs.layerFiles(&manifest)
+	if err != nil {
+		return
+	}
+	layerDirs = make([]string, len(layers))
+	for i, l := range manifest.Layers {
+		dir := filepath.Join(s.layerDir, l.Digest.Algorithm().String(), l.Digest.Hex())
+		if _, e := os.Stat(dir); e != nil {
+			if !os.IsNotExist(e) {
+				return nil, errors.New(e.Error())
+			}
+			if err = s.unpackLayerCacheEntry(layers[i], dir); err != nil {
+				return nil, err
+			}
+		}
+		layerDirs[i] = dir
+	}
+	return
+}
+
+// Unpacks a single layer into the cache directory dest, extracting into a
+// temporary sibling directory first and renaming it to guarantee that dest
+// only ever contains a completely extracted layer.
+func (s *ImageStoreRO) unpackLayerCacheEntry(layer layerFile, dest string) (err error) {
+	layerfs, err := fsFromLayerFiles([]layerFile{layer})
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return errors.New(err.Error())
+	}
+	tmpDir, err := ioutil.TempDir(filepath.Dir(dest), ".tmp-layer-")
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+	dirWriter := writer.NewDirWriter(tmpDir, fs.NewFSOptions(s.blobs.rootless), s.warn)
+	if err = layerfs.Write(&overlayWhiteoutWriter{dirWriter, s.blobs.rootless}); err != nil {
+		return
+	}
+	if err = dirWriter.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmpDir, dest); err != nil {
+		if _, e := os.Stat(dest); e == nil {
+			// A concurrent unpack of the same layer won the rename
+			return nil
+		}
+		err = errors.New(err.Error())
+	}
+	return
+}
+
+// Extracts the image's complete file system once into the shared cache and
+// returns its directory, keyed by the image's manifest digest.
+func (s *ImageStoreRO) UnpackImageFsShared(imageId digest.Digest) (dir string, err error) {
+	defer func() {
+		err = errors.Wrap(err, "unpack image fs into shared cache")
+	}()
+	img, err := s.imageIds.Get(imageId)
+	if err != nil {
+		return
+	}
+	d := img.ManifestDigest
+	dir = filepath.Join(s.layerDir, "fs", d.Algorithm().String(), d.Hex())
+	if _, e := os.Stat(dir); e == nil {
+		return
+	} else if !os.IsNotExist(e) {
+		return "", errors.New(e.Error())
+	}
+	if err = os.MkdirAll(filepath.Dir(dir), 0775); err != nil {
+		return "", errors.New(err.Error())
+	}
+	// Derive a unique destination path for the unpack and rename the
+	// complete tree into place afterwards
+	tmpDir, err := ioutil.TempDir(filepath.Dir(dir), ".tmp-fs-")
+	if err != nil {
+		return "", errors.New(err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+	unpackDir := filepath.Join(tmpDir, "fs")
+	if err = s.blobs.UnpackLayers(d, unpackDir); err != nil {
+		return
+	}
+	if err = os.Rename(unpackDir, dir); err != nil {
+		if _, e := os.Stat(dir); e == nil {
+			// A concurrent unpack of the same image won the rename
+			return dir, nil
+		}
+		return "", errors.New(err.Error())
+	}
+	return
+}
+
+// Builds a squashfs blob of the image's complete file system once within the
+// shared cache and returns its file, keyed by the image's manifest digest.
+// The blob is built from the shared extracted file system using mksquashfs.
+func (s *ImageStoreRO) UnpackImageSquashfs(imageId digest.Digest) (file string, err error) {
+	defer func() {
+		err = errors.Wrap(err, "build image squashfs blob")
+	}()
+	img, err := s.imageIds.Get(imageId)
+	if err != nil {
+		return
+	}
+	d := img.ManifestDigest
+	file = filepath.Join(s.layerDir, "squashfs", d.Algorithm().String(), d.Hex()+".sqfs")
+	if _, e := os.Stat(file); e == nil {
+		return
+	} else if !os.IsNotExist(e) {
+		return "", errors.New(e.Error())
+	}
+	mksquashfs, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		return "", errors.New("mksquashfs binary not found within $PATH. hint: it is contained in the squashfs-tools package")
+	}
+	fsDir, err := s.UnpackImageFsShared(imageId)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0775); err != nil {
+		return "", errors.New(err.Error())
+	}
+	tmpFile := filepath.Join(filepath.Dir(file), ".tmp-"+filepath.Base(file))
+	defer os.Remove(tmpFile)
+	var buf bytes.Buffer
+	c := exec.Command(mksquashfs, fsDir, tmpFile, "-noappend")
+	c.Stderr = &buf
+	if e := c.Run(); e != nil {
+		return "", errors.Errorf("mksquashfs: %s. output: %s", e, strings.TrimSpace(buf.String()))
+	}
+	if err = os.Rename(tmpFile, file); err != nil {
+		if _, e := os.Stat(file); e == nil {
+			// A concurrent build of the same blob won the rename
+			return file, nil
+		}
+		return "", errors.New(err.Error())
+	}
+	return
+}
+
+// Writer decorator that preserves a layer's whiteouts in overlayfs lowerdir
+// representation instead of applying them: as 0:0 character device for the
+// kernel's overlayfs or as aufs-style .wh. file which fuse-overlayfs also
+// reads in rootless mode where device nodes cannot be created.
+type overlayWhiteoutWriter struct {
+	fs.Writer
+	rootless bool
+}
+
+func (w *overlayWhiteoutWriter) Remove(path string) (err error) {
+	if w.rootless {
+		dir, file := filepath.Split(filepath.Clean(path))
+		_, err = w.Writer.File(filepath.Join(dir, fs.WhiteoutPrefix+file), source.NewSourceFile(fs.NewReadableBytes([]byte{}), fs.FileAttrs{Mode: 0}))
+	} else {
+		err = w.Writer.Device(path, fs.DeviceAttrs{fs.FileAttrs{Mode: os.ModeDevice | os.ModeCharDevice}, 0, 0})
+	}
+	return
+}
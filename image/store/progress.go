@@ -0,0 +1,64 @@
+package store
+
+import (
+	"io"
+	"io/ioutil"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Receives per-blob byte progress during an image pull.
+// Implementations must be safe for concurrent use.
+type ProgressReporter interface {
+	// Reports that offset bytes of the blob of the given size have been
+	// received. size may be -1 when unknown.
+	Progress(blob digest.Digest, offset int64, size int64)
+	// Marks the blob's download as finished.
+	Done(blob digest.Digest)
+	// Writer containers/image's status lines are written to.
+	ReportWriter() io.Writer
+}
+
+// Discards all progress events and status lines.
+func NopProgressReporter() ProgressReporter {
+	return nopProgressReporter{}
+}
+
+type nopProgressReporter struct{}
+
+func (nopProgressReporter) Progress(digest.Digest, int64, int64) {}
+func (nopProgressReporter) Done(digest.Digest)                   {}
+func (nopProgressReporter) ReportWriter() io.Writer              { return ioutil.Discard }
+
+// Writes plain status lines to out without rendering byte progress.
+func NewPlainProgressReporter(out io.Writer) ProgressReporter {
+	return &plainProgressReporter{out}
+}
+
+type plainProgressReporter struct {
+	out io.Writer
+}
+
+func (r *plainProgressReporter) Progress(digest.Digest, int64, int64) {}
+func (r *plainProgressReporter) Done(digest.Digest)                   {}
+func (r *plainProgressReporter) ReportWriter() io.Writer              { return r.out }
+
+// Reports the bytes read from the underlying reader in 512KiB steps.
+type progressReader struct {
+	reader   io.Reader
+	progress ProgressReporter
+	blob     digest.Digest
+	size     int64
+	offset   int64
+	reported int64
+}
+
+func (r *progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.reader.Read(b)
+	r.offset += int64(n)
+	if r.offset-r.reported >= 512*1024 || err == io.EOF {
+		r.reported = r.offset
+		r.progress.Progress(r.blob, r.offset, r.size)
+	}
+	return
+}
@@ -5,10 +5,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/cli/cli/compose/loader"
 	"github.com/docker/cli/cli/compose/types"
+	"github.com/docker/cli/opts"
 	"github.com/mgoltzsche/ctnr/model"
 	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
 	"github.com/mgoltzsche/ctnr/pkg/log"
@@ -29,23 +33,67 @@ func Load(file, cwd string, env map[string]string, warn log.Logger) (r *model.Co
 	if absCwd, err = filepath.Abs(cwd); err != nil {
 		return
 	}
-	b, err := ioutil.ReadFile(file)
+	cfg, err := LoadConfig([]string{file}, cwd, env)
 	if err != nil {
 		return
 	}
-	dcyml, err := loader.ParseYAML(b)
-	if err != nil {
+	return transform(cfg, absCwd, warn)
+}
+
+// Reads, interpolates, merges and validates the given compose files in
+// order and returns the resolved canonical configuration.
+// Variables referenced in the files (${VAR}, ${VAR:-default}, ${VAR:?msg})
+// are substituted from the given environment supplemented by the project
+// directory's .env file before schema validation.
+func LoadConfig(files []string, cwd string, env map[string]string) (cfg *types.Config, err error) {
+	if env, err = applyProjectEnvFile(cwd, env); err != nil {
 		return
 	}
-	cfg, err := loader.Load(types.ConfigDetails{
+	configFiles := make([]types.ConfigFile, len(files))
+	for i, file := range files {
+		var b []byte
+		if b, err = ioutil.ReadFile(file); err != nil {
+			return
+		}
+		var dcyml map[string]interface{}
+		if dcyml, err = loader.ParseYAML(b); err != nil {
+			return nil, errors.WithMessage(err, file)
+		}
+		if err = applyExtends(dcyml, file); err != nil {
+			return nil, errors.WithMessage(err, file)
+		}
+		configFiles[i] = types.ConfigFile{file, dcyml}
+	}
+	return loader.Load(types.ConfigDetails{
 		WorkingDir:  cwd,
-		ConfigFiles: []types.ConfigFile{types.ConfigFile{file, dcyml}},
+		ConfigFiles: configFiles,
 		Environment: env,
 	})
+}
+
+// Supplements the environment with the project directory's .env file
+// like docker-compose does: explicitly provided variables take
+// precedence over .env entries. The given map is not modified.
+func applyProjectEnvFile(cwd string, env map[string]string) (map[string]string, error) {
+	file := filepath.Join(cwd, ".env")
+	if _, e := os.Stat(file); e != nil {
+		return env, nil
+	}
+	vars, err := opts.ParseEnvFile(file)
 	if err != nil {
-		return
+		return nil, errors.WithMessage(err, file)
 	}
-	return transform(cfg, absCwd, warn)
+	r := make(map[string]string, len(env)+len(vars))
+	for _, entry := range vars {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) == 2 {
+			r[kv[0]] = kv[1]
+		}
+	}
+	for k, v := range env {
+		r[k] = v
+	}
+	return r, nil
 }
 
 func GetEnv() map[string]string {
@@ -66,15 +114,32 @@ func transform(cfg *types.Config, cwd string, warn log.Logger) (r *model.Compoun
 	if err != nil {
 		return
 	}
+	checkNetworks(cfg.Networks, warn)
 	r = &model.CompoundServices{
 		Dir:      cwd,
 		Volumes:  toVolumes(cfg.Volumes, warn),
 		Services: services,
-		// TODO: map networks, secrets
+		// TODO: map secrets
 	}
 	return
 }
 
+// Top-level networks map to equally named CNI networks within NETCONFPATH.
+// Networks that declare more than a name are not materialized automatically
+// but can be created using 'ctnr net create'.
+func checkNetworks(networks map[string]types.NetworkConfig, warn log.Logger) {
+	for name, n := range networks {
+		if n.External.External {
+			continue
+		}
+		if n.Driver != "" && n.Driver != "bridge" {
+			warn.Printf("network %s: driver %q is not supported - expecting an equally named CNI network within NETCONFPATH", name, n.Driver)
+		} else if n.Driver != "" || len(n.DriverOpts) > 0 || n.Ipam.Driver != "" || len(n.Ipam.Config) > 0 {
+			warn.Printf("network %s is not created automatically - create it using 'ctnr net create' or provide a CNI configuration within NETCONFPATH", name)
+		}
+	}
+}
+
 func toVolumes(vols map[string]types.VolumeConfig, warn log.Logger) map[string]model.Volume {
 	r := map[string]model.Volume{}
 	for name, vol := range vols {
@@ -109,38 +174,71 @@ func toService(s types.ServiceConfig) (r model.Service, err error) {
 	r.CapDrop = s.CapDrop
 	// s.CgroupParent
 	r.Command = []string(s.Command)
+	if r.DependsOn, err = toDependencies(s); err != nil {
+		return
+	}
 	// TODO:
-	// DependsOn
 	// CredentialSpec
-	// Deploy
 	// Devices
+	r.Deploy = toDeploy(s.Deploy)
+	if err = applyResourceLimits(s.Deploy.Resources.Limits, &r); err != nil {
+		return
+	}
 	r.Dns = []string(s.DNS)
 	r.DnsSearch = []string(s.DNSSearch)
 	r.Domainname = s.DomainName
 	r.Entrypoint = []string(s.Entrypoint)
 	r.Environment = toStringMap(s.Environment)
-	// EnvFile
+	// env_file entries are already resolved into Environment by the loader
 	r.Expose = []string(s.Expose)
 	// ExternalLinks
 	if r.ExtraHosts, err = toExtraHosts(s.ExtraHosts); err != nil {
 		return
 	}
 	r.Hostname = s.ContainerName
-	// Healthcheck
+	r.HealthCheck = toHealthCheck(s.HealthCheck)
+	if r.PostStart, err = toExecHooks(s.Extras["x-post_start"]); err != nil {
+		return
+	}
+	if r.Profiles, err = toProfiles(s.Extras["x-profiles"]); err != nil {
+		return
+	}
+	if r.PreStop, err = toExecHooks(s.Extras["x-pre_stop"]); err != nil {
+		return
+	}
 	r.Image = "docker://" + s.Image
 	// Ipc
 	// Labels
 	// Links
 	// Logging
 	// MacAddress
-	// NetworkMode
+	// network_mode takes precedence over the networks section
+	if s.NetworkMode == "" && len(s.Networks) > 0 {
+		// Network names map to equally named CNI networks within
+		// NETCONFPATH (see 'ctnr net create')
+		nets := make([]string, 0, len(s.Networks))
+		for name := range s.Networks {
+			nets = append(nets, name)
+		}
+		sort.Strings(nets)
+		r.Networks = nets
+	}
+	switch s.NetworkMode {
+	case "", "bridge", "default":
+	case "host", "none":
+		r.Networks = []string{s.NetworkMode}
+	default:
+		// container:ID, service:NAME or pod:NAME - resolved into the
+		// namespace holder's pid when the container is created
+		r.NetworkMode = s.NetworkMode
+	}
 	// Pid
 	if r.Ports, err = toPorts(s.Ports); err != nil {
 		return
 	}
 	// Privileged
 	r.ReadOnly = s.ReadOnly
-	// Restart
+	r.Restart = s.Restart
 	// Secrets
 	// SecurityOpt
 	r.StdinOpen = s.StdinOpen
@@ -156,6 +254,322 @@ func toService(s types.ServiceConfig) (r model.Service, err error) {
 	return
 }
 
+func toDeploy(s types.DeployConfig) (r *model.Deploy) {
+	if s.Replicas == nil && s.UpdateConfig == nil {
+		return
+	}
+	r = &model.Deploy{}
+	if s.Replicas != nil {
+		replicas := uint(*s.Replicas)
+		r.Replicas = &replicas
+	}
+	if s.UpdateConfig != nil {
+		u := &model.UpdateConfig{}
+		if s.UpdateConfig.Parallelism != nil {
+			u.Parallelism = uint(*s.UpdateConfig.Parallelism)
+		}
+		if s.UpdateConfig.Delay > 0 {
+			delay := s.UpdateConfig.Delay
+			u.Delay = &delay
+		}
+		r.UpdateConfig = u
+	}
+	return
+}
+
+// Applies the deploy section's resource limits to the service
+func applyResourceLimits(limits *types.Resource, r *model.Service) (err error) {
+	if limits == nil {
+		return
+	}
+	if limits.MemoryBytes > 0 {
+		memory := int64(limits.MemoryBytes)
+		r.Memory = &memory
+	}
+	if limits.NanoCPUs != "" {
+		cpus, err := strconv.ParseFloat(limits.NanoCPUs, 64)
+		if err != nil {
+			return errors.Errorf("invalid deploy.resources.limits.cpus value %q", limits.NanoCPUs)
+		}
+		r.Cpus = &cpus
+	}
+	return
+}
+
+func toHealthCheck(c *types.HealthCheckConfig) (r *model.Check) {
+	if c == nil {
+		return
+	}
+	r = &model.Check{
+		Interval: c.Interval,
+		Timeout:  c.Timeout,
+		Disable:  c.Disable,
+	}
+	if c.Retries != nil {
+		r.Retries = uint(*c.Retries)
+	}
+	if test := []string(c.Test); len(test) > 0 {
+		switch test[0] {
+		case "NONE":
+			r.Disable = true
+		case "CMD":
+			r.Command = test[1:]
+		case "CMD-SHELL":
+			r.SetProbe(strings.Join(test[1:], " "))
+		default:
+			r.Command = test
+		}
+	}
+	return
+}
+
+// Maps a service's depends_on list and optional x-depends_on extension
+// section (a map declaring a start condition per service like compose
+// 2.1's long depends_on syntax) to service dependencies
+func toDependencies(s types.ServiceConfig) (r []model.ServiceDependency, err error) {
+	for _, name := range s.DependsOn {
+		r = append(r, model.ServiceDependency{Service: name, Condition: model.DEPENDENCY_CONDITION_STARTED})
+	}
+	x := s.Extras["x-depends_on"]
+	if x == nil {
+		return
+	}
+	m, ok := x.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("unsupported x-depends_on value: %v", x)
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		condition := model.DEPENDENCY_CONDITION_STARTED
+		if spec, ok := m[name].(map[string]interface{}); ok {
+			if c, ok := spec["condition"]; ok {
+				condition = fmt.Sprintf("%v", c)
+			}
+		}
+		switch condition {
+		case model.DEPENDENCY_CONDITION_STARTED, model.DEPENDENCY_CONDITION_HEALTHY:
+		default:
+			return nil, errors.Errorf("invalid x-depends_on condition %q for service %s (expected service_started|service_healthy)", condition, name)
+		}
+		found := false
+		for i, dep := range r {
+			if dep.Service == name {
+				r[i].Condition = condition
+				found = true
+				break
+			}
+		}
+		if !found {
+			r = append(r, model.ServiceDependency{Service: name, Condition: condition})
+		}
+	}
+	return
+}
+
+// Maps a service's x-post_start/x-pre_stop extension section to exec
+// hooks. Each entry provides a command (string or list), an optional
+// timeout and an on_failure policy (abort|ignore).
+func toExecHooks(v interface{}) (r []model.ExecHook, err error) {
+	if v == nil {
+		return
+	}
+	l, ok := v.([]interface{})
+	if !ok {
+		l = []interface{}{v}
+	}
+	for _, e := range l {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("unsupported exec hook entry: %v", e)
+		}
+		hook := model.ExecHook{}
+		switch cmd := m["command"].(type) {
+		case string:
+			hook.Command = []string{"/bin/sh", "-c", cmd}
+		case []interface{}:
+			for _, a := range cmd {
+				hook.Command = append(hook.Command, fmt.Sprintf("%v", a))
+			}
+		default:
+			return nil, errors.Errorf("exec hook without command: %v", e)
+		}
+		if t, ok := m["timeout"]; ok {
+			d, e := time.ParseDuration(fmt.Sprintf("%v", t))
+			if e != nil {
+				return nil, errors.Errorf("invalid exec hook timeout %v", t)
+			}
+			hook.Timeout = &d
+		}
+		if f, ok := m["on_failure"]; ok {
+			switch f {
+			case "abort", "ignore":
+				hook.OnFailure = f.(string)
+			default:
+				return nil, errors.Errorf("invalid exec hook on_failure value %v (expected abort|ignore)", f)
+			}
+		}
+		r = append(r, hook)
+	}
+	return
+}
+
+// Removes the services that are assigned to profiles (x-profiles) none
+// of which is enabled. Services without profiles are always enabled.
+func FilterByProfiles(services map[string]model.Service, profiles []string) {
+	for name, s := range services {
+		if len(s.Profiles) == 0 {
+			continue
+		}
+		enabled := false
+		for _, p := range s.Profiles {
+			if sliceutils.Contains(profiles, p) {
+				enabled = true
+				break
+			}
+		}
+		if !enabled {
+			delete(services, name)
+		}
+	}
+}
+
+// Maps a service's x-profiles extension section (a profile name or list
+// of profile names) to the service's profiles
+func toProfiles(v interface{}) (r []string, err error) {
+	if v == nil {
+		return
+	}
+	l, ok := v.([]interface{})
+	if !ok {
+		l = []interface{}{v}
+	}
+	for _, e := range l {
+		name, ok := e.(string)
+		if !ok {
+			return nil, errors.Errorf("unsupported x-profiles entry: %v", e)
+		}
+		r = append(r, name)
+	}
+	return
+}
+
+// Resolves each service's x-extends extension section (the base
+// service's name or a mapping with service and optional file keys) by
+// merging the base service's raw configuration into the extending
+// service before validation. The extending service's settings take
+// precedence and the base's dependency declarations are not inherited.
+func applyExtends(dcyml map[string]interface{}, file string) (err error) {
+	services, ok := dcyml["services"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for name := range services {
+		s, err := extendedRawService(dcyml, file, name, map[string]bool{})
+		if err != nil {
+			return err
+		}
+		services[name] = s
+	}
+	return
+}
+
+// Returns the named service's raw configuration with its x-extends
+// section resolved recursively
+func extendedRawService(dcyml map[string]interface{}, file, name string, seen map[string]bool) (s map[string]interface{}, err error) {
+	services, _ := dcyml["services"].(map[string]interface{})
+	s, ok := services[name].(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("service %s is not declared in %s", name, file)
+	}
+	x, ok := s["x-extends"]
+	if !ok {
+		return
+	}
+	key := file + "#" + name
+	if seen[key] {
+		return nil, errors.Errorf("circular x-extends chain at service %s in %s", name, file)
+	}
+	seen[key] = true
+	baseFile, baseName, err := parseExtends(x)
+	if err != nil {
+		return nil, errors.WithMessage(err, "service "+name)
+	}
+	baseCfg := dcyml
+	if baseFile == "" {
+		baseFile = file
+	} else {
+		if !filepath.IsAbs(baseFile) {
+			baseFile = filepath.Join(filepath.Dir(file), baseFile)
+		}
+		b, e := ioutil.ReadFile(baseFile)
+		if e != nil {
+			return nil, errors.New(e.Error())
+		}
+		if baseCfg, err = loader.ParseYAML(b); err != nil {
+			return nil, errors.WithMessage(err, baseFile)
+		}
+	}
+	base, err := extendedRawService(baseCfg, baseFile, baseName, seen)
+	if err != nil {
+		return
+	}
+	merged := mergeRaw(base, s)
+	// Dependency declarations are not inherited from the base service
+	for _, k := range []string{"depends_on", "x-depends_on", "links", "volumes_from"} {
+		if _, ok := s[k]; !ok {
+			delete(merged, k)
+		}
+	}
+	delete(merged, "x-extends")
+	return merged, nil
+}
+
+// Parses an x-extends value: the base service's name or a mapping with
+// service and optional file keys
+func parseExtends(x interface{}) (file, service string, err error) {
+	switch x := x.(type) {
+	case string:
+		service = x
+	case map[string]interface{}:
+		if f, ok := x["file"]; ok {
+			file = fmt.Sprintf("%v", f)
+		}
+		if s, ok := x["service"]; ok {
+			service = fmt.Sprintf("%v", s)
+		}
+		if service == "" {
+			err = errors.New("x-extends without service")
+		}
+	default:
+		err = errors.Errorf("unsupported x-extends value: %v", x)
+	}
+	return
+}
+
+// Deep-merges the override's raw yaml values into the base returning a
+// new map: maps are merged recursively while any other override value
+// replaces the base's
+func mergeRaw(base, override map[string]interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		r[k] = v
+	}
+	for k, v := range override {
+		if bm, ok := r[k].(map[string]interface{}); ok {
+			if om, ok := v.(map[string]interface{}); ok {
+				r[k] = mergeRaw(bm, om)
+				continue
+			}
+		}
+		r[k] = v
+	}
+	return r
+}
+
 func toBuild(s types.BuildConfig) (r *model.ImageBuild) {
 	if s.Context != "" || s.Dockerfile != "" {
 		r = &model.ImageBuild{
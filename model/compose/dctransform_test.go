@@ -3,6 +3,8 @@ package compose
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mgoltzsche/ctnr/model"
@@ -26,3 +28,139 @@ func TestLoad(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestLoadEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctnr-compose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestFile(t, dir, "a.env", "# comment\nFOO=foo-from-a\nBAR=bar-from-a\n\n")
+	writeTestFile(t, dir, "b.env", "BAR=bar-from-b\nBAZ=baz-from-b\n")
+	file := writeTestFile(t, dir, "docker-compose.yml", `
+version: '3.7'
+services:
+  app:
+    image: appimg
+    env_file:
+      - a.env
+      - b.env
+    environment:
+      BAZ: baz-from-environment
+`)
+	project, err := Load(file, dir, map[string]string{}, log.NewNopLogger())
+	require.NoError(t, err)
+	// Explicit environment entries win over env_file values and later
+	// env files win over earlier ones
+	assert.Equal(t, map[string]string{
+		"FOO": "foo-from-a",
+		"BAR": "bar-from-b",
+		"BAZ": "baz-from-environment",
+	}, project.Services["app"].Environment)
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctnr-compose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := writeTestFile(t, dir, "docker-compose.yml", `
+version: '3.7'
+services:
+  app:
+    image: appimg
+  debug:
+    image: debugimg
+    x-profiles:
+      - debug
+      - tools
+`)
+	project, err := Load(file, dir, map[string]string{}, log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Equal(t, []string(nil), project.Services["app"].Profiles)
+	assert.Equal(t, []string{"debug", "tools"}, project.Services["debug"].Profiles)
+	FilterByProfiles(project.Services, []string{"tools"})
+	assert.Len(t, project.Services, 2, "services with an enabled profile should be kept")
+	FilterByProfiles(project.Services, nil)
+	assert.Len(t, project.Services, 1, "services whose profiles are not enabled should be removed")
+	_, ok := project.Services["app"]
+	assert.True(t, ok, "services without profiles should always be enabled")
+}
+
+func TestLoadExtends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctnr-compose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestFile(t, dir, "base.yml", `
+version: '3.7'
+services:
+  base:
+    image: baseimg
+    environment:
+      FOO: foo
+      BAR: bar
+    depends_on:
+      - other
+  other:
+    image: otherimg
+`)
+	file := writeTestFile(t, dir, "docker-compose.yml", `
+version: '3.7'
+services:
+  app:
+    x-extends:
+      file: base.yml
+      service: base
+    environment:
+      BAR: overridden
+  copy:
+    x-extends: app
+`)
+	project, err := Load(file, dir, map[string]string{}, log.NewNopLogger())
+	require.NoError(t, err)
+	expectedEnv := map[string]string{"FOO": "foo", "BAR": "overridden"}
+	app := project.Services["app"]
+	assert.Equal(t, "docker://baseimg", app.Image)
+	assert.Equal(t, expectedEnv, app.Environment)
+	assert.Len(t, app.DependsOn, 0, "the base's depends_on should not be inherited")
+	cp := project.Services["copy"]
+	assert.Equal(t, "docker://baseimg", cp.Image, "x-extends chains should be resolved recursively")
+	assert.Equal(t, expectedEnv, cp.Environment)
+}
+
+func TestLoadInterpolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctnr-compose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestFile(t, dir, ".env", "TAG=1.2\nOVERRIDDEN=env-file-value\n")
+	file := writeTestFile(t, dir, "docker-compose.yml", `
+version: '3.7'
+services:
+  app:
+    image: appimg:${TAG}
+    environment:
+      A: ${UNSET_VAR:-default-value}
+      B: ${OVERRIDDEN}
+`)
+	env := map[string]string{"OVERRIDDEN": "explicit-value"}
+	project, err := Load(file, dir, env, log.NewNopLogger())
+	require.NoError(t, err)
+	app := project.Services["app"]
+	assert.Equal(t, "docker://appimg:1.2", app.Image, "variables should be interpolated from the project's .env file")
+	assert.Equal(t, "default-value", app.Environment["A"])
+	assert.Equal(t, "explicit-value", app.Environment["B"], "explicitly provided variables should win over .env entries")
+
+	// The error form must reject an unset variable
+	writeTestFile(t, dir, "docker-compose.yml", `
+version: '3.7'
+services:
+  app:
+    image: appimg:${UNSET_VAR:?var is required}
+`)
+	_, err = Load(file, dir, env, log.NewNopLogger())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "var is required")
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	return file
+}
@@ -0,0 +1,356 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mgoltzsche/ctnr/model"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/log"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//
+// Converts Kubernetes Pod and Deployment manifests into the internal
+// service model so that single-node pods can be run using the compose
+// commands. Only a pragmatic subset of the pod spec is supported:
+// containers, volumes, env, ports and resource limits.
+//
+
+var (
+	yamlDocSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+	manifestPattern  = regexp.MustCompile(`(?m)^apiVersion:`)
+	kindPattern      = regexp.MustCompile(`(?m)^kind:`)
+)
+
+// Returns true when the given file content looks like a Kubernetes
+// manifest (declares top-level apiVersion and kind)
+func IsKubernetesManifest(b []byte) bool {
+	return manifestPattern.Match(b) && kindPattern.Match(b)
+}
+
+// Loads the Kubernetes Pod and Deployment objects declared in the given
+// (multi-document) YAML manifest and converts them into the internal
+// service model
+func Load(file, cwd string, warn log.Logger) (r *model.CompoundServices, err error) {
+	defer exterrors.Wrapd(&err, "load kubernetes manifest")
+	absCwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	objects, err := decodeObjects(b)
+	if err != nil {
+		return
+	}
+	r = &model.CompoundServices{
+		Dir:      absCwd,
+		Services: map[string]model.Service{},
+		Volumes:  map[string]model.Volume{},
+	}
+	for _, o := range objects {
+		switch o.Kind {
+		case "Pod":
+			err = addPod(o.Metadata.Name, nil, &o.Spec, r, warn)
+		case "Deployment":
+			if o.Spec.Template == nil {
+				return nil, errors.Errorf("deployment %s declares no pod template", o.Metadata.Name)
+			}
+			err = addPod(o.Metadata.Name, o.Spec.Replicas, &o.Spec.Template.Spec, r, warn)
+		default:
+			warn.Printf("ignoring unsupported kubernetes object kind %q", o.Kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Minimal Kubernetes object representation covering the supported
+// subset of the Pod and Deployment specs
+type object struct {
+	ApiVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   metadata `yaml:"metadata"`
+	Spec       podSpec  `yaml:"spec"`
+}
+
+type metadata struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+type podSpec struct {
+	// Pod fields
+	Containers     []container `yaml:"containers"`
+	InitContainers []container `yaml:"initContainers"`
+	Volumes        []podVolume `yaml:"volumes"`
+	Hostname       string      `yaml:"hostname"`
+	RestartPolicy  string      `yaml:"restartPolicy"`
+	// Deployment fields
+	Replicas *uint     `yaml:"replicas"`
+	Template *template `yaml:"template"`
+}
+
+type template struct {
+	Metadata metadata `yaml:"metadata"`
+	Spec     podSpec  `yaml:"spec"`
+}
+
+type container struct {
+	Name         string          `yaml:"name"`
+	Image        string          `yaml:"image"`
+	Command      []string        `yaml:"command"`
+	Args         []string        `yaml:"args"`
+	WorkingDir   string          `yaml:"workingDir"`
+	Env          []envVar        `yaml:"env"`
+	Ports        []containerPort `yaml:"ports"`
+	VolumeMounts []volumeMount   `yaml:"volumeMounts"`
+	Resources    resources       `yaml:"resources"`
+	Tty          bool            `yaml:"tty"`
+	Stdin        bool            `yaml:"stdin"`
+}
+
+type envVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type containerPort struct {
+	ContainerPort uint16 `yaml:"containerPort"`
+	HostPort      uint16 `yaml:"hostPort"`
+	HostIP        string `yaml:"hostIP"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type volumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly"`
+}
+
+type resources struct {
+	Limits resourceList `yaml:"limits"`
+}
+
+type resourceList struct {
+	Cpu    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
+type podVolume struct {
+	Name     string                 `yaml:"name"`
+	HostPath *hostPath              `yaml:"hostPath"`
+	EmptyDir map[string]interface{} `yaml:"emptyDir"`
+}
+
+type hostPath struct {
+	Path string `yaml:"path"`
+}
+
+func decodeObjects(b []byte) (r []object, err error) {
+	for _, doc := range yamlDocSeparator.Split(string(b), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		o := object{}
+		if err = yaml.Unmarshal([]byte(doc), &o); err != nil {
+			return nil, errors.New(err.Error())
+		}
+		r = append(r, o)
+	}
+	return
+}
+
+// Converts a pod's containers into services. A single-container pod
+// yields a service named like the pod while the services of a
+// multi-container pod are named POD-CONTAINER. Since every service runs
+// in its own network namespace the pod's containers do not share
+// localhost as they would in Kubernetes.
+func addPod(name string, replicas *uint, pod *podSpec, r *model.CompoundServices, warn log.Logger) (err error) {
+	if name == "" {
+		return errors.New("pod without metadata.name")
+	}
+	defer exterrors.Wrapdf(&err, "pod %s", name)
+	if len(pod.InitContainers) > 0 {
+		warn.Printf("ignoring init containers of pod %s", name)
+	}
+	if len(pod.Containers) == 0 {
+		return errors.New("pod declares no containers")
+	}
+	if len(pod.Containers) > 1 {
+		warn.Printf("pod %s containers do not share a network namespace", name)
+	}
+	podVolumes := map[string]podVolume{}
+	for _, v := range pod.Volumes {
+		podVolumes[v.Name] = v
+	}
+	for _, c := range pod.Containers {
+		serviceName := name
+		if len(pod.Containers) > 1 {
+			serviceName = name + "-" + c.Name
+		}
+		if _, ok := r.Services[serviceName]; ok {
+			return errors.Errorf("duplicate service name %s", serviceName)
+		}
+		s := model.NewService(serviceName)
+		if c.Image == "" {
+			return errors.Errorf("container %s declares no image", c.Name)
+		}
+		s.Image = "docker://" + c.Image
+		s.Entrypoint = c.Command
+		s.Command = c.Args
+		s.Cwd = c.WorkingDir
+		s.Tty = c.Tty
+		s.StdinOpen = c.Stdin
+		s.Hostname = pod.Hostname
+		s.Restart = toRestartPolicy(pod.RestartPolicy)
+		if len(c.Env) > 0 {
+			s.Environment = map[string]string{}
+			for _, e := range c.Env {
+				s.Environment[e.Name] = e.Value
+			}
+		}
+		for _, p := range c.Ports {
+			prot := strings.ToLower(p.Protocol)
+			if prot == "" {
+				prot = "tcp"
+			}
+			if p.HostPort > 0 {
+				s.Ports = append(s.Ports, model.PortBinding{
+					Published: p.HostPort,
+					Target:    p.ContainerPort,
+					Protocol:  prot,
+					IP:        p.HostIP,
+				})
+			} else {
+				s.Expose = append(s.Expose, strconv.Itoa(int(p.ContainerPort)))
+			}
+		}
+		if s.Volumes, err = toVolumeMounts(name, c.VolumeMounts, podVolumes, r.Volumes); err != nil {
+			return
+		}
+		if s.Cpus, err = toCpus(c.Resources.Limits.Cpu); err != nil {
+			return
+		}
+		if s.Memory, err = toMemory(c.Resources.Limits.Memory); err != nil {
+			return
+		}
+		if replicas != nil {
+			s.Deploy = &model.Deploy{Replicas: replicas}
+		}
+		r.Services[serviceName] = s
+	}
+	return
+}
+
+func toRestartPolicy(policy string) string {
+	switch policy {
+	case "Always", "":
+		// Kubernetes' default restart policy is Always but restarting is
+		// left to the user here unless requested explicitly
+		if policy == "" {
+			return ""
+		}
+		return "always"
+	case "OnFailure":
+		return "on-failure"
+	}
+	return ""
+}
+
+// Maps a container's volumeMounts using the pod's volume declarations:
+// a hostPath volume becomes a bind mount while an emptyDir volume
+// becomes a temporary named volume prefixed with the pod name
+func toVolumeMounts(podName string, mounts []volumeMount, podVolumes map[string]podVolume, volumes map[string]model.Volume) (r []model.VolumeMount, err error) {
+	for _, m := range mounts {
+		v, ok := podVolumes[m.Name]
+		if !ok {
+			return nil, errors.Errorf("volume mount %s refers to an undeclared volume", m.Name)
+		}
+		var opts []string
+		if m.ReadOnly {
+			opts = []string{"ro"}
+		}
+		if v.HostPath != nil {
+			r = append(r, model.VolumeMount{
+				Type:    model.MOUNT_TYPE_BIND,
+				Source:  v.HostPath.Path,
+				Target:  m.MountPath,
+				Options: opts,
+			})
+			continue
+		}
+		volName := podName + "-" + v.Name
+		volumes[volName] = model.Volume{}
+		r = append(r, model.VolumeMount{
+			Type:    model.MOUNT_TYPE_VOLUME,
+			Source:  volName,
+			Target:  m.MountPath,
+			Options: opts,
+		})
+	}
+	return
+}
+
+// Parses a Kubernetes CPU quantity (cores or millicores, e.g. "500m")
+func toCpus(q string) (r *float64, err error) {
+	if q == "" {
+		return
+	}
+	var cpus float64
+	if strings.HasSuffix(q, "m") {
+		millis, e := strconv.ParseFloat(strings.TrimSuffix(q, "m"), 64)
+		if e != nil {
+			return nil, errors.Errorf("invalid cpu limit %q", q)
+		}
+		cpus = millis / 1000
+	} else if cpus, err = strconv.ParseFloat(q, 64); err != nil {
+		return nil, errors.Errorf("invalid cpu limit %q", q)
+	}
+	return &cpus, nil
+}
+
+// Parses a Kubernetes memory quantity (bytes with an optional binary or
+// decimal suffix, e.g. "64Mi")
+func toMemory(q string) (r *int64, err error) {
+	if q == "" {
+		return
+	}
+	suffixes := []struct {
+		suffix string
+		factor int64
+	}{
+		{"Ki", 1024},
+		{"Mi", 1024 * 1024},
+		{"Gi", 1024 * 1024 * 1024},
+		{"Ti", 1024 * 1024 * 1024 * 1024},
+		{"K", 1000},
+		{"M", 1000 * 1000},
+		{"G", 1000 * 1000 * 1000},
+		{"T", 1000 * 1000 * 1000 * 1000},
+	}
+	num := q
+	factor := int64(1)
+	for _, s := range suffixes {
+		if strings.HasSuffix(q, s.suffix) {
+			num = strings.TrimSuffix(q, s.suffix)
+			factor = s.factor
+			break
+		}
+	}
+	n, e := strconv.ParseInt(num, 10, 64)
+	if e != nil {
+		return nil, errors.Errorf("invalid memory limit %q", q)
+	}
+	n *= factor
+	return &n, nil
+}
@@ -0,0 +1,108 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mgoltzsche/ctnr/model"
+	"github.com/mgoltzsche/ctnr/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctnr-k8s-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "pod.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  hostname: webhost
+  restartPolicy: OnFailure
+  volumes:
+    - name: content
+      hostPath:
+        path: /srv/www
+    - name: cache
+      emptyDir: {}
+  containers:
+    - name: nginx
+      image: nginx:alpine
+      command: ["nginx"]
+      args: ["-g", "daemon off;"]
+      workingDir: /srv
+      env:
+        - name: FOO
+          value: bar
+      ports:
+        - containerPort: 80
+          hostPort: 8080
+        - containerPort: 9090
+      volumeMounts:
+        - name: content
+          mountPath: /usr/share/nginx/html
+          readOnly: true
+        - name: cache
+          mountPath: /var/cache/nginx
+      resources:
+        limits:
+          cpu: 500m
+          memory: 64Mi
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: worker
+          image: busybox
+`), 0644))
+	project, err := Load(file, dir, log.NewNopLogger())
+	require.NoError(t, err)
+	require.Len(t, project.Services, 2)
+
+	web := project.Services["web"]
+	assert.Equal(t, "docker://nginx:alpine", web.Image)
+	assert.Equal(t, []string{"nginx"}, web.Entrypoint)
+	assert.Equal(t, []string{"-g", "daemon off;"}, web.Command)
+	assert.Equal(t, "/srv", web.Cwd)
+	assert.Equal(t, "webhost", web.Hostname)
+	assert.Equal(t, "on-failure", web.Restart)
+	assert.Equal(t, map[string]string{"FOO": "bar"}, web.Environment)
+	assert.Equal(t, []model.PortBinding{{Target: 80, Published: 8080, Protocol: "tcp"}}, web.Ports)
+	assert.Equal(t, []string{"9090"}, web.Expose)
+	require.Len(t, web.Volumes, 2)
+	assert.Equal(t, model.VolumeMount{
+		Type:    model.MOUNT_TYPE_BIND,
+		Source:  "/srv/www",
+		Target:  "/usr/share/nginx/html",
+		Options: []string{"ro"},
+	}, web.Volumes[0])
+	assert.Equal(t, model.VolumeMount{
+		Type:   model.MOUNT_TYPE_VOLUME,
+		Source: "web-cache",
+		Target: "/var/cache/nginx",
+	}, web.Volumes[1])
+	_, ok := project.Volumes["web-cache"]
+	assert.True(t, ok, "the emptyDir volume should be declared as named volume")
+	require.NotNil(t, web.Cpus)
+	assert.Equal(t, 0.5, *web.Cpus)
+	require.NotNil(t, web.Memory)
+	assert.Equal(t, int64(64*1024*1024), *web.Memory)
+
+	worker := project.Services["worker"]
+	assert.Equal(t, "docker://busybox", worker.Image)
+	require.NotNil(t, worker.Deploy)
+	require.NotNil(t, worker.Deploy.Replicas)
+	assert.Equal(t, uint(3), *worker.Deploy.Replicas)
+}
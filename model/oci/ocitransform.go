@@ -9,18 +9,29 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/mgoltzsche/ctnr/bundle"
 	"github.com/mgoltzsche/ctnr/bundle/builder"
 	"github.com/mgoltzsche/ctnr/model"
 	"github.com/mgoltzsche/ctnr/pkg/idutils"
 	"github.com/mgoltzsche/ctnr/pkg/sliceutils"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
 const (
-	ANNOTATION_BUNDLE_IMAGE_NAME = "com.github.mgoltzsche.ctnr.bundle.image.name"
-	ANNOTATION_BUNDLE_CREATED    = "com.github.mgoltzsche.ctnr.bundle.created"
-	ANNOTATION_BUNDLE_ID         = "com.github.mgoltzsche.ctnr.bundle.id"
+	ANNOTATION_BUNDLE_IMAGE_NAME     = "com.github.mgoltzsche.ctnr.bundle.image.name"
+	ANNOTATION_BUNDLE_IMAGE_DIGEST   = "com.github.mgoltzsche.ctnr.bundle.image.digest"
+	ANNOTATION_BUNDLE_CREATED        = "com.github.mgoltzsche.ctnr.bundle.created"
+	ANNOTATION_BUNDLE_ID             = "com.github.mgoltzsche.ctnr.bundle.id"
+	ANNOTATION_BUNDLE_RESTART_POLICY = "com.github.mgoltzsche.ctnr.bundle.restart"
+	ANNOTATION_BUNDLE_HEALTHCHECK    = "com.github.mgoltzsche.ctnr.bundle.healthcheck"
+	ANNOTATION_COMPOSE_PROJECT       = "com.github.mgoltzsche.ctnr.compose.project"
+	ANNOTATION_COMPOSE_SERVICE       = "com.github.mgoltzsche.ctnr.compose.service"
+
+	// Default seccomp profile location that administrators can provide to
+	// override the generated runtime-tools default profile
+	DEFAULT_SECCOMP_PROFILE = "/etc/ctnr/seccomp.json"
 )
 
 func ToSpec(service *model.Service, res model.ResourceResolver, rootless bool, ipamDataDir string, prootPath string, spec *builder.BundleBuilder) (err error) {
@@ -38,6 +49,12 @@ func ToSpec(service *model.Service, res model.ResourceResolver, rootless bool, i
 		return
 	}
 
+	if service.ClockOffset != nil {
+		if err = spec.SetClockOffset(*service.ClockOffset); err != nil {
+			return
+		}
+	}
+
 	// Readonly rootfs, mounts
 	spec.SetRootReadonly(service.ReadOnly)
 
@@ -45,6 +62,10 @@ func ToSpec(service *model.Service, res model.ResourceResolver, rootless bool, i
 		return
 	}
 
+	if err = toDevices(service.Devices, rootless, spec, sp); err != nil {
+		return
+	}
+
 	// privileged
 	seccomp := service.Seccomp
 	cgroupsMount := service.MountCgroups
@@ -66,9 +87,22 @@ func ToSpec(service *model.Service, res model.ResourceResolver, rootless bool, i
 	}
 
 	// Annotations
+	for k, v := range service.Labels {
+		spec.AddAnnotation(k, v)
+	}
 	if service.StopSignal != "" {
 		spec.AddAnnotation("org.opencontainers.image.stopSignal", service.StopSignal)
 	}
+	if service.Restart != "" && service.Restart != "no" {
+		spec.AddAnnotation(ANNOTATION_BUNDLE_RESTART_POLICY, service.Restart)
+	}
+	if service.HealthCheck != nil && !service.HealthCheck.Disable {
+		checkJson, e := json.Marshal(service.HealthCheck)
+		if e != nil {
+			return errors.Wrap(e, "marshal healthcheck")
+		}
+		spec.AddAnnotation(ANNOTATION_BUNDLE_HEALTHCHECK, string(checkJson))
+	}
 	if service.Expose != nil {
 		// Merge exposedPorts annotation
 		exposedPortsAnn := ""
@@ -97,30 +131,74 @@ func ToSpec(service *model.Service, res model.ResourceResolver, rootless bool, i
 	}
 
 	// Seccomp
-	if seccomp == "" || seccomp == "default" {
-		// Derive seccomp configuration (must be called as last)
-		spec.SetLinuxSeccompDefault()
-	} else if seccomp == "unconfined" {
+	switch seccomp {
+	case "", "default":
+		// Prefer an administrator-provided default profile over the
+		// generated runtime-tools default
+		if _, e := os.Stat(DEFAULT_SECCOMP_PROFILE); e == nil {
+			err = seccompFromFile(DEFAULT_SECCOMP_PROFILE, spec)
+		} else {
+			// Derive seccomp configuration (must be called as last)
+			spec.SetLinuxSeccompDefault()
+		}
+	case "unconfined":
 		// Do not restrict operations with seccomp
 		spec.SetLinuxSeccompUnconfined()
-	} else {
-		// Use seccomp configuration from file
-		var j []byte
-		if j, err = ioutil.ReadFile(res.ResolveFile(seccomp)); err != nil {
-			return
-		}
-		seccomp := &specs.LinuxSeccomp{}
-		if err = json.Unmarshal(j, seccomp); err != nil {
-			return
+	case "audit-log":
+		// Built-in profile: default allowlist that traces syscalls the
+		// default profile would deny instead of killing the process
+		spec.SetLinuxSeccompDefault()
+		if sp.Linux != nil && sp.Linux.Seccomp != nil {
+			sp.Linux.Seccomp.DefaultAction = specs.ActTrace
 		}
-		spec.SetLinuxSeccomp(seccomp)
+	case "block-network":
+		// Built-in profile: allow everything except socket creation
+		spec.SetLinuxSeccomp(&specs.LinuxSeccomp{
+			DefaultAction: specs.ActAllow,
+			Syscalls: []specs.LinuxSyscall{{
+				Names:  []string{"socket", "socketpair"},
+				Action: specs.ActErrno,
+			}},
+		})
+	default:
+		// Use seccomp configuration from file
+		err = seccompFromFile(res.ResolveFile(seccomp), spec)
+	}
+	if err != nil {
+		return
 	}
 
 	if !rootless {
 		// Limit resources
-		//spec.SetLinuxResourcesPidsLimit(32771)
-		//spec.AddLinuxResourcesHugepageLimit("2MB", 9223372036854772000)
-		// TODO: add options to limit memory, cpu and blockIO access
+		if service.CpuShares != nil {
+			spec.SetLinuxResourcesCPUShares(*service.CpuShares)
+		}
+		if service.Memory != nil {
+			spec.SetLinuxResourcesMemoryLimit(*service.Memory)
+		}
+		if service.MemorySwap != nil {
+			spec.SetLinuxResourcesMemorySwap(*service.MemorySwap)
+		}
+		if service.Cpus != nil {
+			// Express fractional cpus as CFS quota within the default period
+			period := uint64(100000)
+			spec.SetLinuxResourcesCPUPeriod(period)
+			spec.SetLinuxResourcesCPUQuota(int64(*service.Cpus * float64(period)))
+		}
+		if service.PidsLimit != nil {
+			spec.SetLinuxResourcesPidsLimit(*service.PidsLimit)
+		}
+		for _, l := range service.HugepageLimits {
+			if err = spec.AddHugepageLimit(l.PageSize, l.Limit); err != nil {
+				return
+			}
+		}
+		if service.IntelRdtL3CacheSchema != "" {
+			if err = spec.SetIntelRdtL3CacheSchema(service.IntelRdtL3CacheSchema); err != nil {
+				return
+			}
+		}
+		// TODO: add options to limit blockIO access
 
 		/*// Add network priority
 		spec.Linux.Resources.Network.ClassID = ""
@@ -130,6 +208,21 @@ func ToSpec(service *model.Service, res model.ResourceResolver, rootless bool, i
 		}*/
 	}
 
+	// Join another container's network, IPC and UTS namespaces instead of
+	// creating and configuring own ones (network_mode resolved into the
+	// pid of the running container, e.g. a pod's infra container)
+	if service.SharedNamespacesPid > 0 {
+		if len(service.Networks) > 0 {
+			return errors.New("transform: networks cannot be combined with network_mode")
+		}
+		if len(service.Ports) > 0 {
+			return errors.New("transform: port mappings are not supported in combination with network_mode - publish the ports on the joined container instead")
+		}
+		return spec.JoinSharedNamespaces(service.SharedNamespacesPid)
+	} else if service.NetworkMode != "" {
+		return errors.Errorf("transform: network_mode %q is unresolved - the referenced container must be running", service.NetworkMode)
+	}
+
 	// Init network IDs or host mode
 	networks := service.Networks
 	useNoNetwork := sliceutils.Contains(networks, "none")
@@ -173,6 +266,9 @@ func ToSpec(service *model.Service, res model.ResourceResolver, rootless bool, i
 		for _, net := range networks {
 			hook.AddNetwork(net)
 		}
+		for name, value := range service.NetworkOpts {
+			hook.AddNetworkOpt(name, value)
+		}
 		if service.Domainname != "" {
 			hook.SetDomainname(service.Domainname)
 		}
@@ -253,6 +349,75 @@ func mountHostFile(spec *specs.Spec, file string) error {
 	return nil
 }
 
+// Adds the given host devices to the spec's linux.devices section and,
+// unless running rootless, allows access to them within the device cgroup
+func toDevices(devices []model.Device, rootless bool, spec *builder.BundleBuilder, sp *specs.Spec) (err error) {
+	for _, d := range devices {
+		var st unix.Stat_t
+		if err = unix.Stat(d.Source, &st); err != nil {
+			return errors.Wrapf(err, "device %s", d.Source)
+		}
+		var devType string
+		switch st.Mode & unix.S_IFMT {
+		case unix.S_IFBLK:
+			devType = "b"
+		case unix.S_IFCHR:
+			devType = "c"
+		default:
+			return errors.Errorf("device %s is neither a character nor a block device", d.Source)
+		}
+		target := d.Target
+		if target == "" {
+			target = d.Source
+		}
+		major := int64(unix.Major(st.Rdev))
+		minor := int64(unix.Minor(st.Rdev))
+		mode := os.FileMode(st.Mode & 0777)
+		uid := st.Uid
+		gid := st.Gid
+		spec.AddDevice(specs.LinuxDevice{
+			Path:     target,
+			Type:     devType,
+			Major:    major,
+			Minor:    minor,
+			FileMode: &mode,
+			UID:      &uid,
+			GID:      &gid,
+		})
+		if !rootless {
+			perms := d.Permissions
+			if perms == "" {
+				perms = "rwm"
+			}
+			if sp.Linux.Resources == nil {
+				sp.Linux.Resources = &specs.LinuxResources{}
+			}
+			sp.Linux.Resources.Devices = append(sp.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+				Allow:  true,
+				Type:   devType,
+				Major:  &major,
+				Minor:  &minor,
+				Access: perms,
+			})
+		}
+	}
+	return
+}
+
+// Loads a seccomp profile from the given file
+func seccompFromFile(file string, spec *builder.BundleBuilder) (err error) {
+	j, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	seccomp := &specs.LinuxSeccomp{}
+	if err = json.Unmarshal(j, seccomp); err != nil {
+		return
+	}
+	spec.SetLinuxSeccomp(seccomp)
+	return
+}
+
 func ToSpecProcess(p *model.Process, prootPath string, builder *builder.SpecBuilder) (err error) {
 	// Entrypoint & command
 	if p.Entrypoint != nil {
@@ -322,6 +487,17 @@ func ToSpecProcess(p *model.Process, prootPath string, builder *builder.SpecBuil
 
 func toMounts(mounts []model.VolumeMount, res model.ResourceResolver, spec *builder.BundleBuilder) error {
 	for _, m := range mounts {
+		if m.Type == model.MOUNT_TYPE_TMPFS {
+			// Mount a fresh tmpfs instead of binding a volume directory
+			opts := m.Options
+			if len(opts) == 0 {
+				// Apply default tmpfs mount options
+				opts = []string{"nosuid", "nodev", "mode=1777"}
+			}
+			spec.AddTmpfsMount(m.Target, opts)
+			continue
+		}
+
 		src, err := res.ResolveMountSource(m)
 		if err != nil {
 			return err
@@ -331,13 +507,17 @@ func toMounts(mounts []model.VolumeMount, res model.ResourceResolver, spec *buil
 		if t == "" || t == model.MOUNT_TYPE_VOLUME {
 			t = model.MOUNT_TYPE_BIND
 		}
-		opts := m.Options
+		opts, create := bundle.SplitMountCreateOptions(m.Options)
 		if len(opts) == 0 {
 			// Apply default mount options. See man7.org/linux/man-pages/man8/mount.8.html
 			opts = []string{"bind", "nodev", "mode=0755"}
 		} else {
 			sliceutils.AddToSet(&opts, "bind")
 		}
+		if create != "" {
+			// Preserve the source creation policy for bundle spec application
+			opts = append(opts, "create-"+create)
+		}
 
 		sp := spec.Generator.Spec()
 		sp.Mounts = append(sp.Mounts, specs.Mount{
@@ -63,14 +63,24 @@ func (self *resourceResolver) named(src string) (string, error) {
 		return "", errors.Errorf("volume %q not found", src)
 	}
 	if v.Source == "" {
-		return self.anonymous("!" + src), nil
+		return NamedVolumeDir(src), nil
 	}
 	return v.Source, nil
 }
 
 func (self *resourceResolver) anonymous(id string) string {
-	id = filepath.Clean(id)
-	return filepath.Join("volumes", base32.StdEncoding.EncodeToString([]byte(id)))
+	return AnonymousVolumeDir(id)
+}
+
+// Returns the bundle-relative directory of the named volume
+func NamedVolumeDir(name string) string {
+	return AnonymousVolumeDir("!" + name)
+}
+
+// Returns the bundle-relative directory of the anonymous volume mounted at target
+func AnonymousVolumeDir(target string) string {
+	target = filepath.Clean(target)
+	return filepath.Join("volumes", base32.StdEncoding.EncodeToString([]byte(target)))
 }
 
 func (self *resourceResolver) path(file string) string {
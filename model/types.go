@@ -2,7 +2,9 @@ package model
 
 import (
 	"encoding/json"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,6 +14,9 @@ const (
 	MOUNT_TYPE_VOLUME = MountType("volume")
 	MOUNT_TYPE_BIND   = MountType("bind")
 	MOUNT_TYPE_TMPFS  = MountType("tmpfs")
+
+	DEPENDENCY_CONDITION_STARTED = "service_started"
+	DEPENDENCY_CONDITION_HEALTHY = "service_healthy"
 )
 
 func FromJSON(b []byte) (r CompoundServices, err error) {
@@ -36,22 +41,73 @@ type Service struct {
 	Name         string `json:"-"`
 	Bundle       string `json:"bundle,omitempty"`
 	BundleUpdate bool   `json:"bundle_update,omitempty"`
-	NoPivot      bool   `json:"no_pivot,omitempty"`
-	NoNewKeyring bool   `json:"no_new_keyring,omitempty"`
+	// Derives the bundle ID deterministically from the service name and
+	// options instead of generating a random one
+	DeterministicId bool `json:"deterministic_id,omitempty"`
+	NoPivot         bool `json:"no_pivot,omitempty"`
+	NoNewKeyring    bool `json:"no_new_keyring,omitempty"`
+	// Mounts the rootfs as overlay of shared image layer directories
+	RootfsOverlay bool `json:"rootfs_overlay,omitempty"`
+	// Clones the cached image file system into the rootfs: reflink|hardlink|copy
+	RootfsClone string `json:"rootfs_clone,omitempty"`
+	// Mounts the image's cached squashfs blob read-only as rootfs lower layer
+	RootfsSquashfs bool `json:"rootfs_squashfs,omitempty"`
 
-	Image string      `json:"image,omitempty"`
+	Image string `json:"image,omitempty"`
+	// Pull policy applied when resolving the image: always|missing|never
+	Pull  string      `json:"pull,omitempty"`
 	Build *ImageBuild `json:"build,omitempty"`
+	// Images whose environment variables are copied into the container
+	EnvFrom []string `json:"env_from,omitempty"`
 	Process
-	Seccomp      string `json:"seccomp,omitempty"`
-	MountCgroups string `json:"cgroups_mount_option,omitempty"` // Not read from compose file. TODO: move to CLI only
+	Seccomp string `json:"seccomp,omitempty"`
+	// Opts the container out of the globally configured entrypoint wrapper
+	NoEntrypointWrapper bool   `json:"no_entrypoint_wrapper,omitempty"`
+	MountCgroups        string `json:"cgroups_mount_option,omitempty"` // Not read from compose file. TODO: move to CLI only
+	// Offset applied to the container's monotonic and boot-time clocks
+	// within its own Linux time namespace (requires kernel >=5.6)
+	ClockOffset *time.Duration `json:"clock_offset,omitempty"`
 	NetConf
-	ReadOnly bool          `json:"read_only,omitempty"`
-	Expose   []string      `json:"expose,omitempty"`
-	Volumes  []VolumeMount `json:"volumes,omitempty"`
+	ReadOnly bool              `json:"read_only,omitempty"`
+	Expose   []string          `json:"expose,omitempty"`
+	Volumes  []VolumeMount     `json:"volumes,omitempty"`
+	Devices  []Device          `json:"devices,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Best-effort scheduling priorities
+	CpuShares *uint64 `json:"cpu_shares,omitempty"`
+	IONice    *int    `json:"ionice,omitempty"`
+	// Resource limits mapped into the OCI spec's linux resources section
+	Memory     *int64   `json:"memory,omitempty"`
+	MemorySwap *int64   `json:"memory_swap,omitempty"`
+	Cpus       *float64 `json:"cpus,omitempty"`
+	PidsLimit  *int64   `json:"pids_limit,omitempty"`
+	// Hugepage usage limits in bytes per page size, e.g. 2MB (requires
+	// root and host hugepage support)
+	HugepageLimits []HugepageLimit `json:"hugepage_limits,omitempty"`
+	// Intel RDT L3 cache allocation schema (CAT, requires root and the
+	// resctrl file system mounted at /sys/fs/resctrl)
+	IntelRdtL3CacheSchema string `json:"intel_rdt_l3_cache_schema,omitempty"`
+	// Restart policy: no|on-failure|always|unless-stopped
+	Restart string  `json:"restart,omitempty"`
+	Deploy  *Deploy `json:"deploy,omitempty"`
+	// Startup dependencies on other services of the same project
+	DependsOn []ServiceDependency `json:"depends_on,omitempty"`
+	// Profiles the service is assigned to: it is only enabled when one of
+	// its profiles is enabled while a service without profiles is always
+	// enabled
+	Profiles []string `json:"profiles,omitempty"`
 	// TODO: handle check
-	HealthCheck     *Check         `json:"healthcheck,omitempty"`
+	HealthCheck *Check `json:"healthcheck,omitempty"`
+	// Commands run inside the container after it started or before it is
+	// stopped for initialization tasks like database migrations
+	PostStart       []ExecHook     `json:"post_start,omitempty"`
+	PreStop         []ExecHook     `json:"pre_stop,omitempty"`
 	StopSignal      string         `json:"stop_signal,omitempty"`
 	StopGracePeriod *time.Duration `json:"stop_grace_period,omitempty"`
+	// Host dependencies (TCP addresses or unix socket paths) that must
+	// accept connections before the container is started
+	WaitFor        []string       `json:"wait_for,omitempty"`
+	WaitForTimeout *time.Duration `json:"wait_for_timeout,omitempty"`
 
 	// TODO: uid/gid mapping: spec.AddLinuxUIDMapping(hostid, containerid, size), ... AddLinuxGIDMapping
 }
@@ -80,6 +136,13 @@ type Process struct {
 	//ExtraFiles []*os.File
 }
 
+type HugepageLimit struct {
+	// Hugepage size, e.g. 64KB, 2MB, 1GB
+	PageSize string `json:"page_size"`
+	// Usage limit in bytes
+	Limit uint64 `json:"limit"`
+}
+
 type Rlimit struct {
 	Type string `json:"type"`
 	Hard uint64 `json:"hard"`
@@ -102,6 +165,16 @@ type NetConf struct {
 	ExtraHosts []ExtraHost   `json:"extra_hosts,omitempty"`
 	Ports      []PortBinding `json:"ports,omitempty"`
 	Networks   []string      `json:"networks,omitempty"`
+	// Options passed to the networks, e.g. the host-device network's device
+	NetworkOpts map[string]string `json:"network_opts,omitempty"`
+	// Makes the container join the network, IPC and UTS namespaces of
+	// another container instead of creating and configuring own ones
+	// (supported values: container:ID, service:NAME, pod:NAME)
+	NetworkMode string `json:"network_mode,omitempty"`
+	// Pid of the running container whose namespaces are joined. It is
+	// resolved from NetworkMode before the spec is generated and
+	// therefore not part of the JSON representation.
+	SharedNamespacesPid int `json:"-"`
 }
 
 type ExtraHost struct {
@@ -166,24 +239,129 @@ func (m VolumeMount) String() string {
 	return s
 }
 
+// Host device passed through into the container
+type Device struct {
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	// Device cgroup permissions: any of r, w, m
+	Permissions string `json:"permissions,omitempty"`
+}
+
+func (d Device) String() string {
+	s := d.Source
+	if d.Target != "" {
+		s += ":" + d.Target
+	}
+	if d.Permissions != "" {
+		s += ":" + d.Permissions
+	}
+	return s
+}
+
 type Volume struct {
 	Source   string `json:"source,omitempty"`
 	External string `json:"external,omitempty"` // Name of an external volume
 }
 
+// Deployment configuration of a scaled service
+type Deploy struct {
+	Replicas     *uint         `json:"replicas,omitempty"`
+	UpdateConfig *UpdateConfig `json:"update_config,omitempty"`
+}
+
+// Controls how a service's replicas are recreated during a rolling update
+type UpdateConfig struct {
+	Parallelism uint           `json:"parallelism,omitempty"`
+	Delay       *time.Duration `json:"delay,omitempty"`
+}
+
+// Startup dependency on another service of the same project
+type ServiceDependency struct {
+	Service string `json:"service"`
+	// Start condition: service_started (default) or service_healthy
+	Condition string `json:"condition,omitempty"`
+}
+
+// Command executed inside the running container after it started
+// (post_start) or before it is stopped (pre_stop)
+type ExecHook struct {
+	Command []string       `json:"command"`
+	Timeout *time.Duration `json:"timeout,omitempty"`
+	// Failure policy: abort (default) fails the operation while
+	// ignore only logs the error and continues
+	OnFailure string `json:"on_failure,omitempty"`
+}
+
 type Check struct {
-	Command []string `json:"cmd"`
-	//Http     string        `json:"http"`
+	Command []string `json:"cmd,omitempty"`
+	// Probes performed from the host's network namespace
+	Tcp      string         `json:"tcp,omitempty"`
+	Http     string         `json:"http,omitempty"`
 	Interval *time.Duration `json:"interval"`
 	Timeout  *time.Duration `json:"timeout"`
 	Retries  uint           `json:"retries,omitempty"`
 	Disable  bool           `json:"disable,omitempty"`
 }
 
+// Derives the check's probe type from the given test expression: tcp:// and
+// http(s):// URLs are probed natively from the host's network namespace
+// while anything else is run as shell command inside the container.
+func (c *Check) SetProbe(test string) {
+	if strings.HasPrefix(test, "tcp://") {
+		c.Tcp = strings.TrimPrefix(test, "tcp://")
+	} else if strings.HasPrefix(test, "http://") || strings.HasPrefix(test, "https://") {
+		c.Http = test
+	} else {
+		c.Command = []string{"/bin/sh", "-c", test}
+	}
+}
+
 func NewService(name string) Service {
 	return Service{Name: name}
 }
 
+// Returns the services sorted in dependency order so that every service
+// appears after the services it depends on. Returns an error when a
+// service depends on an undeclared service or the dependency graph
+// contains a cycle.
+func (c *CompoundServices) SortedServices() (r []Service, err error) {
+	r = make([]Service, 0, len(c.Services))
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	visited := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch visited[name] {
+		case 2:
+			return nil
+		case 1:
+			return errors.Errorf("service dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		s, ok := c.Services[name]
+		if !ok {
+			return errors.Errorf("service %s depends on undeclared service %s", path[len(path)-1], name)
+		}
+		visited[name] = 1
+		for _, dep := range s.DependsOn {
+			if err := visit(dep.Service, append(path, name)); err != nil {
+				return err
+			}
+		}
+		visited[name] = 2
+		r = append(r, s)
+		return nil
+	}
+	for _, name := range names {
+		if err = visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
 func (c *CompoundServices) JSON() string {
 	return toJSON(c)
 }
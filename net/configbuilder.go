@@ -108,6 +108,13 @@ func (b *ConfigFileGenerator) WriteConfigFiles(rootfs, overlay string) error {
 func (b *ConfigFileGenerator) writeResolvConf(dest string) error {
 	rc := ""
 
+	if len(b.dnsNameserver) == 0 {
+		// Fall back to the host's nameservers within a marked section that
+		// 'ctnr net sync-dns' can rewrite when the host's resolver changes
+		if hostNs, err := ReadNameservers(HostResolvConfFile()); err == nil && len(hostNs) > 0 {
+			rc += hostDnsSection(hostNs)
+		}
+	}
 	for _, ns := range b.dnsNameserver {
 		rc += "nameserver " + ns + "\n"
 	}
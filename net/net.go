@@ -25,7 +25,7 @@ func NewNetConfigs(confDir string) *NetConfigs {
 	return &NetConfigs{confDir}
 }
 
-func (n *NetConfigs) GetConfig(name string) (*libcni.NetworkConfigList, error) {
+func (n *NetConfigs) GetConfig(name string, opts map[string]string) (*libcni.NetworkConfigList, error) {
 	l, err := libcni.LoadConfList(n.confDir, name)
 	if err != nil {
 		_, noConfDir := err.(libcni.NoConfigsFoundError)
@@ -38,6 +38,8 @@ func (n *NetConfigs) GetConfig(name string) (*libcni.NetworkConfigList, error) {
 				return defaultSlirpConf()
 			case "bridge":
 				return defaultBridgeConf()
+			case "host-device":
+				return defaultHostDeviceConf(opts["device"])
 			}
 		}
 	}
@@ -126,6 +128,63 @@ func defaultBridgeConf() (cfg *libcni.NetworkConfigList, err error) {
 	})
 }
 
+// Moves the given host NIC or SR-IOV VF into the container's network
+// namespace at start and returns it on stop (CNI host-device plugin)
+func defaultHostDeviceConf(device string) (cfg *libcni.NetworkConfigList, err error) {
+	if device == "" {
+		return nil, errors.New("host-device net conf: no device provided. hint: use the device=NAME network option")
+	}
+	return toConfList(map[string]interface{}{
+		"cniVersion": version.Current(),
+		"name":       "host-device",
+		"plugins": []interface{}{
+			map[string]interface{}{
+				"cniVersion": version.Current(),
+				"type":       "host-device",
+				"device":     device,
+			},
+		},
+	})
+}
+
+// Parses structured capability args (e.g. bandwidth, ipRanges, dns) from the
+// network options: an option whose value is a JSON document is passed to the
+// CNI plugins as CapabilityArgs in addition to the CAP_ARGS env var.
+func CapabilityArgs(opts map[string]string) (r map[string]interface{}, err error) {
+	for name, value := range opts {
+		if !strings.HasPrefix(value, "{") && !strings.HasPrefix(value, "[") {
+			continue
+		}
+		var arg interface{}
+		if err = json.Unmarshal([]byte(value), &arg); err != nil {
+			return nil, errors.Wrapf(err, "parse network option %q as capability args", name)
+		}
+		if r == nil {
+			r = map[string]interface{}{}
+		}
+		r[name] = arg
+	}
+	return
+}
+
+// Validates that each capability arg is declared as supported
+// by at least one plugin of the given chain.
+func ValidateCapabilities(netConf *libcni.NetworkConfigList, capArgs map[string]interface{}) (err error) {
+	for name := range capArgs {
+		supported := false
+		for _, plugin := range netConf.Plugins {
+			if plugin.Network.Capabilities[name] {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return errors.Errorf("capability %q is not declared by any plugin of network %q", name, netConf.Name)
+		}
+	}
+	return
+}
+
 func toConfList(rawConfigList map[string]interface{}) (cfg *libcni.NetworkConfigList, err error) {
 	b, err := json.Marshal(rawConfigList)
 	if err == nil {
@@ -215,6 +274,17 @@ func NewNetManager(state *specs.State) (r *NetManager, err error) {
 	return
 }
 
+// Adds per-attachment capability args that are passed to the CNI plugins
+// in addition to those read from the CAP_ARGS env var.
+func (m *NetManager) AddCapabilityArgs(capArgs map[string]interface{}) {
+	for name, arg := range capArgs {
+		if m.capabilityArgs == nil {
+			m.capabilityArgs = map[string]interface{}{}
+		}
+		m.capabilityArgs[name] = arg
+	}
+}
+
 // Resolves the configured CNI network by name
 // and adds it to the container process' network namespace.
 func (m *NetManager) AddNet(ifName string, netConf *libcni.NetworkConfigList) (r *current.Result, err error) {
@@ -0,0 +1,84 @@
+package net
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// Name of the built-in pasta network backend
+const PastaNetwork = "pasta"
+
+// Attaches pasta (passt's network namespace mode) to the container's network
+// namespace as rootless network backend. pasta copies the host's addresses
+// and routes into the namespace which preserves source IPs and host routes
+// (e.g. after VPN changes) with near-native performance - as alternative to
+// a slirp CNI plugin.
+// pasta daemonizes itself after setup and terminates with the namespace.
+func AddPastaNet(state *specs.State, ports []PortMapEntry) (err error) {
+	defer func() {
+		err = errors.WithMessage(err, "add pasta network")
+	}()
+	if state.Pid <= 0 {
+		return errors.New("no container process to attach to")
+	}
+	bin, err := exec.LookPath("pasta")
+	if err != nil {
+		return errors.New("pasta binary not found within $PATH. hint: pasta is contained in the passt package")
+	}
+	args := []string{
+		"--config-net",
+		"--pid", pastaPidFile(state),
+		"--netns", fmt.Sprintf("/proc/%d/ns/net", state.Pid),
+	}
+	for _, p := range ports {
+		opt := "-t"
+		if strings.ToLower(p.Protocol) == "udp" {
+			opt = "-u"
+		}
+		hostPort := p.HostPort
+		if hostPort == 0 {
+			hostPort = p.ContainerPort
+		}
+		fwd := strconv.Itoa(int(hostPort)) + ":" + strconv.Itoa(int(p.ContainerPort))
+		if p.HostIP != "" {
+			fwd = p.HostIP + "/" + fwd
+		}
+		args = append(args, opt, fwd)
+	}
+	return runCmd(bin, args...)
+}
+
+// Terminates the container's pasta process if it is still running
+func DelPastaNet(state *specs.State) (err error) {
+	pidFile := pastaPidFile(state)
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// pasta terminates with the network namespace
+			return nil
+		}
+		return errors.Wrap(err, "del pasta network")
+	}
+	os.Remove(pidFile)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return errors.Wrap(err, "del pasta network: read pid file")
+	}
+	if e := syscall.Kill(pid, syscall.SIGTERM); e != nil && e != syscall.ESRCH {
+		return errors.Wrap(e, "del pasta network")
+	}
+	return
+}
+
+func pastaPidFile(state *specs.State) string {
+	return filepath.Join(state.Bundle, "pasta.pid")
+}
@@ -0,0 +1,233 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	gonet "net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// Environment variable pointing at a privileged copy of the ctnr binary
+// (setuid root or carrying the cap_net_bind_service file capability)
+// that is used to bind privileged host ports for rootless containers.
+// Defaults to the running binary.
+const PortBindHelperEnv = "CTNR_PORTBIND_HELPER"
+
+// Returns the port mappings whose effective host port is privileged
+// (<1024) and therefore cannot be bound by an unprivileged process
+func PrivilegedPorts(ports []PortMapEntry) (r []PortMapEntry) {
+	for _, p := range ports {
+		if hostPort(p) < 1024 {
+			r = append(r, p)
+		}
+	}
+	return
+}
+
+// Starts the privileged port binding helper for the container: the
+// helper binds the given privileged host ports and forwards their
+// connections to the container. Readiness is negotiated at start - the
+// call does not return before all ports are bound - and the helper's
+// pid file allows ReleasePrivilegedPorts to terminate it with the
+// container.
+func BindPrivilegedPorts(state *specs.State, targetIP string, ports []PortMapEntry) (err error) {
+	defer func() {
+		err = errors.WithMessage(err, "bind privileged ports")
+	}()
+	if targetIP == "" {
+		return errors.New("no container IP to forward to")
+	}
+	helper := os.Getenv(PortBindHelperEnv)
+	if helper == "" {
+		if helper, err = os.Executable(); err != nil {
+			return errors.New(err.Error())
+		}
+	}
+	args := []string{"net", "portbind", "--target", targetIP, "--pid-file", portBindPidFile(state)}
+	for _, p := range ports {
+		args = append(args, formatPortBindSpec(p))
+	}
+	c := exec.Command(helper, args...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if err = c.Start(); err != nil {
+		return errors.New(err.Error())
+	}
+	// The helper reports readiness after it bound all ports
+	line, e := bufio.NewReader(stdout).ReadString('\n')
+	if e != nil || strings.TrimSpace(line) != "ready" {
+		c.Process.Kill()
+		c.Wait()
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = "helper terminated without reporting readiness"
+		}
+		return errors.New(msg + ". hint: the helper requires the cap_net_bind_service capability - install a privileged ctnr copy and point " + PortBindHelperEnv + " at it")
+	}
+	// The helper keeps running detached until ReleasePrivilegedPorts
+	// terminates it
+	go c.Wait()
+	return
+}
+
+// Terminates the container's port binding helper if one is running
+func ReleasePrivilegedPorts(state *specs.State) (err error) {
+	pidFile := portBindPidFile(state)
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "release privileged ports")
+	}
+	os.Remove(pidFile)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return errors.Wrap(err, "release privileged ports: read pid file")
+	}
+	if e := syscall.Kill(pid, syscall.SIGTERM); e != nil && e != syscall.ESRCH {
+		return errors.Wrap(e, "release privileged ports")
+	}
+	return
+}
+
+// Runs the port binding helper process: binds the given privileged host
+// ports - or adopts listeners passed in via systemd socket activation -
+// and forwards their TCP connections to the container. Readiness is
+// reported by printing "ready" on stdout once all ports are bound.
+func RunPortBindHelper(targetIP, pidFile string, portSpecs []string) (err error) {
+	ports := make([]PortMapEntry, len(portSpecs))
+	for i, spec := range portSpecs {
+		if ports[i], err = parsePortBindSpec(spec); err != nil {
+			return
+		}
+	}
+	listeners, err := activationListeners()
+	if err != nil {
+		return
+	}
+	for i, p := range ports {
+		if prot := strings.ToLower(p.Protocol); prot != "" && prot != "tcp" {
+			return errors.Errorf("port binding helper supports tcp only but %s was requested for port %d", p.Protocol, hostPort(p))
+		}
+		var l gonet.Listener
+		if i < len(listeners) {
+			l = listeners[i]
+		} else if l, err = gonet.Listen("tcp", gonet.JoinHostPort(p.HostIP, strconv.Itoa(hostPort(p)))); err != nil {
+			return errors.New(err.Error())
+		}
+		go forwardPort(l, gonet.JoinHostPort(targetIP, strconv.Itoa(int(p.ContainerPort))))
+	}
+	if pidFile != "" {
+		if err = ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+			return errors.New(err.Error())
+		}
+	}
+	fmt.Println("ready")
+	// Forward until the helper is terminated by ReleasePrivilegedPorts
+	select {}
+}
+
+// Returns the listeners passed in by systemd socket activation if any
+// (LISTEN_PID/LISTEN_FDS protocol, file descriptors starting at 3)
+func activationListeners() (r []gonet.Listener, err error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, errors.New("systemd socket activation: invalid LISTEN_FDS value")
+	}
+	for fd := 3; fd < 3+n; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, e := gonet.FileListener(f)
+		f.Close()
+		if e != nil {
+			return nil, errors.Wrap(e, "systemd socket activation")
+		}
+		r = append(r, l)
+	}
+	return
+}
+
+func forwardPort(l gonet.Listener, target string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go forwardConn(conn, target)
+	}
+}
+
+// Proxies a single accepted connection to the container
+func forwardConn(conn gonet.Conn, target string) {
+	defer conn.Close()
+	dest, err := gonet.Dial("tcp", target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "portbind: forward to %s: %s\n", target, err)
+		return
+	}
+	defer dest.Close()
+	done := make(chan struct{}, 2)
+	cp := func(w io.Writer, r io.Reader) {
+		io.Copy(w, r)
+		done <- struct{}{}
+	}
+	go cp(dest, conn)
+	go cp(conn, dest)
+	<-done
+}
+
+// Formats a port mapping in the helper protocol's unambiguous
+// PROT:HOSTIP:HOSTPORT:TARGETPORT form (unlike the user-facing
+// --publish expression the host IP may contain colons)
+func formatPortBindSpec(p PortMapEntry) string {
+	prot := strings.ToLower(p.Protocol)
+	if prot == "" {
+		prot = "tcp"
+	}
+	return fmt.Sprintf("%s:%s:%d:%d", prot, p.HostIP, hostPort(p), p.ContainerPort)
+}
+
+func parsePortBindSpec(spec string) (p PortMapEntry, err error) {
+	s := strings.Split(spec, ":")
+	if len(s) >= 4 {
+		var host, target uint64
+		host, err = strconv.ParseUint(s[len(s)-2], 10, 16)
+		if err == nil {
+			if target, err = strconv.ParseUint(s[len(s)-1], 10, 16); err == nil {
+				hostIp := strings.Join(s[1:len(s)-2], ":")
+				return PortMapEntry{uint16(host), uint16(target), s[0], hostIp}, nil
+			}
+		}
+	}
+	return p, errors.Errorf("invalid port binding spec %q (expected PROT:HOSTIP:HOSTPORT:TARGETPORT)", spec)
+}
+
+func hostPort(p PortMapEntry) int {
+	if p.HostPort == 0 {
+		return int(p.ContainerPort)
+	}
+	return int(p.HostPort)
+}
+
+func portBindPidFile(state *specs.State) string {
+	return filepath.Join(state.Bundle, "portbind.pid")
+}
@@ -0,0 +1,91 @@
+package net
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Markers enclosing the host-derived nameserver section within a generated
+// resolv.conf so that it can be replaced when the host's resolver changes
+const (
+	hostDnsBegin = "# host-dns-begin (managed by ctnr net sync-dns)"
+	hostDnsEnd   = "# host-dns-end"
+)
+
+// Returns the file the host's resolver configuration is effectively
+// maintained in, preferring the resolver managers' files over the (often
+// symlinked) /etc/resolv.conf.
+func HostResolvConfFile() string {
+	for _, file := range []string{
+		"/run/systemd/resolve/resolv.conf",
+		"/run/NetworkManager/resolv.conf",
+		"/etc/resolv.conf",
+	} {
+		if resolved, err := filepath.EvalSymlinks(file); err == nil {
+			return resolved
+		}
+	}
+	return "/etc/resolv.conf"
+}
+
+// Reads the nameserver entries from the given resolv.conf file
+func ReadNameservers(file string) (nameservers []string, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "read nameservers")
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "nameserver" {
+			nameservers = append(nameservers, fields[1])
+		}
+	}
+	return nameservers, errors.Wrap(scanner.Err(), "read nameservers")
+}
+
+// Renders the host-derived nameserver section of a generated resolv.conf
+func hostDnsSection(nameservers []string) string {
+	s := hostDnsBegin + "\n"
+	for _, ns := range nameservers {
+		s += "nameserver " + ns + "\n"
+	}
+	return s + hostDnsEnd + "\n"
+}
+
+// Replaces the host-derived nameserver section within the given generated
+// resolv.conf file. Files without such a section are left untouched and
+// reported as not updated.
+func UpdateHostDnsSection(file string, nameservers []string) (updated bool, err error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "update host dns section")
+	}
+	content := string(b)
+	begin := strings.Index(content, hostDnsBegin)
+	end := strings.Index(content, hostDnsEnd)
+	if begin < 0 || end < begin {
+		return false, nil
+	}
+	end += len(hostDnsEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	newContent := content[:begin] + hostDnsSection(nameservers) + content[end:]
+	if newContent == content {
+		return false, nil
+	}
+	if err = writeFile(file, newContent); err != nil {
+		return false, errors.Wrap(err, "update host dns section")
+	}
+	return true, nil
+}
@@ -0,0 +1,162 @@
+package net
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	gonet "net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/pkg/errors"
+)
+
+var networkNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// High-level options a managed network's CNI configuration is derived from
+type NetworkOptions struct {
+	// Subnet in CIDR notation the network's container IPs are allocated from
+	Subnet string
+	// Gateway IP within the subnet (derived by the ipam plugin when empty)
+	Gateway string
+	// Name of the bridge interface created on the host (default: ctnr-NETWORK)
+	BridgeName string
+	// Masquerade the containers' outgoing traffic with the host IP
+	Masquerade bool
+}
+
+// Describes a network declared within the managed configuration directory
+type NetworkInfo struct {
+	Name    string
+	Plugins []string
+	File    string
+}
+
+// Manages named networks by materializing CNI conflist files within the
+// network configuration directory so that they can be referenced by name
+// from the --network option and compose files.
+type NetworkStore struct {
+	confDir string
+}
+
+func NewNetworkStore(confDir string) *NetworkStore {
+	return &NetworkStore{confDir}
+}
+
+// Creates the named bridge network from the given options
+func (s *NetworkStore) Create(name string, o NetworkOptions) (err error) {
+	defer func() {
+		err = errors.Wrapf(err, "create network %q", name)
+	}()
+	if !networkNamePattern.MatchString(name) {
+		return errors.Errorf("invalid network name - must match %s", networkNamePattern)
+	}
+	if o.Subnet == "" {
+		return errors.New("no subnet provided")
+	}
+	if _, _, e := gonet.ParseCIDR(o.Subnet); e != nil {
+		return errors.Errorf("invalid subnet %q", o.Subnet)
+	}
+	if o.Gateway != "" && gonet.ParseIP(o.Gateway) == nil {
+		return errors.Errorf("invalid gateway IP %q", o.Gateway)
+	}
+	bridge := o.BridgeName
+	if bridge == "" {
+		bridge = "ctnr-" + name
+	}
+	if len(bridge) > 15 {
+		return errors.Errorf("bridge name %q exceeds the 15 character interface name limit", bridge)
+	}
+	file := s.file(name)
+	if _, e := os.Stat(file); e == nil {
+		return errors.New("network already exists")
+	}
+	ipam := map[string]interface{}{
+		"type":   "host-local",
+		"subnet": o.Subnet,
+		"routes": []interface{}{
+			map[string]interface{}{
+				"dst": "0.0.0.0/0",
+			},
+		},
+	}
+	if o.Gateway != "" {
+		ipam["gateway"] = o.Gateway
+	}
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"cniVersion": version.Current(),
+		"name":       name,
+		"plugins": []interface{}{
+			map[string]interface{}{
+				"cniVersion": version.Current(),
+				"type":       "bridge",
+				"bridge":     bridge,
+				"isGateway":  true,
+				"ipMasq":     o.Masquerade,
+				"ipam":       ipam,
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	// Ensure the generated configuration actually loads
+	if _, err = libcni.ConfListFromBytes(b); err != nil {
+		return
+	}
+	if err = os.MkdirAll(s.confDir, 0755); err != nil {
+		return errors.New(err.Error())
+	}
+	if err = ioutil.WriteFile(file, append(b, '\n'), 0644); err != nil {
+		err = errors.New(err.Error())
+	}
+	return
+}
+
+// Lists the networks declared within the managed configuration directory
+func (s *NetworkStore) List() (r []NetworkInfo, err error) {
+	r = []NetworkInfo{}
+	files, err := ioutil.ReadDir(s.confDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, errors.Wrap(err, "list networks")
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".conflist") {
+			continue
+		}
+		file := filepath.Join(s.confDir, f.Name())
+		l, e := libcni.ConfListFromFile(file)
+		if e != nil {
+			return nil, errors.Wrap(e, "list networks")
+		}
+		plugins := make([]string, len(l.Plugins))
+		for i, p := range l.Plugins {
+			plugins[i] = p.Network.Type
+		}
+		r = append(r, NetworkInfo{l.Name, plugins, file})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return
+}
+
+// Removes the named network's configuration file
+func (s *NetworkStore) Delete(name string) (err error) {
+	if err = os.Remove(s.file(name)); err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("delete network: network %q does not exist", name)
+		}
+		err = errors.New(err.Error())
+	}
+	return
+}
+
+func (s *NetworkStore) file(name string) string {
+	return filepath.Join(s.confDir, name+".conflist")
+}
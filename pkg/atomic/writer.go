@@ -21,12 +21,46 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
-// Writes a file atomically by first writing into a temp file before moving it to its final destination
+// Writes a file atomically by first writing into an unnamed temp file
+// (O_TMPFILE) that is linked to its final destination afterwards so that an
+// interrupted write cannot leave a partial file behind. Falls back to a named
+// temp file that is moved to its final destination on file systems that do
+// not support O_TMPFILE.
 func WriteFile(dest string, reader io.Reader) (size int64, err error) {
+	tmpFile, err := os.OpenFile(filepath.Dir(dest), os.O_WRONLY|unix.O_TMPFILE, 0600)
+	if err != nil {
+		// The reader has not been touched yet - fall back to a named temp file
+		return writeFileRename(dest, reader)
+	}
+	defer tmpFile.Close()
+	if size, err = io.Copy(tmpFile, reader); err != nil {
+		return size, errors.New("write to temp file: " + err.Error())
+	}
+	if err = tmpFile.Sync(); err != nil {
+		return size, errors.New("sync temp file: " + err.Error())
+	}
+	// Link the written unnamed file to its destination
+	tmpPath := "/proc/self/fd/" + strconv.Itoa(int(tmpFile.Fd()))
+	err = unix.Linkat(unix.AT_FDCWD, tmpPath, unix.AT_FDCWD, dest, unix.AT_SYMLINK_FOLLOW)
+	if os.IsExist(err) {
+		if err = os.Remove(dest); err == nil {
+			err = unix.Linkat(unix.AT_FDCWD, tmpPath, unix.AT_FDCWD, dest, unix.AT_SYMLINK_FOLLOW)
+		}
+	}
+	if err != nil {
+		return size, errors.New("link temp file: " + err.Error())
+	}
+	return
+}
+
+// Writes a file atomically by first writing into a temp file before moving it to its final destination
+func writeFileRename(dest string, reader io.Reader) (size int64, err error) {
 	// Create temp file to write blob to
 	tmpFile, err := ioutil.TempFile(filepath.Dir(dest), ".tmp-")
 	if err != nil {
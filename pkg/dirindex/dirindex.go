@@ -0,0 +1,121 @@
+package dirindex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mgoltzsche/ctnr/pkg/atomic"
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/pkg/errors"
+)
+
+// Embedded metadata index that caches directory-derived entries in a single
+// JSON file to avoid scanning and reading every entry again on each listing
+// of a large store directory. An index is invalidated using the indexed
+// directory tree's modification times. Access must be guarded by the lock
+// that also guards the indexed directory.
+type Index struct {
+	file  string
+	depth int
+}
+
+type dirModTime struct {
+	Dir     string `json:"dir"`
+	ModTime int64  `json:"mtime"`
+}
+
+type indexFile struct {
+	Signature []dirModTime    `json:"signature"`
+	Entries   json.RawMessage `json:"entries"`
+}
+
+// Creates an index stored in file. depth declares how many directory levels
+// below the indexed directory are included in the index' signature
+// (necessary for sharded directory layouts whose top directory's modification
+// time does not change when an entry is added to an existing shard).
+func NewIndex(file string, depth int) Index {
+	return Index{file, depth}
+}
+
+// Loads the cached entries. Returns ok=false without an error when the index
+// does not exist or is not up-to-date with the indexed directory dir.
+func (x *Index) Load(dir string, entries interface{}) (ok bool, err error) {
+	defer exterrors.Wrapd(&err, "load dir index")
+	sig, err := signature(dir, ".", x.depth, nil)
+	if err != nil {
+		return
+	}
+	b, err := ioutil.ReadFile(x.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	var f indexFile
+	if err = json.Unmarshal(b, &f); err != nil {
+		return false, errors.New(err.Error())
+	}
+	if !signatureEqual(f.Signature, sig) {
+		return
+	}
+	if err = json.Unmarshal(f.Entries, entries); err != nil {
+		return false, errors.New(err.Error())
+	}
+	return true, nil
+}
+
+// Writes the index file containing the provided entries for dir
+func (x *Index) Store(dir string, entries interface{}) (err error) {
+	defer exterrors.Wrapd(&err, "store dir index")
+	sig, err := signature(dir, ".", x.depth, nil)
+	if err != nil {
+		return
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	_, err = atomic.WriteJson(x.file, &indexFile{sig, json.RawMessage(b)})
+	return
+}
+
+func signature(dir, rel string, depth int, sig []dirModTime) ([]dirModTime, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return sig, err
+	}
+	sig = append(sig, dirModTime{rel, st.ModTime().UnixNano()})
+	if depth > 0 {
+		fl, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return sig, errors.New(err.Error())
+		}
+		for _, f := range fl {
+			if f.IsDir() {
+				sig, err = signature(filepath.Join(dir, f.Name()), filepath.Join(rel, f.Name()), depth-1, sig)
+				if err != nil {
+					return sig, err
+				}
+			}
+		}
+	}
+	return sig, nil
+}
+
+func signatureEqual(a, b []dirModTime) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, e := range a {
+		if e != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package dirindex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+func TestIndex(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", ".tmp-test-dirindex-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	dir := filepath.Join(tmpDir, "entries")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "shard"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "shard", "a"), []byte("x"), 0644))
+	testee := NewIndex(filepath.Join(tmpDir, "entries.index"), 1)
+
+	// Test Load() without stored index
+	var loaded []testEntry
+	ok, err := testee.Load(dir, &loaded)
+	require.NoError(t, err)
+	assert.False(t, ok, "load unwritten index")
+
+	// Test Load() after Store()
+	entries := []testEntry{{"a", 1}, {"b", 2}}
+	err = testee.Store(dir, entries)
+	require.NoError(t, err)
+	ok, err = testee.Load(dir, &loaded)
+	require.NoError(t, err)
+	assert.True(t, ok, "load stored index")
+	assert.Equal(t, entries, loaded, "loaded entries")
+
+	// Test Load() after the indexed directory changed
+	time.Sleep(time.Millisecond * 10)
+	err = ioutil.WriteFile(filepath.Join(dir, "shard", "b"), []byte("y"), 0644)
+	require.NoError(t, err)
+	ok, err = testee.Load(dir, &loaded)
+	require.NoError(t, err)
+	assert.False(t, ok, "load outdated index")
+}
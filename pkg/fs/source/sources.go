@@ -2,6 +2,7 @@ package source
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
@@ -163,6 +164,16 @@ func (s *Sources) sourceMaybeOverlay(file string, fi os.FileInfo, usr *idutils.U
 	isGzip := false
 	isBzip2 := false
 
+	// Check for the xz magic number (no stdlib support - the archive is
+	// decompressed by the xz binary on extraction)
+	magic := make([]byte, 6)
+	if n, _ := io.ReadFull(f, magic); n == 6 && bytes.Equal(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}) {
+		return NewSourceTarXz(file), nil
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return
+	}
+
 	// Try to decompress gzip
 	gr, err := gzip.NewReader(r)
 	if err == nil {
@@ -100,7 +100,9 @@ func unpackTar(r io.Reader, dest string, w fs.Writer) error {
 // Derived from umoci's tar_extract.go to allow separate source/dest interfaces
 // and filter archive contents on extraction
 func unpackTarEntry(hdr *tar.Header, r io.Reader, dest string, w fs.Writer, links map[string]string) (err error) {
-	path := layer.CleanPath(filepath.Join(dest, hdr.Name))
+	// Sanitize the entry name separately so that '..' segments cannot
+	// escape the destination directory
+	path := layer.CleanPath(filepath.Join(dest, layer.CleanPath(hdr.Name)))
 	dir, file := filepath.Split(path)
 
 	// Remove file if whiteout
@@ -134,7 +136,7 @@ func unpackTarEntry(hdr *tar.Header, r io.Reader, dest string, w fs.Writer, link
 		err = w.Dir(path, filepath.Base(path), a)
 	// hard link
 	case tar.TypeLink:
-		links[path] = filepath.Join(string(filepath.Separator)+dest, hdr.Linkname)
+		links[path] = filepath.Join(string(filepath.Separator)+dest, layer.CleanPath(hdr.Linkname))
 	// symbolic link
 	case tar.TypeSymlink:
 		a.Symlink = hdr.Linkname
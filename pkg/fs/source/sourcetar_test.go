@@ -1,6 +1,7 @@
 package source
 
 import (
+	"archive/tar"
 	"bytes"
 	"fmt"
 	"io/ioutil"
@@ -96,6 +97,45 @@ func TestSourceTar(t *testing.T) {
 	}
 }
 
+func TestSourceTarPathSanitization(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testtar-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	tarFile := filepath.Join(tmpDir, "malicious.tar")
+	f, err := os.Create(tarFile)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	writeEntry := func(hdr *tar.Header, content []byte) {
+		hdr.Size = int64(len(content))
+		err = tw.WriteHeader(hdr)
+		require.NoError(t, err)
+		if len(content) > 0 {
+			_, err = tw.Write(content)
+			require.NoError(t, err)
+		}
+	}
+	writeEntry(&tar.Header{Name: "../escaped-relative", Typeflag: tar.TypeReg, Mode: 0644}, []byte("content"))
+	writeEntry(&tar.Header{Name: "/../escaped-absolute", Typeflag: tar.TypeReg, Mode: 0644}, []byte("content"))
+	writeEntry(&tar.Header{Name: "dir/../../../escaped-nested", Typeflag: tar.TypeReg, Mode: 0644}, []byte("content"))
+	writeEntry(&tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "../../outside"}, nil)
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	destPath := "/a/b"
+	w := testutils.NewWriterMock(t, fs.AttrsHash)
+	err = NewSourceTar(tarFile).Write(destPath, "", &testutils.ExpandingWriterMock{w}, nil)
+	require.NoError(t, err)
+	require.True(t, len(w.Written) > 0, "no entries written")
+	for _, line := range w.Written {
+		for _, p := range strings.Split(line, " ") {
+			p = strings.TrimPrefix(p, "hlink=")
+			if strings.HasPrefix(p, "/") && p != destPath && !strings.HasPrefix(p, destPath+"/") {
+				t.Errorf("entry escapes destination directory: %s", line)
+			}
+		}
+	}
+}
+
 func prefixedPaths(paths []string, prefix string) []string {
 	r := []string{}
 	for _, line := range paths {
@@ -0,0 +1,45 @@
+package source
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	"github.com/pkg/errors"
+)
+
+var _ fs.Source = NewSourceTarXz("")
+
+// xz compressed tar source. Decompression is delegated to the xz binary
+// since the standard library provides no xz implementation.
+type sourceTarXz sourceTar
+
+func NewSourceTarXz(file string) fs.Source {
+	s := sourceTarXz(sourceTar{file, ""})
+	return &s
+}
+
+func (s *sourceTarXz) Attrs() fs.NodeInfo {
+	return (*sourceTar)(s).Attrs()
+}
+
+func (s *sourceTarXz) DeriveAttrs() (fs.DerivedAttrs, error) {
+	return (*sourceTar)(s).DeriveAttrs()
+}
+
+func (s *sourceTarXz) Write(dest, name string, w fs.Writer, _ map[fs.Source]string) (err error) {
+	c := exec.Command("xz", "-d", "-c", s.file)
+	c.Stderr = os.Stderr
+	r, err := c.StdoutPipe()
+	if err != nil {
+		return errors.Wrap(err, "extract tar.xz")
+	}
+	if err = c.Start(); err != nil {
+		return errors.Wrap(err, "extract tar.xz")
+	}
+	err = unpackTar(r, dest, w)
+	if e := c.Wait(); e != nil && err == nil {
+		err = errors.New(e.Error())
+	}
+	return errors.Wrap(err, "extract tar.xz")
+}
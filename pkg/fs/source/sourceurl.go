@@ -97,6 +97,10 @@ func (s *sourceURL) setUrlInfo(a *HttpHeaders) {
 			info += ","
 		}
 		info += "time:" + url.QueryEscape(a.LastModified)
+		// Apply the response's Last-Modified header as file mtime
+		if t, e := http.ParseTime(a.LastModified); e == nil {
+			s.Mtime = t
+		}
 	} else if a.ContentLength > 0 && a.Etag == "" {
 		info = "size=" + strconv.FormatInt(a.ContentLength, 10)
 	}
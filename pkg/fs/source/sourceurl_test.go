@@ -58,7 +58,8 @@ func TestSourceURL(t *testing.T) {
 	// Test write
 	testee.Write("/file", "", writerMock, nil)
 	actual := strings.Join(writerMock.Written, "\n")
-	expected := "/file type=file usr=1:33 mode=600 size=13 url=" + url.String() + " http=etag:mocked+%3D+etag1,time:Fri%2C+21+Sep+2018+20%3A52%3A35+GMT"
+	// The Last-Modified response header is applied as file mtime
+	expected := "/file type=file usr=1:33 mode=600 size=13 mtime=1537563155 url=" + url.String() + " http=etag:mocked+%3D+etag1,time:Fri%2C+21+Sep+2018+20%3A52%3A35+GMT"
 	assert.Equal(t, expected, actual)
 }
 
@@ -137,7 +137,8 @@ func (b *FsBuilder) CopyAll(srcfs string, sources []string, dest string, usr *id
 		dest = filepath.Clean(dest) + string(filepath.Separator)
 	}
 	for _, src := range sources {
-		if err := b.copy(srcfs, src, dest, usr, b.createOverlayOrFile); err != nil {
+		// Unlike AddAll archives are copied as-is without extraction
+		if err := b.copy(srcfs, src, dest, usr, b.createFile); err != nil {
 			b.err = errors.Wrap(err, "copy "+src)
 			return
 		}
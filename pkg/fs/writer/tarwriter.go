@@ -18,12 +18,21 @@ var _ fs.Writer = &TarWriter{}
 // Derived from umoci's tar_extract.go to allow separate source/dest interfaces
 // and filter archive contents on extraction
 type TarWriter struct {
-	writer  *tar.Writer
-	written map[string]*fs.FileAttrs
+	writer    *tar.Writer
+	written   map[string]*fs.FileAttrs
+	clampTime *time.Time
 }
 
 func NewTarWriter(writer io.Writer) (w *TarWriter) {
-	return &TarWriter{tar.NewWriter(writer), map[string]*fs.FileAttrs{}}
+	return &TarWriter{tar.NewWriter(writer), map[string]*fs.FileAttrs{}, nil}
+}
+
+// Clamps all entry timestamps to the given time and drops access times
+// as well as user/group names so that equal file system contents produce
+// byte-identical archives regardless of when and where they were built
+func (w *TarWriter) ClampModTime(t time.Time) {
+	t = time.Unix(t.Unix(), 0)
+	w.clampTime = &t
 }
 
 func (w *TarWriter) Close() error {
@@ -82,6 +91,12 @@ func (w *TarWriter) writeTarHeader(path string, a fs.FileAttrs) (err error) {
 
 func (w *TarWriter) toTarHeader(path string, a fs.FileAttrs) (hdr *tar.Header, err error) {
 	a.Mtime = time.Unix(a.Mtime.Unix(), 0) // use floor(mtime) to preserve mtime which otherwise is not guaranteed due to rounding to seconds within tar
+	if w.clampTime != nil {
+		if a.Mtime.After(*w.clampTime) {
+			a.Mtime = *w.clampTime
+		}
+		a.Atime = a.Mtime
+	}
 	hdr, err = tar.FileInfoHeader(fs.NewFileInfo(path, &a), a.Symlink)
 	if err != nil {
 		return nil, errors.Wrapf(err, "to tar header: %s", path)
@@ -90,6 +105,10 @@ func (w *TarWriter) toTarHeader(path string, a fs.FileAttrs) (hdr *tar.Header, e
 	hdr.Gid = int(a.Gid)
 	hdr.AccessTime = a.Atime
 	hdr.Xattrs = a.Xattrs
+	if w.clampTime != nil {
+		hdr.Uname = ""
+		hdr.Gname = ""
+	}
 	w.addWritten(path, &a)
 	return
 }
@@ -200,8 +219,11 @@ func (w *TarWriter) Remove(path string) (err error) {
 	delete(w.written, path)
 	dir, file := filepath.Split(path)
 	file = fs.WhiteoutPrefix + file
+	// Using current time for header values which leads to unreproducable
+	// layer unless a clamp time is set
 	now := time.Now()
-	// Using current time for header values which leads to unreproducable layer
-	// TODO: maybe change to fixed time instead of now()
+	if w.clampTime != nil {
+		now = *w.clampTime
+	}
 	return w.writeTarHeader(filepath.Join(dir, file), fs.FileAttrs{FileTimes: fs.FileTimes{Atime: now, Mtime: now}})
 }
@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Reports whether the file system containing the given path supports user
+// extended attributes. Rootless containers rely on user xattrs to emulate
+// file ownership (user.rootlesscontainers) which some file systems
+// (e.g. vfat, nfs) do not support, resulting in obscure runtime errors.
+// The support is detected by writing a probe xattr to a temporary file
+// within the path's directory.
+func SupportsUserXattrs(path string) (supported bool, err error) {
+	dir := path
+	if fi, e := os.Stat(path); e != nil || !fi.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	probe, err := ioutil.TempFile(dir, ".xattr-probe-")
+	if err != nil {
+		return false, errors.New("detect user xattr support: " + err.Error())
+	}
+	defer func() {
+		probe.Close()
+		os.Remove(probe.Name())
+	}()
+	if e := unix.Setxattr(probe.Name(), "user.ctnr.probe", []byte("1"), 0); e != nil {
+		if e == unix.ENOTSUP {
+			return false, nil
+		}
+		return false, errors.New("detect user xattr support: " + e.Error())
+	}
+	return true, nil
+}
@@ -0,0 +1,126 @@
+package librunner
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mgoltzsche/ctnr/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// Serves a container's stdio on a unix socket so that other processes
+// can attach to the container while its supervisor process is running.
+type attachServer struct {
+	sock     string
+	listener net.Listener
+	stdout   *broadcastWriter
+	stderr   *broadcastWriter
+	stdin    io.WriteCloser
+	log      log.Loggers
+}
+
+func newAttachServer(sock string, stdout, stderr *broadcastWriter, stdin io.WriteCloser, loggers log.Loggers) *attachServer {
+	return &attachServer{sock: sock, stdout: stdout, stderr: stderr, stdin: stdin, log: loggers}
+}
+
+func (s *attachServer) start() (err error) {
+	if err = os.MkdirAll(filepath.Dir(s.sock), 0700); err != nil {
+		return errors.New("attach server: " + err.Error())
+	}
+	if err = os.Remove(s.sock); err != nil && !os.IsNotExist(err) {
+		return errors.New("attach server: " + err.Error())
+	}
+	if s.listener, err = net.Listen("unix", s.sock); err != nil {
+		return errors.New("attach server: " + err.Error())
+	}
+	go s.accept()
+	return
+}
+
+func (s *attachServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		go s.serve(conn)
+	}
+}
+
+// Streams the container output to the connection and forwards the
+// connection's input to the container's stdin until the client disconnects.
+func (s *attachServer) serve(conn net.Conn) {
+	s.log.Debug.Println("Attaching client")
+	s.stdout.add(conn)
+	s.stderr.add(conn)
+	if s.stdin == nil {
+		io.Copy(ioutil.Discard, conn)
+	} else {
+		io.Copy(s.stdin, conn)
+	}
+	s.stdout.remove(conn)
+	s.stderr.remove(conn)
+	conn.Close()
+	s.log.Debug.Println("Detached client")
+}
+
+func (s *attachServer) close() (err error) {
+	if s.listener != nil {
+		err = s.listener.Close()
+		s.listener = nil
+	}
+	if s.stdin != nil {
+		// Terminate the container's stdin with EOF
+		s.stdin.Close()
+		s.stdin = nil
+	}
+	if e := os.Remove(s.sock); e != nil && !os.IsNotExist(e) && err == nil {
+		err = e
+	}
+	if err != nil {
+		err = errors.New("close attach server: " + err.Error())
+	}
+	return
+}
+
+// Writes to a base writer and additionally to a mutable set of attached
+// writers, dropping an attached writer when it fails.
+type broadcastWriter struct {
+	mutex   sync.Mutex
+	base    io.Writer
+	clients map[io.Writer]bool
+}
+
+func newBroadcastWriter(base io.Writer) *broadcastWriter {
+	return &broadcastWriter{base: base, clients: map[io.Writer]bool{}}
+}
+
+func (w *broadcastWriter) add(client io.Writer) {
+	w.mutex.Lock()
+	w.clients[client] = true
+	w.mutex.Unlock()
+}
+
+func (w *broadcastWriter) remove(client io.Writer) {
+	w.mutex.Lock()
+	delete(w.clients, client)
+	w.mutex.Unlock()
+}
+
+func (w *broadcastWriter) Write(b []byte) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for client := range w.clients {
+		if _, e := client.Write(b); e != nil {
+			delete(w.clients, client)
+		}
+	}
+	if w.base == nil {
+		return len(b), nil
+	}
+	return w.base.Write(b)
+}
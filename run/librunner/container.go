@@ -1,52 +1,48 @@
 package librunner
 
 import (
-	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"time"
 
+	"github.com/mgoltzsche/ctnr/bundle"
 	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
 	"github.com/mgoltzsche/ctnr/pkg/log"
 	"github.com/mgoltzsche/ctnr/run"
+	"github.com/mgoltzsche/ctnr/run/logs"
 	"github.com/opencontainers/runc/libcontainer"
-	_ "github.com/opencontainers/runc/libcontainer/nsenter"
 	"github.com/opencontainers/runc/libcontainer/specconv"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 )
 
-func init() {
-	if len(os.Args) > 1 && os.Args[1] == "init" {
-		// Initializes the previously created container in this new process
-		runtime.GOMAXPROCS(1)
-		runtime.LockOSThread()
-		factory, _ := libcontainer.New("")
-		if err := factory.StartInitialization(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: libcontainer factory initialization: %s\n", err)
-			os.Exit(1)
-		}
-		panic("factory initialization should block further execution - this should never be executed")
-	}
-}
-
 type Container struct {
 	process        *Process
 	container      libcontainer.Container
 	destroyOnClose bool
+	logStdout      io.Closer
+	logStderr      io.Closer
+	attachSock     string
+	attach         *attachServer
+	started        time.Time
 	log            log.Loggers
 }
 
-func LoadContainer(id string, factory libcontainer.Factory, loggers log.Loggers) (*Container, error) {
+func LoadContainer(id string, factory libcontainer.Factory, attachDir string, loggers log.Loggers) (*Container, error) {
 	c, err := factory.Load(id)
 	return &Container{
-		container: c,
-		log:       loggers,
+		container:  c,
+		attachSock: filepath.Join(attachDir, id+".sock"),
+		log:        loggers,
 	}, err
 }
 
-func NewContainer(cfg *run.ContainerConfig, rootless bool, factory libcontainer.Factory, loggers log.Loggers) (r *Container, err error) {
+func NewContainer(cfg *run.ContainerConfig, rootless bool, factory libcontainer.Factory, logDriver logs.Driver, attachDir string, loggers log.Loggers) (r *Container, err error) {
 	id := cfg.Id
 	if id == "" {
 		if id = cfg.Bundle.ID(); id == "" {
@@ -83,6 +79,14 @@ func NewContainer(cfg *run.ContainerConfig, rootless bool, factory libcontainer.
 		}
 	}()
 
+	if spec.Linux != nil {
+		for _, ns := range spec.Linux.Namespaces {
+			// The vendored libcontainer cannot create time namespaces yet
+			if ns.Type == "time" {
+				return nil, errors.Errorf("new container %s: the built-in container engine does not support the time namespace. hint: use a ctnr build with the external runc engine and a time-namespace-aware runc binary", id)
+			}
+		}
+	}
 	config, err := specconv.CreateLibcontainerConfig(&specconv.CreateOpts{
 		CgroupName:       id,
 		UseSystemdCgroup: false, // TODO: expose as option
@@ -111,11 +115,51 @@ func NewContainer(cfg *run.ContainerConfig, rootless bool, factory libcontainer.
 		destroyOnClose: cfg.DestroyOnClose,
 		log:            loggers,
 	}
-	r.process, err = NewProcess(r, spec.Process, cfg.Io, loggers)
+
+	// Capture the container output in addition to the provided streams
+	cio := cfg.Io
+	logStdout, logStderr, err := logDriver.Open(id)
+	if err != nil {
+		err = exterrors.Append(errors.Wrap(err, "new container"), r.Destroy())
+		return
+	}
+	r.logStdout = logStdout
+	r.logStderr = logStderr
+	cio.Stdout = teeWriter(cio.Stdout, logStdout)
+	cio.Stderr = teeWriter(cio.Stderr, logStderr)
+
+	// Serve the container's stdio on a socket other processes can attach to.
+	// Without a caller-provided stdin the attach clients' input is fed into
+	// the container through a pipe that is closed with the container.
+	var stdinWriter io.WriteCloser
+	if cio.Stdin == nil {
+		pr, pw := io.Pipe()
+		cio.Stdin = pr
+		stdinWriter = pw
+	}
+	stdout := newBroadcastWriter(cio.Stdout)
+	stderr := newBroadcastWriter(cio.Stderr)
+	cio.Stdout = stdout
+	cio.Stderr = stderr
+	r.attachSock = filepath.Join(attachDir, id+".sock")
+	r.attach = newAttachServer(r.attachSock, stdout, stderr, stdinWriter, loggers)
+	if err = r.attach.start(); err != nil {
+		err = exterrors.Append(errors.Wrap(err, "new container"), r.Destroy())
+		return
+	}
+
+	r.process, err = NewProcess(r, spec.Process, cio, loggers)
 	err = errors.Wrap(err, "configure container process")
 	return
 }
 
+func teeWriter(w io.Writer, logWriter io.Writer) io.Writer {
+	if w == nil {
+		return logWriter
+	}
+	return io.MultiWriter(w, logWriter)
+}
+
 func (c *Container) ID() string {
 	return c.container.ID()
 }
@@ -127,6 +171,7 @@ func (c *Container) Rootfs() string {
 // Prepare and start the container process from spec and with stdio
 func (c *Container) Start() (err error) {
 	c.log.Debug.Println("Starting container")
+	c.started = time.Now()
 	return c.process.Start()
 }
 
@@ -137,6 +182,63 @@ func (c *Container) Stop() {
 	}
 }
 
+// Attaches the given streams to the running container through the attach
+// socket held by the container's supervisor process.
+// TODO: forward terminal resize events to the attached process
+func (c *Container) Attach(cio run.ContainerIO) (err error) {
+	conn, err := net.Dial("unix", c.attachSock)
+	if err != nil {
+		return errors.New("attach: " + err.Error())
+	}
+	defer conn.Close()
+	out := cio.Stdout
+	if out == nil {
+		out = ioutil.Discard
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, e := io.Copy(out, conn)
+		done <- e
+	}()
+	if cio.Stdin != nil {
+		go func() {
+			io.Copy(conn, cio.Stdin)
+			if uconn, ok := conn.(*net.UnixConn); ok {
+				uconn.CloseWrite()
+			}
+		}()
+	}
+	return errors.Wrap(<-done, "attach")
+}
+
+// Checkpoints the running container's state using CRIU, storing the
+// checkpoint images within the bundle's checkpoint directory so that they
+// are garbage collected with the bundle.
+func (c *Container) Checkpoint(leaveRunning bool) (err error) {
+	c.log.Debug.Println("Checkpointing container")
+	defer exterrors.Wrapd(&err, "checkpoint container")
+	dir := c.checkpointDir()
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	return c.container.Checkpoint(&libcontainer.CriuOpts{
+		ImagesDirectory: dir,
+		WorkDirectory:   dir,
+		LeaveRunning:    leaveRunning,
+	})
+}
+
+// Restores the container process from its bundle's last checkpoint
+func (c *Container) Restore() (err error) {
+	c.log.Debug.Println("Restoring container")
+	c.started = time.Now()
+	return c.process.Restore(c.checkpointDir())
+}
+
+func (c *Container) checkpointDir() string {
+	return filepath.Join(c.Rootfs(), "..", "checkpoint")
+}
+
 func (c *Container) Exec(process *specs.Process, io run.ContainerIO) (proc run.Process, err error) {
 	p, err := NewProcess(c, process, io, c.log)
 	err = p.Start()
@@ -177,6 +279,29 @@ func (c *Container) Close() (err error) {
 		c.process = nil
 	}
 
+	// Close log writers
+	if c.logStdout != nil {
+		err = exterrors.Append(err, c.logStdout.Close())
+		c.logStdout = nil
+	}
+	if c.logStderr != nil {
+		err = exterrors.Append(err, c.logStderr.Close())
+		c.logStderr = nil
+	}
+
+	// Close attach socket
+	if c.attach != nil {
+		err = exterrors.Append(err, c.attach.close())
+		c.attach = nil
+	}
+
+	// Record resource usage before the cgroup is destroyed
+	if !c.started.IsZero() && c.container != nil {
+		if e := c.recordMetrics(); e != nil {
+			c.log.Warn.Println(e)
+		}
+	}
+
 	// Destroy container
 	if c.destroyOnClose {
 		err = exterrors.Append(err, c.Destroy())
@@ -184,3 +309,46 @@ func (c *Container) Close() (err error) {
 
 	return
 }
+
+// Records the container's resource usage (peak memory, cpu seconds, wall
+// time) within the bundle annotations so that completed jobs can be
+// inspected without an external monitoring stack.
+func (c *Container) recordMetrics() (err error) {
+	defer exterrors.Wrapd(&err, "record container metrics")
+	st, err := c.container.Stats()
+	if err != nil {
+		return
+	}
+	b, err := bundle.NewBundle(filepath.Join(c.Rootfs(), ".."))
+	if err != nil {
+		return
+	}
+	lb, err := b.Lock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err = exterrors.Append(err, lb.Close())
+	}()
+	spec, err := lb.Spec()
+	if err != nil {
+		return
+	}
+	if spec.Annotations == nil {
+		spec.Annotations = map[string]string{}
+	}
+	if cg := st.CgroupStats; cg != nil {
+		cpuSeconds := float64(cg.CpuStats.CpuUsage.TotalUsage) / float64(time.Second)
+		spec.Annotations[bundle.ANNOTATION_METRICS_CPU_SECONDS] = strconv.FormatFloat(cpuSeconds, 'f', 3, 64)
+		spec.Annotations[bundle.ANNOTATION_METRICS_MEM_PEAK] = strconv.FormatUint(cg.MemoryStats.Usage.MaxUsage, 10)
+	}
+	var netRx, netTx uint64
+	for _, iface := range st.Interfaces {
+		netRx += iface.RxBytes
+		netTx += iface.TxBytes
+	}
+	spec.Annotations[bundle.ANNOTATION_METRICS_NET_RX] = strconv.FormatUint(netRx, 10)
+	spec.Annotations[bundle.ANNOTATION_METRICS_NET_TX] = strconv.FormatUint(netTx, 10)
+	spec.Annotations[bundle.ANNOTATION_METRICS_WALL_TIME] = time.Since(c.started).Round(time.Millisecond).String()
+	return lb.SetSpec(spec)
+}
@@ -0,0 +1,73 @@
+package librunner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer"
+	_ "github.com/opencontainers/runc/libcontainer/nsenter"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		// Initializes the previously created container in this new process
+		runtime.GOMAXPROCS(1)
+		runtime.LockOSThread()
+		if err := sanitizeInitProcess(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: init process sanitization: %s\n", err)
+			os.Exit(1)
+		}
+		factory, _ := libcontainer.New("")
+		if err := factory.StartInitialization(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: libcontainer factory initialization: %s\n", err)
+			os.Exit(1)
+		}
+		panic("factory initialization should block further execution - this should never be executed")
+	}
+}
+
+// Resolves the binary used to initialize containers: the minimal ctnr-init
+// helper binary is preferred over re-executing the full ctnr binary since
+// it starts faster and has a smaller memory footprint. It is resolved from
+// the CTNR_INIT_BINARY env var or next to the calling executable and the
+// calling executable itself is used when neither exists.
+func resolveInitBinary() (binary string, err error) {
+	if binary = os.Getenv("CTNR_INIT_BINARY"); binary != "" {
+		return
+	}
+	if binary, err = os.Executable(); err != nil {
+		return "", errors.Wrapf(err, "resolve %q executable", os.Args[0])
+	}
+	initBinary := filepath.Join(filepath.Dir(binary), "ctnr-init")
+	if _, e := os.Stat(initBinary); e == nil {
+		binary = initBinary
+	}
+	return
+}
+
+// Drops the environment and marks the file descriptors inherited from the
+// ctnr parent process close-on-exec so that neither leaks into the container
+// workload: libcontainer execs the workload with the init process'
+// environment after populating it from the bundle spec - variables the spec
+// does not override would be leaked from the parent otherwise.
+// Only libcontainer's own _LIBCONTAINER* variables are preserved since they
+// are still read during initialization.
+func sanitizeInitProcess() (err error) {
+	for _, kv := range os.Environ() {
+		k := strings.SplitN(kv, "=", 2)[0]
+		if strings.HasPrefix(k, "_LIBCONTAINER") {
+			continue
+		}
+		if err = os.Unsetenv(k); err != nil {
+			return errors.Wrapf(err, "unset inherited env var %s", k)
+		}
+	}
+	// The fds libcontainer needs (init pipe, state dir, console socket) are
+	// used before the workload is executed and must be closed on exec as well
+	return errors.Wrap(utils.CloseExecFrom(3), "close-on-exec inherited fds")
+}
@@ -0,0 +1,63 @@
+package librunner
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestSanitizeInitProcess(t *testing.T) {
+	if err := os.Setenv("CTNR_TEST_LEAKED_VAR", "leaked"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Setenv("_LIBCONTAINER_TESTPIPE", "3"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("_LIBCONTAINER_TESTPIPE")
+	f, err := ioutil.TempFile("", "ctnr-test-init-fd-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	// Clear the fd's close-on-exec flag to simulate a leaked parent fd
+	fd := f.Fd()
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0); errno != 0 {
+		t.Fatal(errno)
+	}
+
+	if err = sanitizeInitProcess(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, leaked := os.LookupEnv("CTNR_TEST_LEAKED_VAR"); leaked {
+		t.Error("inherited env var has not been dropped")
+	}
+	if os.Getenv("_LIBCONTAINER_TESTPIPE") != "3" {
+		t.Error("_LIBCONTAINER* env var must be preserved")
+	}
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFD, 0)
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	if flags&syscall.FD_CLOEXEC == 0 {
+		t.Error("inherited fd has not been marked close-on-exec")
+	}
+}
+
+// Measures the startup overhead of the container init binary.
+// Point CTNR_INIT_BINARY at dist/bin/ctnr-init and at the full ctnr binary
+// in separate runs to compare them.
+func BenchmarkInitBinaryStartup(b *testing.B) {
+	binary := os.Getenv("CTNR_INIT_BINARY")
+	if binary == "" {
+		b.Skip("CTNR_INIT_BINARY env var pointing at the binary to measure is not set")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The binary exits immediately when invoked without the init arg
+		exec.Command(binary).Run()
+	}
+}
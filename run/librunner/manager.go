@@ -8,6 +8,7 @@ import (
 	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
 	"github.com/mgoltzsche/ctnr/pkg/log"
 	"github.com/mgoltzsche/ctnr/run"
+	"github.com/mgoltzsche/ctnr/run/logs"
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/pkg/errors"
 )
@@ -15,11 +16,13 @@ import (
 var _ run.ContainerManager = &ContainerManager{}
 
 type ContainerManager struct {
-	factory  libcontainer.Factory
-	runners  map[string]run.Container
-	rootDir  string
-	rootless bool
-	loggers  log.Loggers
+	factory   libcontainer.Factory
+	runners   map[string]run.Container
+	rootDir   string
+	rootless  bool
+	logs      logs.Driver
+	attachDir string
+	loggers   log.Loggers
 }
 
 func NewContainerManager(rootDir string, rootless bool, loggers log.Loggers) (r *ContainerManager, err error) {
@@ -27,10 +30,14 @@ func NewContainerManager(rootDir string, rootless bool, loggers log.Loggers) (r
 	if err != nil {
 		return
 	}
-	r = &ContainerManager{runners: map[string]run.Container{}, rootDir: absRoot, rootless: rootless, loggers: loggers}
-	binary, err := os.Executable()
+	// Captured container output and attach sockets are stored in the state
+	// dir next to the container states
+	logDriver := logs.NewJsonFileDriver(filepath.Join(filepath.Dir(absRoot), "logs"))
+	attachDir := filepath.Join(filepath.Dir(absRoot), "attach")
+	r = &ContainerManager{runners: map[string]run.Container{}, rootDir: absRoot, rootless: rootless, logs: logDriver, attachDir: attachDir, loggers: loggers}
+	binary, err := resolveInitBinary()
 	if err != nil {
-		return nil, errors.Wrapf(err, "new container manager: resolve %q executable", os.Args[0])
+		return nil, errors.Wrap(err, "new container manager")
 	}
 	// TODO: also support systemd cgroup usage: libcontainer.SystemdCgroups
 	if r.factory, err = libcontainer.New(rootDir, libcontainer.Cgroupfs, libcontainer.InitArgs(binary, "init")); err != nil {
@@ -40,11 +47,11 @@ func NewContainerManager(rootDir string, rootless bool, loggers log.Loggers) (r
 }
 
 func (m *ContainerManager) NewContainer(cfg *run.ContainerConfig) (c run.Container, err error) {
-	return NewContainer(cfg, m.rootless, m.factory, m.loggers)
+	return NewContainer(cfg, m.rootless, m.factory, m.logs, m.attachDir, m.loggers)
 }
 
 func (m *ContainerManager) Get(id string) (run.Container, error) {
-	return LoadContainer(id, m.factory, m.loggers)
+	return LoadContainer(id, m.factory, m.attachDir, m.loggers)
 }
 
 func (m *ContainerManager) Exist(id string) (e bool, err error) {
@@ -57,13 +64,79 @@ func (m *ContainerManager) Exist(id string) (e bool, err error) {
 }
 
 func (m *ContainerManager) Kill(id string, signal os.Signal, all bool) (err error) {
-	c, err := LoadContainer(id, m.factory, m.loggers)
+	c, err := LoadContainer(id, m.factory, m.attachDir, m.loggers)
 	if err == nil {
 		err = c.container.Signal(signal, all)
 	}
 	return errors.Wrap(err, "kill")
 }
 
+// Suspends all processes within the container
+func (m *ContainerManager) Pause(id string) (err error) {
+	c, err := LoadContainer(id, m.factory, m.attachDir, m.loggers)
+	if err == nil {
+		err = c.container.Pause()
+	}
+	return errors.Wrap(err, "pause")
+}
+
+// Resumes all previously paused processes within the container
+func (m *ContainerManager) Resume(id string) (err error) {
+	c, err := LoadContainer(id, m.factory, m.attachDir, m.loggers)
+	if err == nil {
+		err = c.container.Resume()
+	}
+	return errors.Wrap(err, "resume")
+}
+
+// Returns the pid of the container's init process on the host
+func (m *ContainerManager) Pid(id string) (pid int, err error) {
+	defer exterrors.Wrapd(&err, "container pid")
+	c, err := m.factory.Load(id)
+	if err != nil {
+		return
+	}
+	st, err := c.State()
+	if err != nil {
+		return
+	}
+	return st.InitProcessPid, nil
+}
+
+// Reads the container's cgroup and network counters
+func (m *ContainerManager) Stats(id string) (r run.ContainerStats, err error) {
+	defer exterrors.Wrapd(&err, "container stats")
+	c, err := LoadContainer(id, m.factory, m.attachDir, m.loggers)
+	if err != nil {
+		return
+	}
+	st, err := c.container.Stats()
+	if err != nil {
+		return
+	}
+	r.ID = id
+	if cg := st.CgroupStats; cg != nil {
+		r.CpuUsage = cg.CpuStats.CpuUsage.TotalUsage
+		r.MemoryUsage = cg.MemoryStats.Usage.Usage
+		r.MemoryLimit = cg.MemoryStats.Usage.Limit
+		for _, e := range cg.BlkioStats.IoServiceBytesRecursive {
+			switch e.Op {
+			case "Read":
+				r.BlkioRead += e.Value
+			case "Write":
+				r.BlkioWrite += e.Value
+			}
+		}
+	}
+	r.Interfaces = make([]run.NetworkStats, 0, len(st.Interfaces))
+	for _, iface := range st.Interfaces {
+		r.NetworkRx += iface.RxBytes
+		r.NetworkTx += iface.TxBytes
+		r.Interfaces = append(r.Interfaces, run.NetworkStats{iface.Name, iface.RxBytes, iface.RxPackets, iface.TxBytes, iface.TxPackets})
+	}
+	return
+}
+
 func (m *ContainerManager) List() (r []run.ContainerInfo, err error) {
 	r = []run.ContainerInfo{}
 	if _, e := os.Stat(m.rootDir); !os.IsNotExist(e) {
@@ -71,7 +144,13 @@ func (m *ContainerManager) List() (r []run.ContainerInfo, err error) {
 		if e == nil {
 			for _, f := range files {
 				if _, e = os.Stat(filepath.Join(m.rootDir, f.Name(), "state.json")); !os.IsNotExist(e) {
-					r = append(r, run.ContainerInfo{f.Name(), "running"})
+					status := "running"
+					if c, e := m.factory.Load(f.Name()); e == nil {
+						if s, e := c.Status(); e == nil {
+							status = s.String()
+						}
+					}
+					r = append(r, run.ContainerInfo{f.Name(), status})
 				}
 			}
 		} else {
@@ -55,7 +55,7 @@ func NewProcess(container *Container, p *specs.Process, io run.ContainerIO, logg
 			NoNewPrivileges: &p.NoNewPrivileges,
 		},
 	}
-	lp := r.process
+	lp := &r.process
 	for _, gid := range p.User.AdditionalGids {
 		lp.AdditionalGroups = append(lp.AdditionalGroups, strconv.FormatUint(uint64(gid), 10))
 	}
@@ -78,8 +78,15 @@ func NewProcess(container *Container, p *specs.Process, io run.ContainerIO, logg
 		}
 	}
 	if os.Getenv("LISTEN_FDS") != "" {
-		// Add systemd file descriptors
-		lp.ExtraFiles = activation.Files(false)
+		// Pass systemd-activated sockets on to the container process:
+		// the fds are inherited right after stdio and LISTEN_PID is
+		// rewritten to refer to the container's init process (pid 1 in
+		// its pid namespace) so that an on-demand started service finds
+		// its sockets as if it had been spawned by systemd directly
+		if fds := activation.Files(false); len(fds) > 0 {
+			lp.ExtraFiles = fds
+			lp.Env = append(lp.Env, "LISTEN_FDS="+strconv.Itoa(len(fds)), "LISTEN_PID=1")
+		}
 	}
 	return
 }
@@ -116,6 +123,40 @@ func (p *Process) Start() (err error) {
 	return nil
 }
 
+// Restores the container process from the given checkpoint image directory
+// instead of running it from scratch
+func (p *Process) Restore(imageDir string) (err error) {
+	p.log.Debug.WithField("dir", imageDir).Println("Restoring process")
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	defer exterrors.Wrapd(&err, "restore process")
+
+	if p.running {
+		return errors.New("process already started")
+	}
+
+	// Configure stdIO/terminal
+	p.tty, err = setupIO(&p.process, p.container.container, p.terminal, false, "")
+	if err != nil {
+		return
+	}
+
+	// Restore container process from checkpoint
+	if err = p.container.container.Restore(&p.process, &libcontainer.CriuOpts{
+		ImagesDirectory: imageDir,
+		WorkDirectory:   imageDir,
+	}); err != nil {
+		p.tty.Close()
+		return
+	}
+	p.running = true
+
+	p.wait.Add(1)
+	go p.handleTermination()
+	return nil
+}
+
 func (p *Process) handleTermination() {
 	defer p.wait.Done()
 
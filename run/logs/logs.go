@@ -0,0 +1,177 @@
+package logs
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/pkg/errors"
+)
+
+// A single captured container output line
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Log    string    `json:"log"`
+}
+
+// Captures and replays container output.
+// The writers returned by Open must be safe for concurrent use.
+type Driver interface {
+	// Opens writers capturing a container's stdout and stderr
+	Open(containerId string) (stdout io.WriteCloser, stderr io.WriteCloser, err error)
+	// Writes a container's captured output lines to out.
+	// tail > 0 restricts the output to the last tail lines and
+	// follow keeps the log open, streaming new lines as they appear.
+	Read(containerId string, out io.Writer, tail int, follow bool) error
+}
+
+// Provides a log file per container containing a JSON object per line
+func NewJsonFileDriver(dir string) Driver {
+	return &jsonFileDriver{dir}
+}
+
+type jsonFileDriver struct {
+	dir string
+}
+
+func (d *jsonFileDriver) file(containerId string) string {
+	return filepath.Join(d.dir, containerId+".json")
+}
+
+func (d *jsonFileDriver) Open(containerId string) (stdout io.WriteCloser, stderr io.WriteCloser, err error) {
+	if err = os.MkdirAll(d.dir, 0700); err != nil {
+		return nil, nil, errors.New("open log: " + err.Error())
+	}
+	f, err := os.OpenFile(d.file(containerId), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, errors.New("open log: " + err.Error())
+	}
+	// Both streams share the file, closing it with the last writer
+	shared := &jsonFile{f: f, refs: 2}
+	return &lineWriter{file: shared, stream: "stdout"}, &lineWriter{file: shared, stream: "stderr"}, nil
+}
+
+func (d *jsonFileDriver) Read(containerId string, out io.Writer, tail int, follow bool) (err error) {
+	f, err := os.Open(d.file(containerId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("read log: no log captured for container %q", containerId)
+		}
+		return errors.New("read log: " + err.Error())
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	var tailBuf []string
+	partial := ""
+	for {
+		line, e := reader.ReadString('\n')
+		if e != nil {
+			if e != io.EOF {
+				return errors.New("read log: " + e.Error())
+			}
+			// Reached the end of the log - keep an incomplete line for the next iteration
+			partial += line
+			if tail > 0 {
+				for _, l := range tailBuf {
+					printEntry(out, l)
+				}
+				tailBuf = nil
+				tail = 0
+			}
+			if !follow {
+				return nil
+			}
+			time.Sleep(time.Millisecond * 300)
+			continue
+		}
+		line = partial + line
+		partial = ""
+		if tail > 0 {
+			if tailBuf = append(tailBuf, line); len(tailBuf) > tail {
+				tailBuf = tailBuf[1:]
+			}
+		} else {
+			printEntry(out, line)
+		}
+	}
+}
+
+func printEntry(out io.Writer, line string) {
+	entry := Entry{}
+	if json.Unmarshal([]byte(line), &entry) == nil {
+		out.Write([]byte(entry.Log + "\n"))
+	}
+}
+
+// Log file shared between the stdout and stderr writers of a container
+type jsonFile struct {
+	f     *os.File
+	refs  int
+	mutex sync.Mutex
+}
+
+func (s *jsonFile) writeEntry(stream, log string) (err error) {
+	b, err := json.Marshal(Entry{time.Now(), stream, log})
+	if err != nil {
+		return errors.New("write log: " + err.Error())
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err = s.f.Write(append(b, '\n')); err != nil {
+		err = errors.New("write log: " + err.Error())
+	}
+	return
+}
+
+func (s *jsonFile) close() (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.refs--; s.refs == 0 {
+		if err = s.f.Close(); err != nil {
+			err = errors.New("close log: " + err.Error())
+		}
+	}
+	return
+}
+
+// Writes one log entry per line, buffering incomplete lines
+type lineWriter struct {
+	file   *jsonFile
+	stream string
+	buf    []byte
+}
+
+func (w *lineWriter) Write(b []byte) (n int, err error) {
+	n = len(b)
+	w.buf = append(w.buf, b...)
+	for {
+		i := -1
+		for j, c := range w.buf {
+			if c == '\n' {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return
+		}
+		if err = w.file.writeEntry(w.stream, string(w.buf[:i])); err != nil {
+			return
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func (w *lineWriter) Close() (err error) {
+	if len(w.buf) > 0 {
+		err = w.file.writeEntry(w.stream, string(w.buf))
+		w.buf = nil
+	}
+	return exterrors.Append(err, w.file.close())
+}
@@ -10,13 +10,21 @@ import (
 )
 
 type ContainerGroup struct {
-	runners []Container
-	debug   log.Logger
-	err     error
+	runners   []Container
+	debug     log.Logger
+	onStarted func(Container) error
+	err       error
 }
 
 func NewContainerGroup(debug log.Logger) *ContainerGroup {
-	return &ContainerGroup{nil, debug, nil}
+	return &ContainerGroup{nil, debug, nil, nil}
+}
+
+// Registers a hook that is called after each container start and may
+// block or fail subsequent starts, e.g. to await a started container's
+// health before its dependents are started.
+func (m *ContainerGroup) OnStarted(f func(Container) error) {
+	m.onStarted = f
 }
 
 func (m *ContainerGroup) Close() (err error) {
@@ -39,7 +47,9 @@ func (m *ContainerGroup) Start() {
 	}
 
 	for i, c := range m.runners {
-		m.err = c.Start()
+		if m.err = c.Start(); m.err == nil && m.onStarted != nil {
+			m.err = m.onStarted(c)
+		}
 		if m.err != nil {
 			m.debug.Println("start:", m.err)
 			for _, sc := range m.runners[0:i] {
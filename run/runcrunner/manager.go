@@ -2,6 +2,7 @@ package runcrunner
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -64,6 +65,106 @@ func (m *ContainerManager) Kill(id string, signal os.Signal, all bool) error {
 	return nil
 }
 
+// Suspends all processes within the container
+func (m *ContainerManager) Pause(id string) error {
+	return m.runc("pause", id)
+}
+
+// Resumes all previously paused processes within the container
+func (m *ContainerManager) Resume(id string) error {
+	return m.runc("resume", id)
+}
+
+func (m *ContainerManager) runc(subCmd string, id string) error {
+	c := exec.Command("runc", "--root", m.rootDir, subCmd, id)
+	var buf bytes.Buffer
+	c.Stdout = &buf
+	c.Stderr = &buf
+	if err := c.Run(); err != nil {
+		return errors.Errorf("%s: %s: %s", subCmd, err, strings.TrimRight(buf.String(), "\n"))
+	}
+	return nil
+}
+
+// Returns the pid of the container's init process using runc state
+func (m *ContainerManager) Pid(id string) (pid int, err error) {
+	c := exec.Command("runc", "--root", m.rootDir, "state", id)
+	var buf, errBuf bytes.Buffer
+	c.Stdout = &buf
+	c.Stderr = &errBuf
+	if err = c.Run(); err != nil {
+		return 0, errors.Errorf("container pid: %s: %s", err, strings.TrimRight(errBuf.String(), "\n"))
+	}
+	var st struct {
+		Pid int `json:"pid"`
+	}
+	if err = json.Unmarshal(buf.Bytes(), &st); err != nil {
+		return 0, errors.Wrap(err, "container pid")
+	}
+	return st.Pid, nil
+}
+
+// Reads the container's cgroup and network counters using runc events
+func (m *ContainerManager) Stats(id string) (r run.ContainerStats, err error) {
+	c := exec.Command("runc", "--root", m.rootDir, "events", "--stats", id)
+	var buf, errBuf bytes.Buffer
+	c.Stdout = &buf
+	c.Stderr = &errBuf
+	if err = c.Run(); err != nil {
+		return r, errors.Errorf("container stats: %s: %s", err, strings.TrimRight(errBuf.String(), "\n"))
+	}
+	var ev struct {
+		Data struct {
+			Cpu struct {
+				Usage struct {
+					Total uint64 `json:"total"`
+				} `json:"usage"`
+			} `json:"cpu"`
+			Memory struct {
+				Usage struct {
+					Usage uint64 `json:"usage"`
+					Limit uint64 `json:"limit"`
+				} `json:"usage"`
+			} `json:"memory"`
+			Blkio struct {
+				IoServiceBytesRecursive []struct {
+					Op    string `json:"op"`
+					Value uint64 `json:"value"`
+				} `json:"ioServiceBytesRecursive"`
+			} `json:"blkio"`
+			Interfaces []struct {
+				Name      string `json:"name"`
+				RxBytes   uint64 `json:"rx_bytes"`
+				RxPackets uint64 `json:"rx_packets"`
+				TxBytes   uint64 `json:"tx_bytes"`
+				TxPackets uint64 `json:"tx_packets"`
+			} `json:"network_interfaces"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(buf.Bytes(), &ev); err != nil {
+		return r, errors.Wrap(err, "container stats")
+	}
+	r.ID = id
+	r.CpuUsage = ev.Data.Cpu.Usage.Total
+	r.MemoryUsage = ev.Data.Memory.Usage.Usage
+	r.MemoryLimit = ev.Data.Memory.Usage.Limit
+	for _, e := range ev.Data.Blkio.IoServiceBytesRecursive {
+		switch e.Op {
+		case "Read":
+			r.BlkioRead += e.Value
+		case "Write":
+			r.BlkioWrite += e.Value
+		}
+	}
+	r.Interfaces = make([]run.NetworkStats, 0, len(ev.Data.Interfaces))
+	for _, iface := range ev.Data.Interfaces {
+		r.NetworkRx += iface.RxBytes
+		r.NetworkTx += iface.TxBytes
+		r.Interfaces = append(r.Interfaces, run.NetworkStats{iface.Name, iface.RxBytes, iface.RxPackets, iface.TxBytes, iface.TxPackets})
+	}
+	return
+}
+
 func (m *ContainerManager) List() (r []run.ContainerInfo, err error) {
 	r = []run.ContainerInfo{}
 	if _, e := os.Stat(m.rootDir); !os.IsNotExist(e) {
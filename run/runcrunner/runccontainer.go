@@ -101,6 +101,18 @@ func (c *RuncContainer) runcArgs(a ...string) []string {
 	return append(append(make([]string, 0, len(a)+3), "runc", "--root", c.rootDir), a...)
 }
 
+func (c *RuncContainer) Attach(io run.ContainerIO) error {
+	return errors.New("attach: not supported by the runc driver")
+}
+
+func (c *RuncContainer) Checkpoint(leaveRunning bool) error {
+	return errors.New("checkpoint: not supported by the runc driver")
+}
+
+func (c *RuncContainer) Restore() error {
+	return errors.New("restore: not supported by the runc driver")
+}
+
 func (c *RuncContainer) Stop() {
 	c.process.Stop()
 }
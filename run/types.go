@@ -19,9 +19,12 @@ type ContainerBundle interface {
 }
 
 type ContainerConfig struct {
-	Id             string
-	Bundle         ContainerBundle
-	Io             ContainerIO
+	Id     string
+	Bundle ContainerBundle
+	Io     ContainerIO
+	// Restart policy applied by the container's supervisor process:
+	// no|on-failure|always|unless-stopped
+	RestartPolicy  string
 	NoPivotRoot    bool
 	NoNewKeyring   bool
 	DestroyOnClose bool
@@ -46,12 +49,24 @@ type ContainerManager interface {
 	List() ([]ContainerInfo, error)
 	Kill(id string, signal os.Signal, all bool) error
 	Exist(id string) (bool, error)
+	// Returns the pid of the container's init process on the host
+	Pid(id string) (int, error)
+	Stats(id string) (ContainerStats, error)
+	Pause(id string) error
+	Resume(id string) error
 }
 
 type Container interface {
 	ID() string
 	Rootfs() string
 	Start() error
+	// Connects the given streams to the running container
+	Attach(ContainerIO) error
+	// Checkpoints the running container's state using CRIU,
+	// optionally leaving its processes running
+	Checkpoint(leaveRunning bool) error
+	// Restores the container from its bundle's last checkpoint
+	Restore() error
 	// TODO: expose process
 	Exec(*specs.Process, ContainerIO) (Process, error)
 	Destroy() error
@@ -69,6 +84,28 @@ type ContainerInfo struct {
 	Status string
 }
 
+// Cumulative resource usage counters of a running container
+type ContainerStats struct {
+	ID          string
+	CpuUsage    uint64 // total cpu time consumed in nanoseconds
+	MemoryUsage uint64 // current memory usage in bytes
+	MemoryLimit uint64 // memory limit in bytes (0 == unlimited)
+	BlkioRead   uint64 // bytes read from block devices
+	BlkioWrite  uint64 // bytes written to block devices
+	NetworkRx   uint64 // bytes received on all interfaces
+	NetworkTx   uint64 // bytes transmitted on all interfaces
+	Interfaces  []NetworkStats
+}
+
+// Per-interface counters read from the container's network namespace
+type NetworkStats struct {
+	Name      string
+	RxBytes   uint64
+	RxPackets uint64
+	TxBytes   uint64
+	TxPackets uint64
+}
+
 type ExitError struct {
 	containerId string
 	code        int
@@ -22,15 +22,25 @@ var _ image.ImageStore = &Store{}
 type Store struct {
 	image.ImageStore
 	bundle.BundleStore
+	*VolumeStore
 }
 
-func NewStore(dir string, rootless bool, systemContext *types.SystemContext, trustPolicy istore.TrustPolicyContext, loggers log.Loggers) (r Store, err error) {
+// Creates a store within dir. tempDir must be on the same file system as dir
+// to allow atomic renames into the store and defaults to .temp within dir.
+// pullJobs is the number of concurrent layer downloads during image pulls
+// whose progress is reported to progress.
+func NewStore(dir string, tempDir string, pullJobs int, progress istore.ProgressReporter, rootless bool, systemContext *types.SystemContext, trustPolicy istore.TrustPolicyContext, loggers log.Loggers) (r Store, err error) {
 	if dir == "" {
 		return r, errors.New("init store: no store directory provided")
 	}
 	if !filepath.IsAbs(dir) {
 		return r, errors.New("no absolute --store-dir provided")
 	}
+	if tempDir == "" {
+		tempDir = filepath.Join(dir, ".temp")
+	} else if !filepath.IsAbs(tempDir) {
+		return r, errors.New("no absolute --temp-dir provided")
+	}
 	locker, err := lock.NewExclusiveDirLocker(dir)
 	if err != nil {
 		return r, errors.Wrap(err, "init store")
@@ -40,12 +50,14 @@ func NewStore(dir string, rootless bool, systemContext *types.SystemContext, tru
 	imageRepoDir := filepath.Join(dir, "image-repos")
 	imageIdDir := filepath.Join(dir, "image-ids")
 	bundleDir := filepath.Join(dir, "bundles")
-	tempDir := filepath.Join(dir, ".temp")
+	volumeDir := filepath.Join(dir, "volumes")
+	layerDir := filepath.Join(dir, "layers")
 	mtreeStore := istore.NewFsSpecStore(fsspecDir, loggers.Debug)
 	blobStore := istore.NewContentAddressableStore(blobDir)
 	blobStoreExt := istore.NewOCIBlobStore(&blobStore, &mtreeStore, rootless, loggers.Warn, loggers.Debug)
-	rostore := istore.NewImageStoreRO(imageRepoDir, &blobStoreExt, istore.NewImageIdStore(imageIdDir), loggers.Warn)
-	r.ImageStore = istore.NewImageStore(locker, rostore, tempDir, systemContext, trustPolicy, rootless, loggers)
+	rostore := istore.NewImageStoreRO(imageRepoDir, layerDir, &blobStoreExt, istore.NewImageIdStore(imageIdDir), loggers.Warn)
+	r.ImageStore = istore.NewImageStore(locker, rostore, tempDir, pullJobs, progress, systemContext, trustPolicy, rootless, loggers)
 	r.BundleStore = bstore.NewBundleStore(bundleDir, loggers.Info, loggers.Debug)
+	r.VolumeStore = NewVolumeStore(volumeDir, loggers.Debug)
 	return
 }
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	exterrors "github.com/mgoltzsche/ctnr/pkg/errors"
+	"github.com/mgoltzsche/ctnr/pkg/log"
+	"github.com/pkg/errors"
+)
+
+const volumeMetadataFile = "volume.json"
+
+var volumeNameRegexp = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+// Named volume metadata
+type Volume struct {
+	Name    string            `json:"name"`
+	Driver  string            `json:"driver"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Created time.Time         `json:"created"`
+	Dir     string            `json:"-"`
+}
+
+// Restricts the volumes a batch operation is applied to. nil matches all volumes.
+type VolumeMatcher func(*Volume) bool
+
+// Store of named volumes that are shared between bundles.
+// Each volume is kept in its own directory containing a metadata file
+// and the data directory that is mounted into containers.
+type VolumeStore struct {
+	dir   string
+	debug log.FieldLogger
+}
+
+func NewVolumeStore(dir string, debug log.FieldLogger) *VolumeStore {
+	return &VolumeStore{dir, debug}
+}
+
+// Creates a new named volume. Currently only the "local" driver is supported.
+func (s *VolumeStore) CreateVolume(name string, driver string, labels map[string]string) (v Volume, err error) {
+	defer exterrors.Wrapd(&err, "create volume")
+	if !volumeNameRegexp.MatchString(name) {
+		return v, errors.Errorf("invalid volume name %q", name)
+	}
+	if driver == "" {
+		driver = "local"
+	}
+	if driver != "local" {
+		return v, errors.Errorf("unsupported volume driver %q", driver)
+	}
+	dir := filepath.Join(s.dir, name)
+	if _, e := os.Stat(dir); e == nil {
+		return v, errors.Errorf("volume %q already exists", name)
+	}
+	v = Volume{name, driver, labels, time.Now().UTC(), dir}
+	if err = os.MkdirAll(filepath.Join(dir, "data"), 0750); err != nil {
+		return v, errors.New(err.Error())
+	}
+	b, err := json.Marshal(&v)
+	if err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, volumeMetadataFile), b, 0640); err != nil {
+		err = errors.New(err.Error())
+	}
+	return
+}
+
+// Returns the named volume's metadata.
+func (s *VolumeStore) Volume(name string) (v Volume, err error) {
+	dir := filepath.Join(s.dir, name)
+	b, err := ioutil.ReadFile(filepath.Join(dir, volumeMetadataFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = errors.Errorf("volume %q not found", name)
+		} else {
+			err = errors.Wrap(err, "volume")
+		}
+		return
+	}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return v, errors.Wrapf(err, "volume %q metadata", name)
+	}
+	v.Dir = dir
+	return
+}
+
+// Lists all named volumes.
+func (s *VolumeStore) Volumes() (l []Volume, err error) {
+	fl, e := ioutil.ReadDir(s.dir)
+	l = make([]Volume, 0, len(fl))
+	if e != nil && !os.IsNotExist(e) {
+		return l, errors.Wrap(e, "volumes")
+	}
+	for _, f := range fl {
+		if f.IsDir() {
+			v, e := s.Volume(f.Name())
+			if e == nil {
+				l = append(l, v)
+			} else {
+				err = exterrors.Append(err, e)
+			}
+		}
+	}
+	return
+}
+
+// Deletes the named volume including its data.
+func (s *VolumeStore) DelVolume(name string) (err error) {
+	if _, err = s.Volume(name); err != nil {
+		return
+	}
+	if err = os.RemoveAll(filepath.Join(s.dir, name)); err != nil {
+		err = errors.Wrap(err, "delete volume")
+	}
+	return
+}
+
+// Returns the directory of the named volume's data that is mounted into containers.
+// The volume is created if it does not exist yet.
+func (s *VolumeStore) VolumeDir(name string) (dir string, err error) {
+	v, err := s.Volume(name)
+	if err != nil {
+		if v, err = s.CreateVolume(name, "", nil); err != nil {
+			return
+		}
+		s.debug.Printf("Created volume %q", name)
+	}
+	return filepath.Join(v.Dir, "data"), nil
+}
+
+// Deletes all matching volumes the given referenced check does not claim.
+func (s *VolumeStore) VolumeGC(match VolumeMatcher, referenced VolumeMatcher) (r []Volume, err error) {
+	s.debug.Println("Running volume GC")
+	l, err := s.Volumes()
+	r = make([]Volume, 0, len(l))
+	for _, v := range l {
+		if match != nil && !match(&v) {
+			continue
+		}
+		if referenced != nil && referenced(&v) {
+			continue
+		}
+		if e := s.DelVolume(v.Name); e != nil {
+			err = exterrors.Append(err, e)
+		} else {
+			s.debug.WithField("name", v.Name).Printf("volume garbage collected")
+			r = append(r, v)
+		}
+	}
+	return
+}
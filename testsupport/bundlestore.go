@@ -0,0 +1,14 @@
+package testsupport
+
+import (
+	"github.com/mgoltzsche/ctnr/bundle"
+	bstore "github.com/mgoltzsche/ctnr/bundle/store"
+	"github.com/mgoltzsche/ctnr/pkg/log"
+)
+
+// Creates a bundle store within the given (usually temporary) directory
+// with discarded log output. Bundles are plain unprivileged directories
+// so that the store works in tests without root privileges.
+func NewTestBundleStore(dir string) bundle.BundleStore {
+	return bstore.NewBundleStore(dir, log.NewNopLogger(), log.NewNopLogger())
+}
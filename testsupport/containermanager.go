@@ -0,0 +1,201 @@
+package testsupport
+
+import (
+	"os"
+	"sync"
+
+	"github.com/mgoltzsche/ctnr/run"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+var _ run.ContainerManager = &FakeContainerManager{}
+
+// Fake container manager tracking container state in memory
+// without spawning any processes.
+type FakeContainerManager struct {
+	mutex      sync.Mutex
+	containers map[string]*FakeContainer
+	// Container IDs recorded by Kill invocations
+	Killed []string
+}
+
+func NewFakeContainerManager() *FakeContainerManager {
+	return &FakeContainerManager{containers: map[string]*FakeContainer{}}
+}
+
+func (m *FakeContainerManager) NewContainer(cfg *run.ContainerConfig) (run.Container, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	id := cfg.Id
+	if id == "" && cfg.Bundle != nil {
+		id = cfg.Bundle.ID()
+	}
+	if _, ok := m.containers[id]; ok {
+		return nil, errors.Errorf("container %q already exists", id)
+	}
+	rootfs := ""
+	if cfg.Bundle != nil {
+		rootfs = cfg.Bundle.Dir() + "/rootfs"
+	}
+	c := &FakeContainer{manager: m, id: id, rootfs: rootfs, Status: "created"}
+	m.containers[id] = c
+	return c, nil
+}
+
+func (m *FakeContainerManager) Get(id string) (run.Container, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c, ok := m.containers[id]
+	if !ok {
+		return nil, errors.Errorf("container %q does not exist", id)
+	}
+	return c, nil
+}
+
+func (m *FakeContainerManager) List() (r []run.ContainerInfo, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	r = make([]run.ContainerInfo, 0, len(m.containers))
+	for _, c := range m.containers {
+		r = append(r, run.ContainerInfo{c.id, c.Status})
+	}
+	return
+}
+
+func (m *FakeContainerManager) Kill(id string, signal os.Signal, all bool) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c, ok := m.containers[id]
+	if !ok {
+		return errors.Errorf("container %q does not exist", id)
+	}
+	m.Killed = append(m.Killed, id)
+	c.Status = "stopped"
+	return nil
+}
+
+func (m *FakeContainerManager) Exist(id string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.containers[id]
+	return ok, nil
+}
+
+func (m *FakeContainerManager) Pid(id string) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.containers[id]; !ok {
+		return 0, errors.Errorf("container %q does not exist", id)
+	}
+	return os.Getpid(), nil
+}
+
+func (m *FakeContainerManager) Stats(id string) (r run.ContainerStats, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.containers[id]; !ok {
+		return r, errors.Errorf("container %q does not exist", id)
+	}
+	r.ID = id
+	return
+}
+
+func (m *FakeContainerManager) Pause(id string) error {
+	return m.setStatus(id, "paused")
+}
+
+func (m *FakeContainerManager) Resume(id string) error {
+	return m.setStatus(id, "running")
+}
+
+func (m *FakeContainerManager) setStatus(id, status string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c, ok := m.containers[id]
+	if !ok {
+		return errors.Errorf("container %q does not exist", id)
+	}
+	c.Status = status
+	return nil
+}
+
+var _ run.Container = &FakeContainer{}
+
+// Fake container recording state transitions in memory.
+type FakeContainer struct {
+	manager *FakeContainerManager
+	id      string
+	rootfs  string
+	Status  string
+	// Set to let Wait return an error
+	WaitErr error
+}
+
+func (c *FakeContainer) ID() string {
+	return c.id
+}
+
+func (c *FakeContainer) Rootfs() string {
+	return c.rootfs
+}
+
+func (c *FakeContainer) Start() error {
+	c.Status = "running"
+	return nil
+}
+
+func (c *FakeContainer) Attach(io run.ContainerIO) error {
+	return nil
+}
+
+func (c *FakeContainer) Checkpoint(leaveRunning bool) error {
+	if !leaveRunning {
+		c.Status = "stopped"
+	}
+	return nil
+}
+
+func (c *FakeContainer) Restore() error {
+	c.Status = "running"
+	return nil
+}
+
+func (c *FakeContainer) Exec(process *specs.Process, io run.ContainerIO) (run.Process, error) {
+	if c.Status != "running" {
+		return nil, errors.Errorf("exec: container %q is not running", c.id)
+	}
+	return &fakeProcess{}, nil
+}
+
+func (c *FakeContainer) Destroy() error {
+	c.manager.mutex.Lock()
+	defer c.manager.mutex.Unlock()
+	delete(c.manager.containers, c.id)
+	return nil
+}
+
+func (c *FakeContainer) Wait() error {
+	c.Status = "stopped"
+	return c.WaitErr
+}
+
+func (c *FakeContainer) Stop() {
+	c.Status = "stopped"
+}
+
+func (c *FakeContainer) Close() error {
+	return nil
+}
+
+type fakeProcess struct{}
+
+func (p *fakeProcess) Wait() error {
+	return nil
+}
+
+func (p *fakeProcess) Stop() {}
+
+func (p *fakeProcess) Close() error {
+	return nil
+}
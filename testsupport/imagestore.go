@@ -0,0 +1,299 @@
+// Package testsupport provides in-memory test doubles for ctnr's store and
+// runtime interfaces so that orchestration logic can be unit-tested without
+// root privileges, real stores or kernel features.
+package testsupport
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgoltzsche/ctnr/image"
+	"github.com/mgoltzsche/ctnr/pkg/fs"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+var _ image.ImageStore = &InMemoryImageStore{}
+
+// In-memory image store holding image metadata only.
+// Content operations that would require actual layer blobs are not supported.
+type InMemoryImageStore struct {
+	mutex  sync.Mutex
+	images map[digest.Digest]image.Image
+	tags   map[string]digest.Digest
+	// Image names recorded by PushImage invocations
+	Pushed []string
+}
+
+func NewInMemoryImageStore() *InMemoryImageStore {
+	return &InMemoryImageStore{
+		images: map[digest.Digest]image.Image{},
+		tags:   map[string]digest.Digest{},
+	}
+}
+
+// Adds an image with the given configuration to the store,
+// tagging it with the given name unless it is empty.
+func (s *InMemoryImageStore) AddImage(name string, cfg ispecs.Image) (img image.Image, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if img, err = s.addImageConfig(cfg); err == nil && name != "" {
+		s.tags[normalizeNameRef(name)] = img.ID()
+	}
+	return
+}
+
+func (s *InMemoryImageStore) addImageConfig(cfg ispecs.Image) (img image.Image, err error) {
+	cfgJson, err := json.Marshal(&cfg)
+	if err != nil {
+		return img, errors.Wrap(err, "add image config")
+	}
+	manifest := ispecs.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config: ispecs.Descriptor{
+			MediaType: ispecs.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(cfgJson),
+			Size:      int64(len(cfgJson)),
+		},
+	}
+	manifestJson, err := json.Marshal(&manifest)
+	if err != nil {
+		return img, errors.Wrap(err, "add image config")
+	}
+	now := time.Now()
+	info := image.NewImageInfo(digest.FromBytes(manifestJson), manifest, nil, now, now)
+	img = image.NewImage(info, cfg)
+	s.images[img.ID()] = img
+	return
+}
+
+func (s *InMemoryImageStore) Images() (l []*image.ImageInfo, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids := make([]string, 0, len(s.images))
+	for id := range s.images {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+	l = make([]*image.ImageInfo, 0, len(ids))
+	for _, id := range ids {
+		img := s.images[digest.Digest(id)]
+		info := img.ImageInfo
+		info.Tag = s.tagOf(img.ID())
+		l = append(l, &info)
+	}
+	return
+}
+
+func (s *InMemoryImageStore) tagOf(id digest.Digest) *image.TagName {
+	names := make([]string, 0, 1)
+	for name, tagged := range s.tags {
+		if tagged == id {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return parseNameRef(names[0])
+}
+
+func (s *InMemoryImageStore) Image(id digest.Digest) (img image.Image, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.image(id)
+}
+
+func (s *InMemoryImageStore) image(id digest.Digest) (img image.Image, err error) {
+	img, ok := s.images[id]
+	if !ok {
+		err = image.ErrNotExist(errors.Errorf("image %s not found in in-memory store", id))
+	}
+	return
+}
+
+func (s *InMemoryImageStore) ImageByName(name string) (img image.Image, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.imageByName(name)
+}
+
+func (s *InMemoryImageStore) imageByName(name string) (img image.Image, err error) {
+	id, ok := s.tags[normalizeNameRef(name)]
+	if !ok {
+		return img, image.ErrNotExist(errors.Errorf("image %q not found in in-memory store", name))
+	}
+	return s.image(id)
+}
+
+func (s *InMemoryImageStore) Inspect(nameOrId string) (r image.ImageDetails, err error) {
+	img, err := image.GetLocalImage(s, nameOrId)
+	if err != nil {
+		return
+	}
+	layers := make([]digest.Digest, len(img.Manifest.Layers))
+	for i, l := range img.Manifest.Layers {
+		layers[i] = l.Digest
+	}
+	tag := ""
+	if t := s.tagOf(img.ID()); t != nil {
+		tag = t.String()
+	}
+	return image.ImageDetails{img.ID(), tag, img.Created, img.Size(), img.ManifestDigest, img.Manifest, img.Config, layers}, nil
+}
+
+func (s *InMemoryImageStore) OpenLockedImageStore() (image.ImageStoreRW, error) {
+	return &inMemoryImageStoreRW{s}, nil
+}
+
+func (s *InMemoryImageStore) ImageGC(ttl, refTTL time.Duration, maxPerRepo int) error {
+	return nil
+}
+
+// No-op since the in-memory store holds no blobs that could be reclaimed.
+func (s *InMemoryImageStore) ImagePrune() (uint64, error) {
+	return 0, nil
+}
+
+func (s *InMemoryImageStore) DelImage(ids ...digest.Digest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range ids {
+		delete(s.images, id)
+		for name, tagged := range s.tags {
+			if tagged == id {
+				delete(s.tags, name)
+			}
+		}
+	}
+	return nil
+}
+
+var _ image.ImageStoreRW = &inMemoryImageStoreRW{}
+
+type inMemoryImageStoreRW struct {
+	*InMemoryImageStore
+}
+
+// Creates an empty image with the given name instead of fetching it
+// from a remote source.
+func (s *inMemoryImageStoreRW) ImportImage(name string) (img image.Image, err error) {
+	return s.AddImage(name, ispecs.Image{})
+}
+
+func (s *inMemoryImageStoreRW) PushImage(nameRef string, dest string, signBy string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Pushed = append(s.Pushed, nameRef)
+	return nil
+}
+
+func (s *inMemoryImageStoreRW) SupportsTransport(transportName string) bool {
+	return true
+}
+
+func (s *inMemoryImageStoreRW) AddImageConfig(m ispecs.Image, parentImageId *digest.Digest) (img image.Image, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.addImageConfig(m)
+}
+
+func (s *inMemoryImageStoreRW) FS(imageId digest.Digest) (fs.FsNode, error) {
+	return nil, errors.New("image fs: not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) SetBuildTimestamp(t time.Time) {}
+
+func (s *inMemoryImageStoreRW) SquashLayers(imageId digest.Digest, n int) (img image.Image, err error) {
+	return img, errors.New("squash layers: not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) AnnotateImage(imageId digest.Digest, set map[string]string, remove []string) (img image.Image, err error) {
+	return img, errors.New("annotate image: not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) AnnotateImageIndex(repoName string, set map[string]string, remove []string) error {
+	return errors.New("annotate image index: not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) AddLayer(rootfs fs.FsNode, parentImageId *digest.Digest, author, createdByOp string) (img image.Image, err error) {
+	return img, errors.New("add layer: not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) UnpackImageLayers(id digest.Digest, rootfs string) (err error) {
+	if _, err = s.Image(id); err != nil {
+		return
+	}
+	if err = os.MkdirAll(rootfs, 0755); err != nil {
+		err = errors.New(err.Error())
+	}
+	return
+}
+
+func (s *inMemoryImageStoreRW) UnpackImageLayerDiff(id, parentId digest.Digest, rootfs string) (err error) {
+	return s.UnpackImageLayers(id, rootfs)
+}
+
+func (s *inMemoryImageStoreRW) UnpackImageLayersShared(id digest.Digest) ([]string, error) {
+	return nil, errors.New("UnpackImageLayersShared() not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) UnpackImageFsShared(id digest.Digest) (string, error) {
+	return "", errors.New("UnpackImageFsShared() not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) UnpackImageSquashfs(id digest.Digest) (string, error) {
+	return "", errors.New("UnpackImageSquashfs() not supported by the in-memory image store")
+}
+
+func (s *inMemoryImageStoreRW) TagImage(imageId digest.Digest, tag string) (info image.ImageInfo, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	img, err := s.image(imageId)
+	if err != nil {
+		return
+	}
+	name := normalizeNameRef(tag)
+	s.tags[name] = imageId
+	info = img.ImageInfo
+	info.Tag = parseNameRef(name)
+	return
+}
+
+func (s *inMemoryImageStoreRW) UntagImage(tag string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name := normalizeNameRef(tag)
+	if _, ok := s.tags[name]; !ok {
+		return image.ErrNotExist(errors.Errorf("image %q not found in in-memory store", tag))
+	}
+	delete(s.tags, name)
+	return nil
+}
+
+func (s *inMemoryImageStoreRW) Close() error {
+	return nil
+}
+
+func normalizeNameRef(nameRef string) string {
+	return parseNameRef(nameRef).String()
+}
+
+func parseNameRef(nameRef string) *image.TagName {
+	var r image.TagName
+	if li := strings.LastIndex(nameRef, ":"); li > 0 && li+1 < len(nameRef) {
+		r.Repo = nameRef[:li]
+		r.Ref = nameRef[li+1:]
+	} else {
+		r.Repo = nameRef
+		r.Ref = "latest"
+	}
+	return &r
+}
@@ -0,0 +1,94 @@
+package testsupport
+
+import (
+	"testing"
+
+	"github.com/mgoltzsche/ctnr/image"
+	"github.com/mgoltzsche/ctnr/run"
+	ispecs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestInMemoryImageStore(t *testing.T) {
+	s := NewInMemoryImageStore()
+	cfg := ispecs.Image{Architecture: "amd64", OS: "linux"}
+	img, err := s.AddImage("docker.io/library/alpine:3.7", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Image(img.ID()); err != nil {
+		t.Errorf("Image(%s) returned error: %s", img.ID(), err)
+	}
+	byName, err := s.ImageByName("docker.io/library/alpine:3.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byName.ID() != img.ID() {
+		t.Errorf("ImageByName() returned image %s but expected %s", byName.ID(), img.ID())
+	}
+	if _, err = s.ImageByName("docker.io/library/unknown"); !image.IsNotExist(err) {
+		t.Errorf("ImageByName() of unknown image should return ErrNotExist but was %s", err)
+	}
+	rw, err := s.OpenLockedImageStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := rw.ImportImage("docker.io/library/busybox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.ImageByName("docker.io/library/busybox:latest"); err != nil {
+		t.Errorf("imported image not resolvable by name: %s", err)
+	}
+	l, err := s.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 2 {
+		t.Errorf("Images() returned %d entries but expected 2", len(l))
+	}
+	if err = s.DelImage(imported.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Image(imported.ID()); !image.IsNotExist(err) {
+		t.Errorf("Image() of deleted image should return ErrNotExist but was %s", err)
+	}
+}
+
+func TestFakeContainerManager(t *testing.T) {
+	m := NewFakeContainerManager()
+	c, err := m.NewContainer(&run.ContainerConfig{Id: "testee"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 1 || l[0].ID != "testee" || l[0].Status != "running" {
+		t.Errorf("List() returned unexpected result: %+v", l)
+	}
+	if err = m.Pause("testee"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.List(); s[0].Status != "paused" {
+		t.Errorf("container status should be 'paused' but was %q", s[0].Status)
+	}
+	if err = m.Resume("testee"); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Kill("testee", nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Killed) != 1 {
+		t.Errorf("Kill() invocation not recorded")
+	}
+	if err = c.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if exist, _ := m.Exist("testee"); exist {
+		t.Errorf("destroyed container should not exist")
+	}
+}